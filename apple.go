@@ -0,0 +1,312 @@
+package parsemail
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"mime/multipart"
+	"strings"
+)
+
+// Macintosh files carrying a resource fork and Finder metadata next to their data: BinHex 4.0
+// (application/mac-binhex40), AppleSingle (application/applefile) and AppleDouble (multipart/appledouble, RFC 1740)
+
+const contentTypeMultipartAppleDouble = "multipart/appledouble"
+const contentTypeApplicationAppleFile = "application/applefile"
+const contentTypeApplicationBinHex = "application/mac-binhex40"
+
+const (
+	appleSingleMagic      = 0x00051600
+	appleDoubleMagic      = 0x00051607
+	appleFileHeaderSize   = 26
+	appleFileEntrySize    = 12
+	appleEntryDataFork    = 1
+	appleEntryResource    = 2
+	appleEntryRealName    = 3
+	appleEntryFinderInfo  = 9
+	finderInfoMinimumSize = 10
+	binHexAlphabet        = "!\"#$%&'()*+,-012345689@ABCDEFGHIJKLMNPQRSTUVXYZ[`abcdefhijklmpqr"
+	binHexRunMarker       = 0x90
+)
+
+// AppleFileInfo holds the Macintosh metadata of an attachment which isn't part of its data fork
+type AppleFileInfo struct {
+	// Type and Creator are the four character type and creator codes, e.g. "TEXT" and "ttxt"
+	Type    string
+	Creator string
+	// FinderFlags are the Finder flags of the file
+	FinderFlags  uint16
+	ResourceFork []byte
+}
+
+func isAppleFile(part *Part) bool {
+	switch part.contentType {
+	case contentTypeMultipartAppleDouble, contentTypeApplicationAppleFile, contentTypeApplicationBinHex:
+		return true
+	}
+
+	return false
+}
+
+// decodeAppleFileAttachment decodes the data fork of a Macintosh file part into an attachment,
+// the rest of the file is kept in its AppleFile field
+func decodeAppleFileAttachment(part *Part) (at Attachment, err error) {
+	if part.contentType == contentTypeMultipartAppleDouble {
+		return parseMultipartAppleDouble(part, part.contentTypeParams["boundary"])
+	}
+
+	filename := decodeMimeSentence(part.FileName())
+	if filename == "" {
+		filename = decodeMimeSentence(part.contentTypeParams["name"])
+	}
+
+	decoded, err := decodeContent(part, part.contentTransferEncoding)
+	if err != nil {
+		return
+	}
+	content, err := ioutil.ReadAll(decoded)
+	if err != nil {
+		return
+	}
+
+	var name string
+	var data []byte
+	if part.contentType == contentTypeApplicationBinHex {
+		at.AppleFile, name, data, err = decodeBinHex(content)
+	} else {
+		at.AppleFile, name, data, err = decodeAppleFile(content)
+	}
+	if err != nil {
+		return
+	}
+
+	if name != "" {
+		filename = name
+	}
+	at.Filename = filename
+	at.ContentType = contentTypeByFilename(filename)
+	at.Data = bytes.NewReader(data)
+
+	return
+}
+
+// parseMultipartAppleDouble reads the AppleDouble header part followed by the data fork part
+func parseMultipartAppleDouble(msg io.Reader, boundary string) (at Attachment, err error) {
+	mr := multipart.NewReader(msg, boundary)
+
+	var info *AppleFileInfo
+	var name string
+	for {
+		part, err := NextPart(mr)
+		if err == io.EOF {
+			break
+		} else if err != nil {
+			return at, err
+		}
+
+		decoded, err := decodeContent(part, part.contentTransferEncoding)
+		if err != nil {
+			return at, err
+		}
+
+		if part.contentType == contentTypeApplicationAppleFile {
+			content, err := ioutil.ReadAll(decoded)
+			if err != nil {
+				return at, err
+			}
+			if info, name, _, err = decodeAppleFile(content); err != nil {
+				return at, err
+			}
+			continue
+		}
+
+		at.Filename = decodeMimeSentence(part.FileName())
+		if at.Filename == "" {
+			at.Filename = decodeMimeSentence(part.contentTypeParams["name"])
+		}
+		at.ContentType = part.contentType
+		at.Data = decoded
+	}
+
+	if at.Data == nil {
+		return at, fmt.Errorf("multipart/appledouble without data fork")
+	}
+	if at.Filename == "" {
+		at.Filename = name
+	}
+	at.AppleFile = info
+
+	return at, nil
+}
+
+// decodeAppleFile reads an AppleSingle or AppleDouble file, AppleDouble files have no data fork
+func decodeAppleFile(b []byte) (info *AppleFileInfo, name string, data []byte, err error) {
+	if len(b) < appleFileHeaderSize {
+		return nil, "", nil, fmt.Errorf("applefile too short")
+	}
+	if magic := binary.BigEndian.Uint32(b); magic != appleSingleMagic && magic != appleDoubleMagic {
+		return nil, "", nil, fmt.Errorf("invalid applefile magic number: %x", magic)
+	}
+
+	info = &AppleFileInfo{}
+	entries := int(binary.BigEndian.Uint16(b[24:]))
+	for i := 0; i < entries; i++ {
+		pos := appleFileHeaderSize + i*appleFileEntrySize
+		if pos+appleFileEntrySize > len(b) {
+			return nil, "", nil, fmt.Errorf("applefile entries truncated")
+		}
+
+		id := binary.BigEndian.Uint32(b[pos:])
+		offset := int(binary.BigEndian.Uint32(b[pos+4:]))
+		length := int(binary.BigEndian.Uint32(b[pos+8:]))
+		if offset < 0 || length < 0 || offset+length > len(b) {
+			return nil, "", nil, fmt.Errorf("applefile entry %d out of range", id)
+		}
+		entry := b[offset : offset+length]
+
+		switch id {
+		case appleEntryDataFork:
+			data = entry
+		case appleEntryResource:
+			info.ResourceFork = entry
+		case appleEntryRealName:
+			name = decodeMacRoman(entry)
+		case appleEntryFinderInfo:
+			if len(entry) >= finderInfoMinimumSize {
+				info.Type, info.Creator = string(entry[0:4]), string(entry[4:8])
+				info.FinderFlags = binary.BigEndian.Uint16(entry[8:])
+			}
+		}
+	}
+
+	return info, name, data, nil
+}
+
+// decodeBinHex decodes a BinHex 4.0 file, checking the CRCs of its header and forks
+func decodeBinHex(text []byte) (info *AppleFileInfo, name string, data []byte, err error) {
+	start := bytes.IndexByte(text, ':')
+	if i := bytes.Index(text, []byte("(This file must be converted with BinHex")); i >= 0 {
+		start = bytes.IndexByte(text[i:], ':')
+		if start >= 0 {
+			start += i
+		}
+	}
+	if start < 0 {
+		return nil, "", nil, fmt.Errorf("binhex data not found")
+	}
+
+	// 6 bit characters
+	var packed []byte
+	var acc uint32
+	bits := 0
+	terminated := false
+	for _, c := range text[start+1:] {
+		if c == ':' {
+			terminated = true
+			break
+		}
+		v := strings.IndexByte(binHexAlphabet, c)
+		if v < 0 {
+			if c == ' ' || c == '\t' || c == '\r' || c == '\n' {
+				continue
+			}
+			return nil, "", nil, fmt.Errorf("invalid binhex character %q", c)
+		}
+
+		acc = acc<<6 | uint32(v)
+		bits += 6
+		if bits >= 8 {
+			bits -= 8
+			packed = append(packed, byte(acc>>uint(bits)))
+		}
+	}
+	if !terminated {
+		return nil, "", nil, fmt.Errorf("binhex data not terminated")
+	}
+
+	// run length encoding
+	var b []byte
+	for i := 0; i < len(packed); i++ {
+		if packed[i] != binHexRunMarker || i+1 >= len(packed) {
+			b = append(b, packed[i])
+			continue
+		}
+
+		i++
+		count := int(packed[i])
+		if count == 0 {
+			b = append(b, binHexRunMarker)
+			continue
+		}
+		if len(b) == 0 {
+			return nil, "", nil, fmt.Errorf("invalid binhex run")
+		}
+		for j := 1; j < count; j++ {
+			b = append(b, b[len(b)-1])
+		}
+	}
+
+	if len(b) < 1 || len(b) < 1+int(b[0])+21 {
+		return nil, "", nil, fmt.Errorf("binhex header truncated")
+	}
+	nameLength := int(b[0])
+	header := b[:1+nameLength+19]
+	pos := len(header)
+	if crc16(header) != binary.BigEndian.Uint16(b[pos:]) {
+		return nil, "", nil, fmt.Errorf("binhex header checksum mismatch")
+	}
+	pos += 2
+
+	h := header[1+nameLength+1:]
+	info = &AppleFileInfo{
+		Type:        string(h[0:4]),
+		Creator:     string(h[4:8]),
+		FinderFlags: binary.BigEndian.Uint16(h[8:]),
+	}
+	dataLength := int(binary.BigEndian.Uint32(h[10:]))
+	resourceLength := int(binary.BigEndian.Uint32(h[14:]))
+
+	forks := [][]byte{nil, nil}
+	for i, length := range []int{dataLength, resourceLength} {
+		if length < 0 || pos+length+2 > len(b) {
+			return nil, "", nil, fmt.Errorf("binhex fork truncated")
+		}
+		fork := b[pos : pos+length]
+		if crc16(fork) != binary.BigEndian.Uint16(b[pos+length:]) {
+			return nil, "", nil, fmt.Errorf("binhex fork checksum mismatch")
+		}
+		forks[i] = fork
+		pos += length + 2
+	}
+	if len(forks[1]) > 0 {
+		info.ResourceFork = forks[1]
+	}
+
+	return info, decodeMacRoman(header[1 : 1+nameLength]), forks[0], nil
+}
+
+// crc16 is the CRC-16-CCITT with zero initial value used by BinHex
+func crc16(b []byte) uint16 {
+	var crc uint16
+	for _, c := range b {
+		crc ^= uint16(c) << 8
+		for i := 0; i < 8; i++ {
+			if crc&0x8000 != 0 {
+				crc = crc<<1 ^ 0x1021
+			} else {
+				crc <<= 1
+			}
+		}
+	}
+
+	return crc
+}
+
+// decodeMacRoman decodes file names from the Mac OS Roman charset
+func decodeMacRoman(b []byte) string {
+	s, _ := decodeCharset(b, "macintosh")
+
+	return s
+}
@@ -0,0 +1,136 @@
+package parsemail
+
+import (
+	"encoding/binary"
+	"io/ioutil"
+	"strings"
+	"testing"
+)
+
+const appleFilesExample = `From: Mary Smith <mary@x.test>
+To: John Doe <jdoe@machine.example>
+Subject: Mac files
+MIME-Version: 1.0
+Content-Type: multipart/mixed; boundary="outer"
+
+--outer
+Content-Type: text/plain
+
+Three ways of sending the same file.
+--outer
+Content-Type: application/mac-binhex40; name="hello.hqx"
+Content-Disposition: attachment; filename="hello.hqx"
+
+(This file must be converted with BinHex 4.0)
+:#@KPE'a[,R4iG!"849K8G(4iG!%!N!3G!*!$$4L&5'9XE'mX)%eKBb%JBC!+)*!!
+)'9ZC!U'bh*PFfpeFQ0P)'C[FQYZ+J:
+--outer
+Content-Type: multipart/appledouble; boundary="double"
+
+--double
+Content-Type: application/applefile
+Content-Transfer-Encoding: base64
+
+AAUWBwACAAAAAAAAAAAAAAAAAAAAAAAAAAMAAAADAAAAPgAAAAkAAAAJAAAARwAAACAAAAACAAAA
+ZwAAAA1oZWxsby50eHRURVhUdHR4dAEAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAHJlc291cmNlIGZv
+cms=
+--double
+Content-Type: text/plain; name="hello.txt"
+Content-Transfer-Encoding: base64
+
+SGVsbG8sIE1hYyEgYWFhYWFhYWFhYSCQIGVuZAo=
+--double--
+--outer
+Content-Type: application/applefile
+Content-Transfer-Encoding: base64
+
+AAUWAAACAAAAAAAAAAAAAAAAAAAAAAAAAAMAAAADAAAAPgAAAAkAAAAJAAAARwAAACAAAAABAAAA
+ZwAAAB1oZWxsby50eHRURVhUdHR4dAEAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAEhlbGxvLCBNYWMh
+IGFhYWFhYWFhYWEgkCBlbmQK
+--outer--
+`
+
+func TestParseAppleFiles(t *testing.T) {
+	e, err := Parse(strings.NewReader(appleFilesExample))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var testData = map[int]struct {
+		contentType  string
+		resourceFork string
+	}{
+		1: {"text/plain", "resource fork"},
+		2: {"text/plain", "resource fork"},
+		3: {"text/plain", ""},
+	}
+
+	if len(e.Attachments) != len(testData) {
+		t.Fatalf("Wrong number of attachments. Expected: %v, Got: %v", len(testData), len(e.Attachments))
+	}
+
+	for index, td := range testData {
+		a := e.Attachments[index-1]
+		data, _ := ioutil.ReadAll(a.Data)
+
+		if a.Filename != "hello.txt" {
+			t.Errorf("[Test Case %v] Wrong filename: %s", index, a.Filename)
+		}
+		if a.ContentType != td.contentType {
+			t.Errorf("[Test Case %v] Wrong content type. Expected: %s, Got: %s", index, td.contentType, a.ContentType)
+		}
+		if string(data) != "Hello, Mac! aaaaaaaaaa \x90 end\n" {
+			t.Errorf("[Test Case %v] Wrong data fork: %q", index, data)
+		}
+
+		if a.AppleFile == nil {
+			t.Errorf("[Test Case %v] Missing apple file info", index)
+			continue
+		}
+		if a.AppleFile.Type != "TEXT" || a.AppleFile.Creator != "ttxt" || a.AppleFile.FinderFlags != 0x0100 {
+			t.Errorf("[Test Case %v] Wrong finder info: %+v", index, a.AppleFile)
+		}
+		if string(a.AppleFile.ResourceFork) != td.resourceFork {
+			t.Errorf("[Test Case %v] Wrong resource fork: %q", index, a.AppleFile.ResourceFork)
+		}
+	}
+}
+
+func TestDecodeAppleFileName(t *testing.T) {
+	var testData = map[int]struct {
+		name     string
+		expected string
+	}{
+		1: {"hello.txt", "hello.txt"},
+		2: {"R\x8esum\x8e.txt", "Résumé.txt"},
+		3: {"\xa5 Na\x95ve \x80\xe7\xc4.txt", "• Naïve ÄÁƒ.txt"},
+	}
+
+	for index, td := range testData {
+		b := make([]byte, appleFileHeaderSize+2*appleFileEntrySize)
+		binary.BigEndian.PutUint32(b, appleSingleMagic)
+		binary.BigEndian.PutUint16(b[24:], 2)
+		for i, entry := range []struct {
+			id   uint32
+			data string
+		}{{appleEntryRealName, td.name}, {appleEntryDataFork, "data"}} {
+			pos := appleFileHeaderSize + i*appleFileEntrySize
+			binary.BigEndian.PutUint32(b[pos:], entry.id)
+			binary.BigEndian.PutUint32(b[pos+4:], uint32(len(b)))
+			binary.BigEndian.PutUint32(b[pos+8:], uint32(len(entry.data)))
+			b = append(b, entry.data...)
+		}
+
+		_, name, data, err := decodeAppleFile(b)
+		if err != nil {
+			t.Errorf("[Test Case %v] %v", index, err)
+			continue
+		}
+		if name != td.expected {
+			t.Errorf("[Test Case %v] Wrong name. Expected: %q, Got: %q", index, td.expected, name)
+		}
+		if string(data) != "data" {
+			t.Errorf("[Test Case %v] Wrong data fork: %q", index, data)
+		}
+	}
+}
@@ -0,0 +1,217 @@
+package parsemail
+
+import (
+	"fmt"
+	"io"
+	"mime"
+	"net/mail"
+	"net/textproto"
+	"strings"
+	"time"
+)
+
+// MessageBuilder composes a new Email. Methods can be chained, the first error encountered
+// (e.g. an unparsable address) is reported by Build.
+type MessageBuilder struct {
+	email Email
+	err   error
+}
+
+// NewMessage starts composing a new email
+func NewMessage() *MessageBuilder {
+	return &MessageBuilder{
+		email: Email{
+			Header: mail.Header{},
+		},
+	}
+}
+
+// From adds the authors of the message, each argument may be a single address or an address list
+func (b *MessageBuilder) From(addresses ...string) *MessageBuilder {
+	b.email.From = append(b.email.From, b.parseAddresses(addresses)...)
+	return b
+}
+
+// Sender sets the mailbox of the agent responsible for the actual transmission
+func (b *MessageBuilder) Sender(address string) *MessageBuilder {
+	if a := b.parseAddresses([]string{address}); len(a) > 0 {
+		b.email.Sender = a[0]
+	}
+	return b
+}
+
+// ReplyTo adds addresses replies should be sent to
+func (b *MessageBuilder) ReplyTo(addresses ...string) *MessageBuilder {
+	b.email.ReplyTo = append(b.email.ReplyTo, b.parseAddresses(addresses)...)
+	return b
+}
+
+// To adds primary recipients
+func (b *MessageBuilder) To(addresses ...string) *MessageBuilder {
+	b.email.To = append(b.email.To, b.parseAddresses(addresses)...)
+	return b
+}
+
+// Cc adds carbon copy recipients
+func (b *MessageBuilder) Cc(addresses ...string) *MessageBuilder {
+	b.email.Cc = append(b.email.Cc, b.parseAddresses(addresses)...)
+	return b
+}
+
+// Bcc adds blind carbon copy recipients
+func (b *MessageBuilder) Bcc(addresses ...string) *MessageBuilder {
+	b.email.Bcc = append(b.email.Bcc, b.parseAddresses(addresses)...)
+	return b
+}
+
+// Subject sets the subject, non-ASCII characters are encoded when the message is written
+func (b *MessageBuilder) Subject(subject string) *MessageBuilder {
+	b.email.Subject = subject
+	return b
+}
+
+// Date sets the origination date, defaults to the time Build is called
+func (b *MessageBuilder) Date(date time.Time) *MessageBuilder {
+	b.email.Date = date
+	return b
+}
+
+// MessageID sets the message identifier (without angle brackets), one is generated if not set
+func (b *MessageBuilder) MessageID(id string) *MessageBuilder {
+	b.email.MessageID = strings.Trim(id, "<> ")
+	return b
+}
+
+// InReplyTo adds identifiers of the messages this one replies to
+func (b *MessageBuilder) InReplyTo(ids ...string) *MessageBuilder {
+	for _, id := range ids {
+		b.email.InReplyTo = append(b.email.InReplyTo, strings.Trim(id, "<> "))
+	}
+	return b
+}
+
+// References adds identifiers of the messages in the thread this one belongs to
+func (b *MessageBuilder) References(ids ...string) *MessageBuilder {
+	for _, id := range ids {
+		b.email.References = append(b.email.References, strings.Trim(id, "<> "))
+	}
+	return b
+}
+
+// Header adds an extra header field
+func (b *MessageBuilder) Header(name, value string) *MessageBuilder {
+	name = textproto.CanonicalMIMEHeaderKey(name)
+	b.email.Header[name] = append(b.email.Header[name], value)
+	return b
+}
+
+// Text sets the text/plain body
+func (b *MessageBuilder) Text(text string) *MessageBuilder {
+	b.email.TextBody = text
+	b.email.TextBodies = nil
+	return b
+}
+
+// FlowedText sets the text/plain body, encoded as format=flowed text so that clients can rewrap its paragraphs
+func (b *MessageBuilder) FlowedText(text string) *MessageBuilder {
+	b.email.TextBody = EncodeFlowed(text, FlowedLineLength)
+	b.email.TextBodies = []*TextBody{{
+		Body{
+			ContentType: contentTypeTextPlain,
+			Params:      map[string]string{"charset": "utf-8", "format": "flowed"},
+			Data:        strings.NewReader(b.email.TextBody),
+		},
+	}}
+	return b
+}
+
+// HTML sets the text/html body
+func (b *MessageBuilder) HTML(html string) *MessageBuilder {
+	b.email.HTMLBody = html
+	return b
+}
+
+// Calendar adds an iCalendar object as a text/calendar alternative of the bodies, as used by meeting invitations
+// and replies; method is the iTIP method of the object, e.g. "REQUEST" or "REPLY"
+func (b *MessageBuilder) Calendar(method string, ical string) *MessageBuilder {
+	b.email.EmbeddedFiles = append(b.email.EmbeddedFiles, EmbeddedFile{
+		ContentType: mime.FormatMediaType(contentTypeTextCalendar, map[string]string{"charset": "utf-8", "method": method}),
+		Data:        strings.NewReader(ical),
+	})
+	return b
+}
+
+// Attach adds an attachment
+func (b *MessageBuilder) Attach(filename, contentType string, data io.Reader) *MessageBuilder {
+	b.email.Attachments = append(b.email.Attachments, Attachment{
+		Filename:    filename,
+		ContentType: contentType,
+		Data:        data,
+	})
+	return b
+}
+
+// Embed adds an inline file referenced from the HTML body as cid:<cid>
+func (b *MessageBuilder) Embed(cid, contentType string, data io.Reader) *MessageBuilder {
+	b.email.EmbeddedFiles = append(b.email.EmbeddedFiles, EmbeddedFile{
+		CID:         strings.Trim(cid, "<>"),
+		ContentType: contentType,
+		Data:        data,
+	})
+	return b
+}
+
+// Build returns the composed email, generating the Date and Message-ID if they were not set
+func (b *MessageBuilder) Build() (Email, error) {
+	if b.err != nil {
+		return Email{}, b.err
+	}
+
+	if len(b.email.From) == 0 {
+		return Email{}, fmt.Errorf("message has no From address")
+	}
+
+	email := b.email
+	if email.Date.IsZero() {
+		email.Date = time.Now()
+	}
+	if email.MessageID == "" {
+		email.MessageID = generateMessageID(email.From[0].Address)
+	}
+
+	return email, nil
+}
+
+// WriteTo builds the email and writes it to w
+func (b *MessageBuilder) WriteTo(w io.Writer) (int64, error) {
+	email, err := b.Build()
+	if err != nil {
+		return 0, err
+	}
+
+	return email.WriteTo(w)
+}
+
+func (b *MessageBuilder) parseAddresses(addresses []string) (result []*mail.Address) {
+	for _, a := range addresses {
+		if b.err != nil {
+			return
+		}
+
+		var al []*mail.Address
+		al, b.err = mail.ParseAddressList(a)
+		result = append(result, al...)
+	}
+
+	return
+}
+
+// generateMessageID returns a unique message identifier in the domain of the given address
+func generateMessageID(address string) string {
+	domain := "localhost"
+	if i := strings.LastIndex(address, "@"); i >= 0 && i < len(address)-1 {
+		domain = address[i+1:]
+	}
+
+	return fmt.Sprintf("%d.%s@%s", time.Now().UnixNano(), randomBoundary()[:16], domain)
+}
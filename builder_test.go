@@ -0,0 +1,99 @@
+package parsemail
+
+import (
+	"bytes"
+	"io/ioutil"
+	"mime"
+	"net/mail"
+	"strings"
+	"testing"
+)
+
+func TestMessageBuilder(t *testing.T) {
+	buf := new(bytes.Buffer)
+	_, err := NewMessage().
+		From("John Doe <jdoe@machine.example>").
+		To("Mary Smith <mary@example.net>", "jdoe@example.org, Who? <one@y.test>").
+		Cc("boss@nil.test").
+		Subject("Hello, Mary").
+		Header("X-Mailer", "parsemail").
+		Text("Hello there.").
+		HTML(`<p>Hello there.</p><img src="cid:logo">`).
+		Embed("logo", "image/gif", strings.NewReader("GIF89a")).
+		Attach("notes.txt", "text/plain", strings.NewReader("some notes")).
+		WriteTo(buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	msg, err := mail.ReadMessage(bytes.NewReader(buf.Bytes()))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	mediaType, params, err := mime.ParseMediaType(msg.Header.Get("Content-Type"))
+	if err != nil || mediaType != contentTypeMultipartMixed {
+		t.Errorf("Wrong top level content type. Expected: %s, Got: %s", contentTypeMultipartMixed, mediaType)
+	}
+
+	body, _ := ioutil.ReadAll(msg.Body)
+	for _, nested := range []string{contentTypeMultipartRelated, contentTypeMultipartAlternative} {
+		if !strings.Contains(string(body), "Content-Type: "+nested) {
+			t.Errorf("Missing nested %s part", nested)
+		}
+	}
+	if !strings.HasPrefix(string(body), "--"+params["boundary"]) {
+		t.Errorf("Body doesn't start with the boundary: %q", body)
+	}
+
+	e, err := Parse(bytes.NewReader(buf.Bytes()))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if e.Subject != "Hello, Mary" {
+		t.Errorf("Wrong subject. Got: %s", e.Subject)
+	}
+
+	if e.MessageID == "" || !strings.HasSuffix(e.MessageID, "@machine.example") {
+		t.Errorf("Wrong generated message id. Got: %s", e.MessageID)
+	}
+
+	if e.Date.IsZero() {
+		t.Errorf("Date was not generated")
+	}
+
+	if len(e.To) != 3 || e.To[2].Address != "one@y.test" {
+		t.Errorf("Wrong to. Got: %v", e.To)
+	}
+
+	if e.Header.Get("X-Mailer") != "parsemail" {
+		t.Errorf("Wrong extra header. Got: %s", e.Header.Get("X-Mailer"))
+	}
+
+	if e.TextBody != "Hello there." {
+		t.Errorf("Wrong text body. Got: %s", e.TextBody)
+	}
+
+	if e.HTMLBody != `<p>Hello there.</p><img src="cid:logo">` {
+		t.Errorf("Wrong html body. Got: %s", e.HTMLBody)
+	}
+
+	if len(e.EmbeddedFiles) != 1 || e.EmbeddedFiles[0].CID != "logo" {
+		t.Errorf("Wrong embedded files. Got: %v", e.EmbeddedFiles)
+	}
+
+	if len(e.Attachments) != 1 || e.Attachments[0].Filename != "notes.txt" {
+		t.Errorf("Wrong attachments. Got: %v", e.Attachments)
+	}
+}
+
+func TestMessageBuilderErrors(t *testing.T) {
+	if _, err := NewMessage().To("mary@example.net").Build(); err == nil {
+		t.Errorf("Expected error for message without From")
+	}
+
+	if _, err := NewMessage().From("not an address").Build(); err == nil {
+		t.Errorf("Expected error for invalid address")
+	}
+}
@@ -0,0 +1,550 @@
+package parsemail
+
+import (
+	"fmt"
+	"net/mail"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// iCalendar (RFC 5545) objects of text/calendar parts, as used by meeting invitations (RFC 5546)
+
+const (
+	calendarDateTimeFormat      = "20060102T150405"
+	calendarDateTimeFormatUTC   = "20060102T150405Z"
+	calendarDateFormat          = "20060102"
+	calendarOffsetFormat        = "-0700"
+	calendarOffsetSecondsFormat = "-070000"
+)
+
+// Calendar is an iCalendar object
+type Calendar struct {
+	// Method is the iTIP method, e.g. "REQUEST", "REPLY" or "CANCEL"
+	Method string
+	ProdID string
+	Events []*CalendarEvent
+}
+
+// CalendarEvent is a VEVENT component. Start and End are resolved in the time zone given by their TZID,
+// dates and floating times are in time.Local.
+type CalendarEvent struct {
+	UID         string
+	Sequence    int
+	Summary     string
+	Description string
+	Location    string
+	Status      string
+	Start       time.Time
+	End         time.Time
+	// AllDay is set when the event starts on a date rather than a date and time
+	AllDay bool
+	// Floating is set when the event starts at a floating time, a local time which isn't bound to a time zone and
+	// occurs at that wall clock time wherever the attendee is. Start and End then hold it in time.Local.
+	Floating bool
+	// RRule is the recurrence rule of the event, e.g. "FREQ=WEEKLY;BYDAY=MO"
+	RRule string
+	// RecurrenceID identifies the occurrence of a recurring event this event overrides
+	RecurrenceID time.Time
+	// RecurrenceIDAllDay is set when RecurrenceID is a date, as for the occurrences of all day events
+	RecurrenceIDAllDay bool
+	Organizer          *mail.Address
+	Attendees          []*CalendarAttendee
+}
+
+// CalendarAttendee is an ATTENDEE of an event
+type CalendarAttendee struct {
+	Address *mail.Address
+	// PartStat is the participation status, e.g. "NEEDS-ACTION", "ACCEPTED", "DECLINED" or "TENTATIVE"
+	PartStat string
+	Role     string
+	RSVP     bool
+}
+
+// calendarProperty is a content line: NAME;PARAM=VALUE:value
+type calendarProperty struct {
+	name   string
+	params map[string]string
+	value  string
+}
+
+// calendarComponent is a BEGIN:NAME ... END:NAME block
+type calendarComponent struct {
+	name       string
+	properties []calendarProperty
+	components []*calendarComponent
+}
+
+func (c *calendarComponent) property(name string) *calendarProperty {
+	for i := range c.properties {
+		if c.properties[i].name == name {
+			return &c.properties[i]
+		}
+	}
+
+	return nil
+}
+
+func (c *calendarComponent) value(name string) string {
+	if p := c.property(name); p != nil {
+		return p.value
+	}
+
+	return ""
+}
+
+// ParseCalendar parses an iCalendar object. A malformed date, time or duration of an event is ignored rather than
+// rejecting the whole calendar, and times in a time zone the calendar doesn't define are taken as floating times.
+func ParseCalendar(data []byte) (*Calendar, error) {
+	root, err := parseCalendarComponents(data)
+	if err != nil {
+		return nil, err
+	}
+
+	cal := &Calendar{
+		Method: strings.ToUpper(unescapeCalendarText(root.value("METHOD"))),
+		ProdID: unescapeCalendarText(root.value("PRODID")),
+	}
+
+	zones := map[string]*calendarComponent{}
+	for _, c := range root.components {
+		if c.name == "VTIMEZONE" {
+			zones[c.value("TZID")] = c
+		}
+	}
+
+	for _, c := range root.components {
+		if c.name != "VEVENT" {
+			continue
+		}
+
+		event := &CalendarEvent{
+			UID:         c.value("UID"),
+			Summary:     unescapeCalendarText(c.value("SUMMARY")),
+			Description: unescapeCalendarText(c.value("DESCRIPTION")),
+			Location:    unescapeCalendarText(c.value("LOCATION")),
+			Status:      strings.ToUpper(c.value("STATUS")),
+			RRule:       c.value("RRULE"),
+		}
+		event.Sequence, _ = strconv.Atoi(c.value("SEQUENCE"))
+
+		if p := c.property("DTSTART"); p != nil {
+			if start, allDay, floating, err := parseCalendarTime(p, zones); err == nil {
+				event.Start, event.AllDay, event.Floating = start, allDay, floating
+			}
+		}
+		if p := c.property("RECURRENCE-ID"); p != nil {
+			if recurrenceID, allDay, _, err := parseCalendarTime(p, zones); err == nil {
+				event.RecurrenceID, event.RecurrenceIDAllDay = recurrenceID, allDay
+			}
+		}
+		if p := c.property("DTEND"); p != nil {
+			if end, _, _, err := parseCalendarTime(p, zones); err == nil {
+				event.End = end
+			}
+		}
+
+		if event.End.IsZero() && !event.Start.IsZero() {
+			if duration, err := parseCalendarDuration(c.value("DURATION")); err == nil {
+				event.End = event.Start.Add(duration)
+			} else if event.AllDay {
+				event.End = event.Start.AddDate(0, 0, 1)
+			} else {
+				event.End = event.Start
+			}
+		}
+
+		if p := c.property("ORGANIZER"); p != nil {
+			event.Organizer = calendarAddress(p)
+		}
+		for _, p := range c.properties {
+			if p.name != "ATTENDEE" {
+				continue
+			}
+			event.Attendees = append(event.Attendees, &CalendarAttendee{
+				Address:  calendarAddress(&p),
+				PartStat: strings.ToUpper(p.params["PARTSTAT"]),
+				Role:     strings.ToUpper(p.params["ROLE"]),
+				RSVP:     strings.EqualFold(p.params["RSVP"], "TRUE"),
+			})
+		}
+
+		cal.Events = append(cal.Events, event)
+	}
+
+	return cal, nil
+}
+
+// parseCalendarComponents unfolds the content lines of data and returns its VCALENDAR component
+func parseCalendarComponents(data []byte) (*calendarComponent, error) {
+	var root *calendarComponent
+	var stack []*calendarComponent
+	for _, line := range unfoldContentLines(data) {
+		p, err := parseCalendarProperty(line)
+		if err != nil {
+			return nil, err
+		}
+
+		switch p.name {
+		case "BEGIN":
+			c := &calendarComponent{name: strings.ToUpper(p.value)}
+			if len(stack) > 0 {
+				parent := stack[len(stack)-1]
+				parent.components = append(parent.components, c)
+			} else if c.name == "VCALENDAR" && root == nil {
+				root = c
+			} else {
+				return nil, fmt.Errorf("unexpected calendar component %s", c.name)
+			}
+			stack = append(stack, c)
+		case "END":
+			if len(stack) == 0 || stack[len(stack)-1].name != strings.ToUpper(p.value) {
+				return nil, fmt.Errorf("unexpected END:%s", p.value)
+			}
+			stack = stack[:len(stack)-1]
+		default:
+			if len(stack) == 0 {
+				return nil, fmt.Errorf("calendar property %s outside of a component", p.name)
+			}
+			c := stack[len(stack)-1]
+			c.properties = append(c.properties, p)
+		}
+	}
+
+	if root == nil {
+		return nil, fmt.Errorf("VCALENDAR not found")
+	}
+	if len(stack) > 0 {
+		return nil, fmt.Errorf("calendar component %s not terminated", stack[len(stack)-1].name)
+	}
+
+	return root, nil
+}
+
+// unfoldContentLines joins the folded lines of an iCalendar or vCard object and drops empty lines
+func unfoldContentLines(data []byte) (lines []string) {
+	text := strings.Replace(string(data), "\r\n", "\n", -1)
+	text = strings.Replace(text, "\n ", "", -1)
+	text = strings.Replace(text, "\n\t", "", -1)
+
+	for _, line := range strings.Split(text, "\n") {
+		line = strings.TrimRight(line, "\r")
+		if line != "" {
+			lines = append(lines, line)
+		}
+	}
+
+	return
+}
+
+// parseCalendarProperty splits a content line into its name, parameters and value, the parameter
+// values may be quoted to contain ':', ';' and ','. Repeated parameters are joined with ',' and parameters
+// without a name, as written by vCard 2.1, are treated as TYPE values.
+func parseCalendarProperty(line string) (p calendarProperty, err error) {
+	p.params = map[string]string{}
+
+	i := strings.IndexAny(line, ";:")
+	if i < 0 {
+		return p, fmt.Errorf("invalid calendar content line: %q", line)
+	}
+	p.name = strings.ToUpper(line[:i])
+
+	for line[i] == ';' {
+		line = line[i+1:]
+		eq := strings.IndexAny(line, "=;:")
+		if eq < 0 {
+			return p, fmt.Errorf("invalid calendar parameter in %s", p.name)
+		}
+		if line[eq] != '=' {
+			p.addParam("TYPE", line[:eq])
+			i = eq
+			continue
+		}
+		name := strings.ToUpper(line[:eq])
+		line = line[eq+1:]
+
+		var value strings.Builder
+		quoted := false
+		for i = 0; i < len(line); i++ {
+			c := line[i]
+			if c == '"' {
+				quoted = !quoted
+				continue
+			}
+			if !quoted && (c == ';' || c == ':') {
+				break
+			}
+			value.WriteByte(c)
+		}
+		if i >= len(line) {
+			return p, fmt.Errorf("calendar property %s without value", p.name)
+		}
+		p.addParam(name, value.String())
+	}
+
+	p.value = line[i+1:]
+
+	return p, nil
+}
+
+func (p *calendarProperty) addParam(name, value string) {
+	if existing, ok := p.params[name]; ok {
+		value = existing + "," + value
+	}
+	p.params[name] = value
+}
+
+func unescapeCalendarText(s string) string {
+	if !strings.Contains(s, `\`) {
+		return s
+	}
+
+	var out strings.Builder
+	for i := 0; i < len(s); i++ {
+		if s[i] != '\\' || i+1 >= len(s) {
+			out.WriteByte(s[i])
+			continue
+		}
+		i++
+		switch s[i] {
+		case 'n', 'N':
+			out.WriteByte('\n')
+		default:
+			out.WriteByte(s[i])
+		}
+	}
+
+	return out.String()
+}
+
+// calendarAddress reads an ORGANIZER or ATTENDEE property, whose value is a mailto: URI and whose
+// CN parameter holds the name
+func calendarAddress(p *calendarProperty) *mail.Address {
+	address := p.value
+	if len(address) >= len("mailto:") && strings.EqualFold(address[:len("mailto:")], "mailto:") {
+		address = address[len("mailto:"):]
+	}
+
+	return &mail.Address{Name: p.params["CN"], Address: address}
+}
+
+// parseCalendarTime parses a DATE or DATE-TIME value, resolving its TZID parameter in the IANA
+// time zone database or, failing that, in the VTIMEZONE components of the calendar. Floating times,
+// including those in a time zone which can't be resolved, are returned in time.Local.
+func parseCalendarTime(p *calendarProperty, zones map[string]*calendarComponent) (t time.Time, allDay, floating bool, err error) {
+	value := strings.TrimSpace(p.value)
+
+	if strings.EqualFold(p.params["VALUE"], "DATE") || len(value) == len(calendarDateFormat) {
+		t, err = time.ParseInLocation(calendarDateFormat, value, time.Local)
+		return t, true, false, err
+	}
+
+	if strings.HasSuffix(value, "Z") {
+		t, err = time.Parse(calendarDateTimeFormatUTC, value)
+		return t, false, false, err
+	}
+
+	tzid := p.params["TZID"]
+	if tzid != "" {
+		if loc, err := time.LoadLocation(tzid); err == nil {
+			t, err = time.ParseInLocation(calendarDateTimeFormat, value, loc)
+			return t, false, false, err
+		}
+	}
+
+	t, err = time.Parse(calendarDateTimeFormat, value)
+	if err != nil {
+		return t, false, false, err
+	}
+	if zone, ok := zones[tzid]; ok && tzid != "" {
+		if offset, err := calendarZoneOffset(zone, t); err == nil {
+			return time.Date(t.Year(), t.Month(), t.Day(), t.Hour(), t.Minute(), t.Second(), 0, time.FixedZone(tzid, offset)), false, false, nil
+		}
+	}
+
+	return time.Date(t.Year(), t.Month(), t.Day(), t.Hour(), t.Minute(), t.Second(), 0, time.Local), false, true, nil
+}
+
+// calendarZoneOffset returns the UTC offset in seconds of a VTIMEZONE at the local time t. The observance
+// with the latest onset before t applies, onsets are computed from the yearly BYMONTH and BYDAY
+// rules Outlook and other clients generate.
+func calendarZoneOffset(zone *calendarComponent, t time.Time) (int, error) {
+	var offset int
+	var onset time.Time
+	found := false
+
+	for _, o := range zone.components {
+		if o.name != "STANDARD" && o.name != "DAYLIGHT" {
+			continue
+		}
+
+		to, err := parseCalendarOffset(o.value("TZOFFSETTO"))
+		if err != nil {
+			return 0, err
+		}
+		start, err := time.Parse(calendarDateTimeFormat, o.value("DTSTART"))
+		if err != nil {
+			return 0, err
+		}
+
+		// the onsets in the year of t and the year before, in case t precedes this year's onset
+		for _, year := range []int{t.Year() - 1, t.Year()} {
+			s := calendarObservanceOnset(start, o.value("RRULE"), year)
+			if s.After(t) || s.Before(start) {
+				continue
+			}
+			if !found || s.After(onset) {
+				offset, onset, found = to, s, true
+			}
+		}
+	}
+
+	if !found {
+		return 0, fmt.Errorf("no observance of time zone %s applies", zone.value("TZID"))
+	}
+
+	return offset, nil
+}
+
+// calendarObservanceOnset returns the onset of an observance in year, in the local time of its DTSTART
+func calendarObservanceOnset(start time.Time, rrule string, year int) time.Time {
+	if rrule == "" {
+		return start
+	}
+
+	rule := map[string]string{}
+	for _, part := range strings.Split(rrule, ";") {
+		if kv := strings.SplitN(part, "=", 2); len(kv) == 2 {
+			rule[strings.ToUpper(kv[0])] = strings.ToUpper(kv[1])
+		}
+	}
+
+	month := start.Month()
+	if m, err := strconv.Atoi(rule["BYMONTH"]); err == nil {
+		month = time.Month(m)
+	}
+	day := time.Date(year, month, start.Day(), start.Hour(), start.Minute(), start.Second(), 0, time.UTC)
+
+	byDay := rule["BYDAY"]
+	if len(byDay) < 2 {
+		return day
+	}
+	weekday, ok := calendarWeekdays[byDay[len(byDay)-2:]]
+	if !ok {
+		return day
+	}
+	n, err := strconv.Atoi(byDay[:len(byDay)-2])
+	if err != nil || n == 0 {
+		n = 1
+	}
+
+	if n > 0 {
+		first := time.Date(year, month, 1, start.Hour(), start.Minute(), start.Second(), 0, time.UTC)
+		first = first.AddDate(0, 0, (int(weekday)-int(first.Weekday())+7)%7)
+		return first.AddDate(0, 0, 7*(n-1))
+	}
+
+	last := time.Date(year, month+1, 0, start.Hour(), start.Minute(), start.Second(), 0, time.UTC)
+	last = last.AddDate(0, 0, -((int(last.Weekday()) - int(weekday) + 7) % 7))
+
+	return last.AddDate(0, 0, 7*(n+1))
+}
+
+var calendarWeekdays = map[string]time.Weekday{
+	"SU": time.Sunday,
+	"MO": time.Monday,
+	"TU": time.Tuesday,
+	"WE": time.Wednesday,
+	"TH": time.Thursday,
+	"FR": time.Friday,
+	"SA": time.Saturday,
+}
+
+// parseCalendarOffset parses a UTC offset like +0100 or -043000 into seconds
+func parseCalendarOffset(s string) (int, error) {
+	format := calendarOffsetFormat
+	if len(s) == len(calendarOffsetSecondsFormat) {
+		format = calendarOffsetSecondsFormat
+	}
+
+	t, err := time.Parse(format, s)
+	if err != nil {
+		return 0, fmt.Errorf("invalid calendar utc offset %q", s)
+	}
+	_, offset := t.Zone()
+
+	return offset, nil
+}
+
+// parseCalendarDuration parses durations like P1D, PT1H30M or -P2W
+func parseCalendarDuration(s string) (time.Duration, error) {
+	sign := time.Duration(1)
+	switch {
+	case strings.HasPrefix(s, "-"):
+		sign, s = -1, s[1:]
+	case strings.HasPrefix(s, "+"):
+		s = s[1:]
+	}
+	if !strings.HasPrefix(s, "P") {
+		return 0, fmt.Errorf("invalid calendar duration %q", s)
+	}
+
+	var d time.Duration
+	n := 0
+	digits := false
+	for _, c := range s[1:] {
+		if c >= '0' && c <= '9' {
+			n = n*10 + int(c-'0')
+			digits = true
+			continue
+		}
+
+		unit, ok := map[rune]time.Duration{
+			'W': 7 * 24 * time.Hour,
+			'D': 24 * time.Hour,
+			'H': time.Hour,
+			'M': time.Minute,
+			'S': time.Second,
+		}[c]
+		switch {
+		case c == 'T':
+			continue
+		case !ok || !digits:
+			return 0, fmt.Errorf("invalid calendar duration %q", s)
+		}
+		d += time.Duration(n) * unit
+		n, digits = 0, false
+	}
+
+	return sign * d, nil
+}
+
+// findCalendar parses the first text/calendar part of email, the data of the part stays readable
+func findCalendar(email *Email) *Calendar {
+	var data []byte
+	if mediaType, _, err := parseContentType(email.ContentType); err == nil && mediaType == contentTypeTextCalendar {
+		data, _ = readAndReset(&email.Content)
+	}
+	for i := 0; data == nil && i < len(email.EmbeddedFiles); i++ {
+		ef := &email.EmbeddedFiles[i]
+		if mediaType, _, err := parseContentType(ef.ContentType); err == nil && mediaType == contentTypeTextCalendar {
+			data, _ = readAndReset(&ef.Data)
+		}
+	}
+	for i := 0; data == nil && i < len(email.Attachments); i++ {
+		at := &email.Attachments[i]
+		if at.ContentType == contentTypeTextCalendar {
+			data, _ = readAndReset(&at.Data)
+		}
+	}
+	if data == nil {
+		return nil
+	}
+
+	cal, err := ParseCalendar(data)
+	if err != nil {
+		return nil
+	}
+
+	return cal
+}
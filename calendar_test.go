@@ -0,0 +1,278 @@
+package parsemail
+
+import (
+	"io"
+	"strings"
+	"testing"
+	"time"
+)
+
+const outlookTimeZone = `BEGIN:VTIMEZONE
+TZID:W. Europe Standard Time
+BEGIN:STANDARD
+DTSTART:16010101T030000
+TZOFFSETFROM:+0200
+TZOFFSETTO:+0100
+RRULE:FREQ=YEARLY;INTERVAL=1;BYDAY=-1SU;BYMONTH=10
+END:STANDARD
+BEGIN:DAYLIGHT
+DTSTART:16010101T020000
+TZOFFSETFROM:+0100
+TZOFFSETTO:+0200
+RRULE:FREQ=YEARLY;INTERVAL=1;BYDAY=-1SU;BYMONTH=3
+END:DAYLIGHT
+END:VTIMEZONE
+`
+
+func TestParseCalendar(t *testing.T) {
+	var testData = map[int]struct {
+		calendar string
+
+		method    string
+		uid       string
+		summary   string
+		location  string
+		start     time.Time
+		end       time.Time
+		allDay    bool
+		floating  bool
+		rrule     string
+		organizer string
+		attendees []CalendarAttendee
+	}{
+		1: {
+			calendar: `BEGIN:VCALENDAR
+METHOD:REQUEST
+PRODID:Microsoft Exchange Server 2010
+VERSION:2.0
+` + outlookTimeZone + `BEGIN:VEVENT
+ORGANIZER;CN="Doe, John":mailto:john@example.com
+ATTENDEE;ROLE=REQ-PARTICIPANT;PARTSTAT=NEEDS-ACTION;RSVP=TRUE;CN=Jane:mailto:
+ jane@example.com
+ATTENDEE;ROLE=OPT-PARTICIPANT;PARTSTAT=ACCEPTED;CN=Bob:mailto:bob@example.com
+DESCRIPTION;LANGUAGE=en-US:Agenda:\n1. budget\, plans
+UID:040000008200E00074C5B7101A82E008
+SUMMARY;LANGUAGE=en-US:Planning
+DTSTART;TZID=W. Europe Standard Time:20190614T100000
+DTEND;TZID=W. Europe Standard Time:20190614T113000
+LOCATION;LANGUAGE=en-US:Room 1
+SEQUENCE:0
+END:VEVENT
+END:VCALENDAR
+`,
+			method:    "REQUEST",
+			uid:       "040000008200E00074C5B7101A82E008",
+			summary:   "Planning",
+			location:  "Room 1",
+			start:     time.Date(2019, 6, 14, 8, 0, 0, 0, time.UTC),
+			end:       time.Date(2019, 6, 14, 9, 30, 0, 0, time.UTC),
+			organizer: `"Doe, John" <john@example.com>`,
+			attendees: []CalendarAttendee{
+				{PartStat: "NEEDS-ACTION", Role: "REQ-PARTICIPANT", RSVP: true},
+				{PartStat: "ACCEPTED", Role: "OPT-PARTICIPANT"},
+			},
+		},
+		2: {
+			calendar: `BEGIN:VCALENDAR
+METHOD:CANCEL
+VERSION:2.0
+` + outlookTimeZone + `BEGIN:VEVENT
+UID:weekly-1
+SUMMARY:Standup
+DTSTART;TZID=W. Europe Standard Time:20190114T090000
+DURATION:PT15M
+RRULE:FREQ=WEEKLY;BYDAY=MO
+STATUS:CANCELLED
+END:VEVENT
+END:VCALENDAR
+`,
+			method:  "CANCEL",
+			uid:     "weekly-1",
+			summary: "Standup",
+			start:   time.Date(2019, 1, 14, 8, 0, 0, 0, time.UTC),
+			end:     time.Date(2019, 1, 14, 8, 15, 0, 0, time.UTC),
+			rrule:   "FREQ=WEEKLY;BYDAY=MO",
+		},
+		3: {
+			calendar: `BEGIN:VCALENDAR
+METHOD:PUBLISH
+VERSION:2.0
+BEGIN:VEVENT
+UID:utc-1
+SUMMARY:Call
+DTSTART;TZID=America/New_York:20190614T100000
+DTEND:20190614T150000Z
+END:VEVENT
+END:VCALENDAR
+`,
+			method:  "PUBLISH",
+			uid:     "utc-1",
+			summary: "Call",
+			start:   time.Date(2019, 6, 14, 14, 0, 0, 0, time.UTC),
+			end:     time.Date(2019, 6, 14, 15, 0, 0, 0, time.UTC),
+		},
+		4: {
+			calendar: `BEGIN:VCALENDAR
+METHOD:PUBLISH
+VERSION:2.0
+BEGIN:VEVENT
+UID:floating-1
+SUMMARY:Lunch
+DTSTART:20190614T120000
+DTEND:20190614T130000
+END:VEVENT
+END:VCALENDAR
+`,
+			method:   "PUBLISH",
+			uid:      "floating-1",
+			summary:  "Lunch",
+			start:    time.Date(2019, 6, 14, 12, 0, 0, 0, time.Local),
+			end:      time.Date(2019, 6, 14, 13, 0, 0, 0, time.Local),
+			floating: true,
+		},
+		5: {
+			calendar: `BEGIN:VCALENDAR
+METHOD:REQUEST
+VERSION:2.0
+BEGIN:VEVENT
+UID:unknown-zone-1
+SUMMARY:Review
+DTSTART;TZID=Customized Time Zone:20190614T100000
+DTEND;TZID=Customized Time Zone:2019-06-14 11:00
+DURATION:PT30M
+END:VEVENT
+END:VCALENDAR
+`,
+			method:   "REQUEST",
+			uid:      "unknown-zone-1",
+			summary:  "Review",
+			start:    time.Date(2019, 6, 14, 10, 0, 0, 0, time.Local),
+			end:      time.Date(2019, 6, 14, 10, 30, 0, 0, time.Local),
+			floating: true,
+		},
+	}
+
+	for index, td := range testData {
+		cal, err := ParseCalendar([]byte(strings.Replace(td.calendar, "\n", "\r\n", -1)))
+		if err != nil {
+			t.Errorf("[Test Case %v] Unexpected error: %v", index, err)
+			continue
+		}
+
+		if cal.Method != td.method {
+			t.Errorf("[Test Case %v] Wrong method. Expected: %q, Got: %q", index, td.method, cal.Method)
+		}
+		if len(cal.Events) != 1 {
+			t.Errorf("[Test Case %v] Expected one event, got %v", index, len(cal.Events))
+			continue
+		}
+		e := cal.Events[0]
+
+		if e.UID != td.uid || e.Summary != td.summary || e.Location != td.location || e.RRule != td.rrule {
+			t.Errorf("[Test Case %v] Wrong event: %+v", index, e)
+		}
+		if !e.Start.Equal(td.start) || !e.End.Equal(td.end) {
+			t.Errorf("[Test Case %v] Wrong time. Expected: %v - %v, Got: %v - %v", index, td.start, td.end, e.Start, e.End)
+		}
+		if e.AllDay != td.allDay {
+			t.Errorf("[Test Case %v] Wrong all day flag. Expected: %v, Got: %v", index, td.allDay, e.AllDay)
+		}
+		if e.Floating != td.floating {
+			t.Errorf("[Test Case %v] Wrong floating flag. Expected: %v, Got: %v", index, td.floating, e.Floating)
+		}
+
+		organizer := ""
+		if e.Organizer != nil {
+			organizer = e.Organizer.String()
+		}
+		if organizer != td.organizer {
+			t.Errorf("[Test Case %v] Wrong organizer. Expected: %q, Got: %q", index, td.organizer, organizer)
+		}
+
+		if len(e.Attendees) != len(td.attendees) {
+			t.Errorf("[Test Case %v] Wrong number of attendees. Expected: %v, Got: %v", index, len(td.attendees), len(e.Attendees))
+			continue
+		}
+		for i, a := range td.attendees {
+			got := e.Attendees[i]
+			if got.PartStat != a.PartStat || got.Role != a.Role || got.RSVP != a.RSVP {
+				t.Errorf("[Test Case %v] Wrong attendee %v. Expected: %+v, Got: %+v", index, i, a, got)
+			}
+		}
+	}
+}
+
+func TestParseCalendarDescription(t *testing.T) {
+	cal, err := ParseCalendar([]byte("BEGIN:VCALENDAR\r\nBEGIN:VEVENT\r\nDESCRIPTION:Agenda:\\n1. budget\\, plans\r\nDTSTART;VALUE=DATE:20190614\r\nEND:VEVENT\r\nEND:VCALENDAR\r\n"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	e := cal.Events[0]
+	if e.Description != "Agenda:\n1. budget, plans" {
+		t.Errorf("Wrong description: %q", e.Description)
+	}
+	if !e.AllDay || e.End.Sub(e.Start) != 24*time.Hour {
+		t.Errorf("Expected an all day event, got %v - %v", e.Start, e.End)
+	}
+}
+
+func TestParseCalendarMalformedEvent(t *testing.T) {
+	cal, err := ParseCalendar([]byte("BEGIN:VCALENDAR\r\n" +
+		"BEGIN:VEVENT\r\nUID:bad\r\nDTSTART:tomorrow\r\nDURATION:PT1H\r\nEND:VEVENT\r\n" +
+		"BEGIN:VEVENT\r\nUID:good\r\nDTSTART:20190614T100000Z\r\nDURATION:1 hour\r\nEND:VEVENT\r\n" +
+		"END:VCALENDAR\r\n"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(cal.Events) != 2 {
+		t.Fatalf("Expected two events, got %v", len(cal.Events))
+	}
+	if e := cal.Events[0]; e.UID != "bad" || !e.Start.IsZero() || !e.End.IsZero() {
+		t.Errorf("Wrong event with malformed start: %+v", e)
+	}
+	if e := cal.Events[1]; e.UID != "good" || !e.Start.Equal(time.Date(2019, 6, 14, 10, 0, 0, 0, time.UTC)) || !e.End.Equal(e.Start) {
+		t.Errorf("Wrong event with malformed duration: %+v", e)
+	}
+}
+
+func TestParseEmailCalendar(t *testing.T) {
+	mailData := `From: John <john@example.com>
+To: jane@example.com
+Subject: Invitation: Planning
+MIME-Version: 1.0
+Content-Type: multipart/alternative; boundary="b1"
+
+--b1
+Content-Type: text/plain; charset=utf-8
+
+You are invited.
+--b1
+Content-Type: text/calendar; charset=utf-8; method=REQUEST
+Content-Transfer-Encoding: base64
+
+QkVHSU46VkNBTEVOREFSDQpNRVRIT0Q6UkVRVUVTVA0KQkVHSU46VkVWRU5UDQpVSUQ6YWJjDQpE
+VFNUQVJUOjIwMTkwNjE0VDEwMDAwMFoNCkVORDpWRVZFTlQNCkVORDpWQ0FMRU5EQVINCg==
+--b1--
+`
+	e, err := Parse(strings.NewReader(mailData))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if e.Calendar == nil || e.Calendar.Method != "REQUEST" || len(e.Calendar.Events) != 1 || e.Calendar.Events[0].UID != "abc" {
+		t.Fatalf("Wrong calendar: %+v", e.Calendar)
+	}
+
+	if len(e.EmbeddedFiles) != 1 {
+		t.Fatalf("Expected the calendar part to stay an embedded file")
+	}
+	data := new(strings.Builder)
+	if _, err := io.Copy(data, e.EmbeddedFiles[0].Data); err != nil {
+		t.Fatal(err)
+	}
+	if !strings.HasPrefix(data.String(), "BEGIN:VCALENDAR") {
+		t.Errorf("Embedded calendar data wasn't preserved: %q", data.String())
+	}
+}
@@ -0,0 +1,293 @@
+package parsemail
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"strings"
+	"unicode/utf16"
+)
+
+// Compound File Binary format (MS-CFB) as used by Outlook .msg files
+
+var cfbSignature = []byte{0xD0, 0xCF, 0x11, 0xE0, 0xA1, 0xB1, 0x1A, 0xE1}
+
+const (
+	cfbHeaderSize      = 512
+	cfbDirEntrySize    = 128
+	cfbNoStream        = 0xFFFFFFFF
+	cfbEndOfChain      = 0xFFFFFFFE
+	cfbMaxRegularSect  = 0xFFFFFFFA
+	cfbTypeStorage     = 1
+	cfbTypeStream      = 2
+	cfbTypeRoot        = 5
+	cfbHeaderDIFATSize = 109
+)
+
+type cfbFile struct {
+	data           []byte
+	sectorSize     int
+	miniSectorSize int
+	miniCutoff     uint64
+	fat            []uint32
+	miniFAT        []uint32
+	miniStream     []byte
+	entries        []*cfbEntry
+}
+
+type cfbEntry struct {
+	name     string
+	typ      byte
+	left     uint32
+	right    uint32
+	child    uint32
+	start    uint32
+	size     uint64
+	children map[string]*cfbEntry
+}
+
+func openCFB(data []byte) (*cfbFile, error) {
+	if len(data) < cfbHeaderSize || !bytes.Equal(data[:8], cfbSignature) {
+		return nil, fmt.Errorf("not a compound file")
+	}
+
+	f := &cfbFile{
+		data:           data,
+		sectorSize:     1 << binary.LittleEndian.Uint16(data[0x1E:]),
+		miniSectorSize: 1 << binary.LittleEndian.Uint16(data[0x20:]),
+		miniCutoff:     uint64(binary.LittleEndian.Uint32(data[0x38:])),
+	}
+	if f.sectorSize != 512 && f.sectorSize != 4096 {
+		return nil, fmt.Errorf("invalid compound file sector size: %d", f.sectorSize)
+	}
+
+	if err := f.readFAT(); err != nil {
+		return nil, err
+	}
+
+	dir, err := f.readChain(binary.LittleEndian.Uint32(data[0x30:]), f.fat, f.sector)
+	if err != nil {
+		return nil, err
+	}
+	for i := 0; i+cfbDirEntrySize <= len(dir); i += cfbDirEntrySize {
+		e := parseCFBEntry(dir[i : i+cfbDirEntrySize])
+		if f.sectorSize == 512 {
+			// version 3 files may hold garbage in the high part of the size
+			e.size &= 0xFFFFFFFF
+		}
+		f.entries = append(f.entries, e)
+	}
+	if len(f.entries) == 0 || f.entries[0].typ != cfbTypeRoot {
+		return nil, fmt.Errorf("compound file has no root entry")
+	}
+
+	miniFATStart := binary.LittleEndian.Uint32(data[0x3C:])
+	if miniFATStart != cfbEndOfChain && miniFATStart != cfbNoStream {
+		miniFAT, err := f.readChain(miniFATStart, f.fat, f.sector)
+		if err != nil {
+			return nil, err
+		}
+		f.miniFAT = uint32s(miniFAT)
+
+		root := f.entries[0]
+		f.miniStream, err = f.readChain(root.start, f.fat, f.sector)
+		if err != nil {
+			return nil, err
+		}
+		if uint64(len(f.miniStream)) > root.size {
+			f.miniStream = f.miniStream[:root.size]
+		}
+	}
+
+	visited := map[uint32]bool{}
+	if err := f.link(f.entries[0], visited); err != nil {
+		return nil, err
+	}
+
+	return f, nil
+}
+
+func (f *cfbFile) root() *cfbEntry {
+	return f.entries[0]
+}
+
+// lookup returns the child entry with the given name, names are compared case-insensitively
+func (e *cfbEntry) lookup(name string) *cfbEntry {
+	return e.children[strings.ToUpper(name)]
+}
+
+func (f *cfbFile) readFAT() error {
+	var difat []uint32
+	for i := 0; i < cfbHeaderDIFATSize; i++ {
+		difat = append(difat, binary.LittleEndian.Uint32(f.data[0x4C+4*i:]))
+	}
+
+	next := binary.LittleEndian.Uint32(f.data[0x44:])
+	for seen := map[uint32]bool{}; next <= cfbMaxRegularSect; {
+		if seen[next] {
+			return fmt.Errorf("compound file DIFAT contains a loop")
+		}
+		seen[next] = true
+
+		sector, err := f.sector(next)
+		if err != nil {
+			return err
+		}
+		if len(sector) < f.sectorSize {
+			return fmt.Errorf("compound file DIFAT sector %d is truncated", next)
+		}
+		entries := uint32s(sector)
+		difat = append(difat, entries[:len(entries)-1]...)
+		next = entries[len(entries)-1]
+	}
+
+	for _, s := range difat {
+		if s > cfbMaxRegularSect {
+			continue
+		}
+
+		sector, err := f.sector(s)
+		if err != nil {
+			return err
+		}
+		f.fat = append(f.fat, uint32s(sector)...)
+	}
+
+	return nil
+}
+
+func (f *cfbFile) sector(n uint32) ([]byte, error) {
+	start := (int(n) + 1) * f.sectorSize
+	if n > cfbMaxRegularSect || start+f.sectorSize > len(f.data) {
+		if start < len(f.data) && n <= cfbMaxRegularSect {
+			// the last sector of the file may be truncated
+			return f.data[start:], nil
+		}
+		return nil, fmt.Errorf("compound file sector %d out of range", n)
+	}
+
+	return f.data[start : start+f.sectorSize], nil
+}
+
+func (f *cfbFile) miniSector(n uint32) ([]byte, error) {
+	start := int(n) * f.miniSectorSize
+	if start+f.miniSectorSize > len(f.miniStream) {
+		if start < len(f.miniStream) {
+			return f.miniStream[start:], nil
+		}
+		return nil, fmt.Errorf("compound file mini sector %d out of range", n)
+	}
+
+	return f.miniStream[start : start+f.miniSectorSize], nil
+}
+
+// readChain concatenates the sectors of the chain starting at start
+func (f *cfbFile) readChain(start uint32, fat []uint32, sector func(uint32) ([]byte, error)) ([]byte, error) {
+	out := new(bytes.Buffer)
+	seen := map[uint32]bool{}
+
+	for s := start; s != cfbEndOfChain; {
+		if seen[s] || int(s) >= len(fat) {
+			return nil, fmt.Errorf("compound file contains a broken sector chain")
+		}
+		seen[s] = true
+
+		data, err := sector(s)
+		if err != nil {
+			return nil, err
+		}
+		out.Write(data)
+		s = fat[s]
+	}
+
+	return out.Bytes(), nil
+}
+
+// read returns the content of a stream entry
+func (f *cfbFile) read(e *cfbEntry) ([]byte, error) {
+	if e.size == 0 {
+		return []byte{}, nil
+	}
+
+	var data []byte
+	var err error
+	if e.size < f.miniCutoff {
+		data, err = f.readChain(e.start, f.miniFAT, f.miniSector)
+	} else {
+		data, err = f.readChain(e.start, f.fat, f.sector)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	if uint64(len(data)) < e.size {
+		return nil, fmt.Errorf("compound file stream %s is truncated", e.name)
+	}
+
+	return data[:e.size], nil
+}
+
+// link fills the children of storage entries by walking their red-black trees
+func (f *cfbFile) link(e *cfbEntry, visited map[uint32]bool) error {
+	e.children = map[string]*cfbEntry{}
+
+	var walk func(id uint32) error
+	walk = func(id uint32) error {
+		if id == cfbNoStream {
+			return nil
+		}
+		if int(id) >= len(f.entries) || visited[id] {
+			return fmt.Errorf("compound file contains a broken directory tree")
+		}
+		visited[id] = true
+
+		child := f.entries[id]
+		e.children[strings.ToUpper(child.name)] = child
+		if child.typ == cfbTypeStorage {
+			if err := f.link(child, visited); err != nil {
+				return err
+			}
+		}
+
+		if err := walk(child.left); err != nil {
+			return err
+		}
+
+		return walk(child.right)
+	}
+
+	return walk(e.child)
+}
+
+func parseCFBEntry(b []byte) *cfbEntry {
+	nameLength := int(binary.LittleEndian.Uint16(b[0x40:]))
+	if nameLength > 64 {
+		nameLength = 64
+	}
+
+	var name []uint16
+	for i := 0; i+1 < nameLength; i += 2 {
+		if c := binary.LittleEndian.Uint16(b[i:]); c != 0 {
+			name = append(name, c)
+		}
+	}
+
+	return &cfbEntry{
+		name:  string(utf16.Decode(name)),
+		typ:   b[0x42],
+		left:  binary.LittleEndian.Uint32(b[0x44:]),
+		right: binary.LittleEndian.Uint32(b[0x48:]),
+		child: binary.LittleEndian.Uint32(b[0x4C:]),
+		start: binary.LittleEndian.Uint32(b[0x74:]),
+		size:  binary.LittleEndian.Uint64(b[0x78:]),
+	}
+}
+
+func uint32s(b []byte) []uint32 {
+	out := make([]uint32, len(b)/4)
+	for i := range out {
+		out[i] = binary.LittleEndian.Uint32(b[4*i:])
+	}
+
+	return out
+}
@@ -0,0 +1,243 @@
+package parsemail
+
+import (
+	"bytes"
+	"encoding/binary"
+	"testing"
+	"unicode/utf16"
+)
+
+// cfbTestNode describes a storage (with children) or a stream (with data) of a compound file built by buildCFB
+type cfbTestNode struct {
+	name     string
+	data     []byte
+	storage  bool
+	children []*cfbTestNode
+}
+
+// buildCFB lays out a version 3 compound file, streams smaller than the cutoff are stored in the mini stream
+func buildCFB(children []*cfbTestNode) []byte {
+	const sectorSize, miniSectorSize, cutoff = 512, 64, 4096
+	const free, endOfChain, fatSect = 0xFFFFFFFF, 0xFFFFFFFE, 0xFFFFFFFD
+
+	type dirEntry struct {
+		node                            *cfbTestNode
+		typ                             byte
+		left, right, child, start, size uint32
+	}
+
+	entries := []*dirEntry{{node: &cfbTestNode{name: "Root Entry", children: children}, typ: cfbTypeRoot, left: free, right: free, child: free}}
+	var add func(parent *dirEntry)
+	add = func(parent *dirEntry) {
+		var prev *dirEntry
+		for _, n := range parent.node.children {
+			e := &dirEntry{node: n, typ: cfbTypeStream, left: free, right: free, child: free, size: uint32(len(n.data))}
+			if n.storage {
+				e.typ, e.size = cfbTypeStorage, 0
+			}
+			entries = append(entries, e)
+			id := uint32(len(entries) - 1)
+			if prev == nil {
+				parent.child = id
+			} else {
+				prev.right = id
+			}
+			prev = e
+			if n.storage {
+				add(e)
+			}
+		}
+	}
+	add(entries[0])
+
+	// mini stream
+	var miniStream []byte
+	var miniFAT []uint32
+	for _, e := range entries[1:] {
+		if e.typ != cfbTypeStream || e.size >= cutoff || e.size == 0 {
+			continue
+		}
+		e.start = uint32(len(miniFAT))
+		sectors := (len(e.node.data) + miniSectorSize - 1) / miniSectorSize
+		for i := 0; i < sectors; i++ {
+			miniFAT = append(miniFAT, uint32(len(miniFAT)+1))
+		}
+		miniFAT[len(miniFAT)-1] = endOfChain
+		padded := make([]byte, sectors*miniSectorSize)
+		copy(padded, e.node.data)
+		miniStream = append(miniStream, padded...)
+	}
+
+	// regular sectors: directory, mini FAT, mini stream, big streams, FAT
+	var sectors [][]byte
+	var fat []uint32
+	allocate := func(data []byte) uint32 {
+		if len(data) == 0 {
+			return endOfChain
+		}
+		start := uint32(len(sectors))
+		for i := 0; i < len(data); i += sectorSize {
+			sector := make([]byte, sectorSize)
+			copy(sector, data[i:])
+			sectors = append(sectors, sector)
+			fat = append(fat, uint32(len(sectors)))
+		}
+		fat[len(fat)-1] = endOfChain
+		return start
+	}
+
+	dirSize := len(entries) * cfbDirEntrySize
+	dirSize = (dirSize + sectorSize - 1) / sectorSize * sectorSize
+	dirStart := allocate(make([]byte, dirSize))
+
+	miniFATBytes := make([]byte, 4*len(miniFAT))
+	for i, v := range miniFAT {
+		binary.LittleEndian.PutUint32(miniFATBytes[4*i:], v)
+	}
+	miniFATStart := allocate(miniFATBytes)
+	entries[0].start = allocate(miniStream)
+	entries[0].size = uint32(len(miniStream))
+
+	for _, e := range entries[1:] {
+		if e.typ == cfbTypeStream && e.size >= cutoff {
+			e.start = allocate(e.node.data)
+		}
+	}
+
+	fatSectors := 0
+	for (len(sectors)+fatSectors)*4 > fatSectors*sectorSize {
+		fatSectors++
+	}
+	var difat []uint32
+	for i := 0; i < fatSectors; i++ {
+		difat = append(difat, uint32(len(sectors)))
+		sectors = append(sectors, make([]byte, sectorSize))
+		fat = append(fat, fatSect)
+	}
+	for len(fat) < fatSectors*sectorSize/4 {
+		fat = append(fat, free)
+	}
+	for i, v := range fat {
+		binary.LittleEndian.PutUint32(sectors[difat[i/(sectorSize/4)]][4*(i%(sectorSize/4)):], v)
+	}
+
+	for i, e := range entries {
+		b := sectors[int(dirStart)+i*cfbDirEntrySize/sectorSize][i*cfbDirEntrySize%sectorSize:]
+		name := utf16.Encode([]rune(e.node.name))
+		for j, c := range name {
+			binary.LittleEndian.PutUint16(b[2*j:], c)
+		}
+		binary.LittleEndian.PutUint16(b[0x40:], uint16(2*len(name)+2))
+		b[0x42] = e.typ
+		b[0x43] = 1
+		binary.LittleEndian.PutUint32(b[0x44:], e.left)
+		binary.LittleEndian.PutUint32(b[0x48:], e.right)
+		binary.LittleEndian.PutUint32(b[0x4C:], e.child)
+		binary.LittleEndian.PutUint32(b[0x74:], e.start)
+		binary.LittleEndian.PutUint32(b[0x78:], e.size)
+	}
+	for i := len(entries); i < dirSize/cfbDirEntrySize; i++ {
+		b := sectors[int(dirStart)+i*cfbDirEntrySize/sectorSize][i*cfbDirEntrySize%sectorSize:]
+		binary.LittleEndian.PutUint32(b[0x44:], free)
+		binary.LittleEndian.PutUint32(b[0x48:], free)
+		binary.LittleEndian.PutUint32(b[0x4C:], free)
+	}
+
+	header := make([]byte, cfbHeaderSize)
+	copy(header, cfbSignature)
+	binary.LittleEndian.PutUint16(header[0x18:], 0x3E)
+	binary.LittleEndian.PutUint16(header[0x1A:], 3)
+	binary.LittleEndian.PutUint16(header[0x1C:], 0xFFFE)
+	binary.LittleEndian.PutUint16(header[0x1E:], 9)
+	binary.LittleEndian.PutUint16(header[0x20:], 6)
+	binary.LittleEndian.PutUint32(header[0x2C:], uint32(fatSectors))
+	binary.LittleEndian.PutUint32(header[0x30:], dirStart)
+	binary.LittleEndian.PutUint32(header[0x38:], cutoff)
+	binary.LittleEndian.PutUint32(header[0x3C:], miniFATStart)
+	binary.LittleEndian.PutUint32(header[0x40:], uint32((len(miniFATBytes)+sectorSize-1)/sectorSize))
+	binary.LittleEndian.PutUint32(header[0x44:], endOfChain)
+	for i := 0; i < cfbHeaderDIFATSize; i++ {
+		v := uint32(free)
+		if i < len(difat) {
+			v = difat[i]
+		}
+		binary.LittleEndian.PutUint32(header[0x4C+4*i:], v)
+	}
+
+	return append(header, bytes.Join(sectors, nil)...)
+}
+
+func TestOpenCFB(t *testing.T) {
+	small := []byte("small stream in the mini stream")
+	big := bytes.Repeat([]byte("0123456789"), 1000)
+
+	data := buildCFB([]*cfbTestNode{
+		{name: "small", data: small},
+		{name: "Storage", storage: true, children: []*cfbTestNode{
+			{name: "big", data: big},
+			{name: "empty", data: []byte{}},
+		}},
+	})
+
+	f, err := openCFB(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var testData = map[int]struct {
+		path     []string
+		expected []byte
+	}{
+		1: {[]string{"small"}, small},
+		2: {[]string{"storage", "BIG"}, big},
+		3: {[]string{"Storage", "empty"}, []byte{}},
+	}
+
+	for index, td := range testData {
+		e := f.root()
+		for _, name := range td.path {
+			if e = e.lookup(name); e == nil {
+				break
+			}
+		}
+
+		if e == nil {
+			t.Errorf("[Test Case %v] Entry not found: %v", index, td.path)
+			continue
+		}
+
+		got, err := f.read(e)
+		if err != nil {
+			t.Errorf("[Test Case %v] %v", index, err)
+		} else if !bytes.Equal(got, td.expected) {
+			t.Errorf("[Test Case %v] Wrong stream content. Expected %v bytes, Got %v bytes", index, len(td.expected), len(got))
+		}
+	}
+
+	if _, err := openCFB([]byte("not a compound file")); err == nil {
+		t.Errorf("Expected error for invalid data")
+	}
+}
+
+func TestOpenCFBTruncated(t *testing.T) {
+	data := buildCFB([]*cfbTestNode{{name: "small", data: []byte("small")}})
+	last := (len(data) - cfbHeaderSize) / 512
+
+	var testData = map[int]struct {
+		difatStart uint32
+		length     int
+	}{
+		1: {uint32(last), len(data) + 3},
+		2: {uint32(last), len(data) + 100},
+		3: {uint32(last + 5), len(data)},
+	}
+
+	for index, td := range testData {
+		truncated := append(append([]byte{}, data...), make([]byte, 512)...)[:td.length]
+		binary.LittleEndian.PutUint32(truncated[0x44:], td.difatStart)
+
+		if _, err := openCFB(truncated); err == nil {
+			t.Errorf("[Test Case %v] Expected error for truncated DIFAT sector", index)
+		}
+	}
+}
@@ -0,0 +1,50 @@
+package parsemail
+
+import "testing"
+
+func TestDecodeCharset(t *testing.T) {
+	var testData = map[int]struct {
+		data     string
+		charset  string
+		expected string
+		unknown  bool
+	}{
+		1:  {"caf\xe9", "ISO-8859-1", "café", false},
+		2:  {"\xcf\xf0\xe8\xe2\xe5\xf2", "windows-1251", "Привет", false},
+		3:  {"\xcf\xf0\xe8\xe2\xe5\xf2", "cp1251", "Привет", false},
+		4:  {"\xf0\xd2\xc9\xd7\xc5\xd4", "koi8-r", "Привет", false},
+		5:  {"\xbeluou\xe8k\xfd", "iso8859_2", "žluoučký", false},
+		6:  {"\xa4 5", "iso-8859-15", "€ 5", false},
+		7:  {"\x80 \x81", "windows-1252", "€ \u0081", false},
+		8:  {"Caf\x8e", "macintosh", "Café", false},
+		9:  {"čaj", "UTF-8", "čaj", false},
+		10: {"\xa4", "x-unknown", "\xa4", true},
+	}
+
+	for index, td := range testData {
+		s, ok := decodeCharset([]byte(td.data), td.charset)
+		if s != td.expected {
+			t.Errorf("[Test Case %v] Wrong text. Expected: %q, Got: %q", index, td.expected, s)
+		}
+		if ok == td.unknown {
+			t.Errorf("[Test Case %v] Wrong result for charset %s: %v", index, td.charset, ok)
+		}
+	}
+}
+
+func TestCodePageCharset(t *testing.T) {
+	var testData = map[int]string{
+		1251:  "windows-1251",
+		28592: "iso-8859-2",
+		28605: "iso-8859-15",
+		10000: "macintosh",
+		65001: "utf-8",
+		932:   "",
+	}
+
+	for codePage, expected := range testData {
+		if charset := codePageCharset(codePage); charset != expected {
+			t.Errorf("[Test Case %v] Wrong charset. Expected: %q, Got: %q", codePage, expected, charset)
+		}
+	}
+}
@@ -0,0 +1,58 @@
+package parsemail
+
+import (
+	"io"
+	"mime"
+	"mime/multipart"
+)
+
+// parseMultipartDigest parses the messages of a multipart/digest body, whose parts default to
+// message/rfc822 instead of text/plain (RFC 2046 section 5.1.5). Parts of other types are returned as attachments.
+func parseMultipartDigest(msg io.Reader, boundary string) (messages []*Email, attachments []Attachment, err error) {
+	mr := multipart.NewReader(msg, boundary)
+	for {
+		p, err := mr.NextPart()
+		if err == io.EOF {
+			break
+		} else if err != nil {
+			return messages, attachments, err
+		}
+
+		contentType := p.Header.Get("Content-Type")
+		if contentType == "" {
+			contentType = contentTypeMessageRFC822
+			p.Header.Set("Content-Type", contentType)
+		}
+
+		mediaType, _, err := mime.ParseMediaType(contentType)
+		if err != nil {
+			return messages, attachments, err
+		}
+
+		if mediaType == contentTypeMessageRFC822 {
+			decoded, err := decodeContent(p, p.Header.Get("Content-Transfer-Encoding"))
+			if err != nil {
+				return messages, attachments, err
+			}
+
+			email, err := Parse(decoded)
+			if err != nil {
+				return messages, attachments, err
+			}
+			messages = append(messages, &email)
+			continue
+		}
+
+		part, err := newPart(p)
+		if err != nil {
+			return messages, attachments, err
+		}
+		at, err := decodeAttachment(part)
+		if err != nil {
+			return messages, attachments, err
+		}
+		attachments = append(attachments, at)
+	}
+
+	return messages, attachments, nil
+}
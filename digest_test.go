@@ -0,0 +1,120 @@
+package parsemail
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+)
+
+const digestExample = `From: list-request@example.com
+To: list@example.com
+Subject: List digest, Vol 1, Issue 2
+MIME-Version: 1.0
+Content-Type: multipart/mixed; boundary="outer"
+
+--outer
+Content-Type: text/plain
+
+Today's topics
+--outer
+Content-Type: multipart/digest; boundary="digest"
+
+--digest
+
+From: Mary Smith <mary@x.test>
+Subject: First topic
+Message-ID: <first@x.test>
+
+First message.
+--digest
+Content-Type: message/rfc822
+
+From: John Doe <jdoe@machine.example>
+Subject: Re: First topic
+Message-ID: <second@machine.example>
+In-Reply-To: <first@x.test>
+
+Second message.
+--digest--
+--outer--
+`
+
+func TestParseMultipartDigest(t *testing.T) {
+	var testData = map[int]struct {
+		mailData    string
+		textBody    string
+		subjects    []string
+		bodies      []string
+		attachments int
+	}{
+		1: {
+			mailData: digestExample,
+			textBody: "Today's topics",
+			subjects: []string{"First topic", "Re: First topic"},
+			bodies:   []string{"First message.", "Second message."},
+		},
+		2: {
+			mailData: "Subject: Digest only\nContent-Type: multipart/digest; boundary=d\n\n--d\n\nSubject: Only\n\nBody\n--d--\n",
+			subjects: []string{"Only"},
+			bodies:   []string{"Body"},
+		},
+		3: {
+			mailData:    "Subject: Digest only\nContent-Type: multipart/digest; boundary=d\n\n--d\n\nSubject: Only\n\nBody\n--d\nContent-Type: text/plain\n\nNot a message\n--d--\n",
+			subjects:    []string{"Only"},
+			bodies:      []string{"Body"},
+			attachments: 1,
+		},
+	}
+
+	for index, td := range testData {
+		e, err := Parse(strings.NewReader(td.mailData))
+		if err != nil {
+			t.Errorf("[Test Case %v] %v", index, err)
+			continue
+		}
+
+		if e.TextBody != td.textBody {
+			t.Errorf("[Test Case %v] Wrong text body. Expected: %q, Got: %q", index, td.textBody, e.TextBody)
+		}
+
+		if len(e.Attachments) != td.attachments {
+			t.Errorf("[Test Case %v] Wrong number of attachments. Expected: %v, Got: %v", index, td.attachments, len(e.Attachments))
+		}
+
+		if len(e.Digest) != len(td.subjects) {
+			t.Errorf("[Test Case %v] Wrong number of digest messages. Expected: %v, Got: %v", index, len(td.subjects), len(e.Digest))
+			continue
+		}
+
+		for i, m := range e.Digest {
+			if m.Subject != td.subjects[i] {
+				t.Errorf("[Test Case %v] Wrong subject. Expected: %s, Got: %s", index, td.subjects[i], m.Subject)
+			}
+			if m.TextBody != td.bodies[i] {
+				t.Errorf("[Test Case %v] Wrong body. Expected: %q, Got: %q", index, td.bodies[i], m.TextBody)
+			}
+		}
+
+		buf := new(bytes.Buffer)
+		if _, err := e.WriteTo(buf); err != nil {
+			t.Errorf("[Test Case %v] %v", index, err)
+		} else if td.attachments == 0 && buf.String() != td.mailData {
+			t.Errorf("[Test Case %v] Unmodified digest not preserved:\n%s", index, buf.String())
+		}
+
+		e.Subject = "Changed"
+		buf.Reset()
+		if _, err := e.WriteTo(buf); err != nil {
+			t.Errorf("[Test Case %v] %v", index, err)
+			continue
+		}
+		written, err := Parse(buf)
+		if err != nil {
+			t.Errorf("[Test Case %v] %v", index, err)
+			continue
+		}
+		if len(written.Digest) != len(td.subjects) || written.Digest[0].Subject != td.subjects[0] {
+			t.Errorf("[Test Case %v] Digest not written", index)
+		}
+	}
+}
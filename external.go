@@ -0,0 +1,141 @@
+package parsemail
+
+import (
+	"io"
+	"io/ioutil"
+	"mime"
+	"net/mail"
+	"net/textproto"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const contentTypeMessageExternalBody = "message/external-body"
+
+// ExternalBody describes a message/external-body part (RFC 2046 section 5.2.3, RFC 2017), whose content
+// is stored elsewhere. Nothing is fetched, the fields only tell where the content can be found.
+type ExternalBody struct {
+	// AccessType is the lowercased access-type parameter, e.g. "url", "anon-ftp", "ftp", "tftp",
+	// "local-file" or "mail-server"
+	AccessType string
+	// URL of the url access type, with the whitespace allowed by RFC 2017 removed
+	URL string
+	// Name, Site, Directory and Mode locate the file for the ftp, tftp, anon-ftp and local-file access types
+	Name      string
+	Site      string
+	Directory string
+	Mode      string
+	// Server and Subject address the mail-server access type, Body holds the commands sent to it
+	Server  string
+	Subject string
+	Body    string
+
+	Expiration time.Time
+	Size       int64
+	Permission string
+	// Params holds all the parameters of the Content-Type header
+	Params map[string]string
+
+	// Header holds the phantom header describing the external content
+	Header      mail.Header
+	ContentType string
+	ContentID   string
+}
+
+// parseExternalBody reads the phantom header and body of a message/external-body part
+func parseExternalBody(content io.Reader, params map[string]string) (eb ExternalBody, err error) {
+	data, err := ioutil.ReadAll(content)
+	if err != nil {
+		return
+	}
+
+	eb.Params = params
+	eb.AccessType = strings.ToLower(params["access-type"])
+	eb.URL = strings.Join(strings.Fields(params["url"]), "")
+	eb.Name = params["name"]
+	eb.Site = params["site"]
+	eb.Directory = params["directory"]
+	eb.Mode = params["mode"]
+	eb.Server = params["server"]
+	eb.Subject = params["subject"]
+	eb.Permission = params["permission"]
+	if params["expiration"] != "" {
+		eb.Expiration, _ = mail.ParseDate(params["expiration"])
+	}
+	if params["size"] != "" {
+		eb.Size, _ = strconv.ParseInt(params["size"], 10, 64)
+	}
+
+	fields, bodyOffset := parseRawHeaders(data)
+	eb.Header = mail.Header{}
+	for _, f := range fields {
+		key := textproto.CanonicalMIMEHeaderKey(f.Name)
+		eb.Header[key] = append(eb.Header[key], f.DecodedValue)
+	}
+	eb.ContentType = eb.Header.Get("Content-Type")
+	eb.ContentID = strings.Trim(eb.Header.Get("Content-ID"), "<> ")
+	eb.Body = strings.TrimRight(string(data[bodyOffset:]), "\r\n")
+
+	return eb, nil
+}
+
+// newExternalBodyNode builds the message/external-body part of eb, the fields of eb take precedence over Params
+func newExternalBodyNode(eb *ExternalBody) *mimeNode {
+	params := map[string]string{}
+	for k, v := range eb.Params {
+		params[strings.ToLower(k)] = v
+	}
+	set := func(name, value string) {
+		if value != "" {
+			params[name] = value
+		}
+	}
+	set("access-type", eb.AccessType)
+	set("url", eb.URL)
+	set("name", eb.Name)
+	set("site", eb.Site)
+	set("directory", eb.Directory)
+	set("mode", eb.Mode)
+	set("server", eb.Server)
+	set("subject", eb.Subject)
+	set("permission", eb.Permission)
+	if !eb.Expiration.IsZero() {
+		params["expiration"] = eb.Expiration.Format(time.RFC1123Z)
+	}
+	if eb.Size > 0 {
+		params["size"] = strconv.FormatInt(eb.Size, 10)
+	}
+
+	body := new(strings.Builder)
+	if eb.ContentType != "" {
+		body.WriteString(foldHeaderField("Content-Type", eb.ContentType) + "\r\n")
+	}
+	if eb.ContentID != "" {
+		body.WriteString(foldHeaderField("Content-ID", "<"+eb.ContentID+">") + "\r\n")
+	}
+	var names []string
+	for name := range eb.Header {
+		if name != "Content-Type" && name != "Content-Id" {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		for _, value := range eb.Header[name] {
+			body.WriteString(foldHeaderField(name, value) + "\r\n")
+		}
+	}
+	body.WriteString("\r\n")
+	if eb.Body != "" {
+		body.WriteString(normalizeLineBreaks(eb.Body) + "\r\n")
+	}
+
+	return &mimeNode{
+		header: []headerEntry{
+			{"Content-Type", mime.FormatMediaType(contentTypeMessageExternalBody, params)},
+		},
+		body: []byte(body.String()),
+	}
+}
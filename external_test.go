@@ -0,0 +1,276 @@
+package parsemail
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestParseExternalBody(t *testing.T) {
+	var testData = map[int]struct {
+		mailData string
+
+		accessType  string
+		url         string
+		name        string
+		site        string
+		directory   string
+		size        int64
+		expiration  time.Time
+		contentType string
+		contentID   string
+		textBody    string
+	}{
+		1: {
+			mailData: `From: a@example.com
+To: b@example.com
+Subject: Report
+MIME-Version: 1.0
+Content-Type: message/external-body; access-type=URL;
+	URL="http://www.example.com/
+	reports/q1.pdf"; size=1024
+
+Content-Type: application/pdf
+Content-ID: <q1@example.com>
+
+`,
+			accessType:  "url",
+			url:         "http://www.example.com/reports/q1.pdf",
+			size:        1024,
+			contentType: "application/pdf",
+			contentID:   "q1@example.com",
+		},
+		2: {
+			mailData: `From: a@example.com
+To: b@example.com
+Subject: Mixed
+MIME-Version: 1.0
+Content-Type: multipart/mixed; boundary="b1"
+
+--b1
+Content-Type: text/plain
+
+See the attached file.
+--b1
+Content-Type: message/external-body; access-type=ANON-FTP;
+	name="q1.tar.gz"; site="ftp.example.com"; directory="pub";
+	expiration="Fri, 14 Jun 2019 10:00:00 +0000"
+
+Content-Type: application/x-tar
+Content-Transfer-Encoding: binary
+
+--b1--
+`,
+			accessType:  "anon-ftp",
+			name:        "q1.tar.gz",
+			site:        "ftp.example.com",
+			directory:   "pub",
+			expiration:  time.Date(2019, 6, 14, 10, 0, 0, 0, time.UTC),
+			contentType: "application/x-tar",
+			textBody:    "See the attached file.",
+		},
+		3: {
+			mailData: `From: a@example.com
+To: b@example.com
+Subject: Local
+MIME-Version: 1.0
+Content-Type: multipart/mixed; boundary="b1"
+
+--b1
+Content-Type: message/external-body; access-type=local-file;
+	name="/u/nsb/Me.jpeg"; site="thumper.bellcore.com"
+
+Content-type: image/jpeg
+
+--b1--
+`,
+			accessType:  "local-file",
+			name:        "/u/nsb/Me.jpeg",
+			site:        "thumper.bellcore.com",
+			contentType: "image/jpeg",
+		},
+		4: {
+			mailData: `From: a@example.com
+To: b@example.com
+Subject: Alternative
+MIME-Version: 1.0
+Content-Type: multipart/alternative; boundary="b1"
+
+--b1
+Content-Type: text/plain
+
+The document is on the server.
+--b1
+Content-Type: message/external-body; access-type=URL;
+	URL="http://www.example.com/doc.pdf"
+
+Content-Type: application/pdf
+
+--b1--
+`,
+			accessType:  "url",
+			url:         "http://www.example.com/doc.pdf",
+			contentType: "application/pdf",
+			textBody:    "The document is on the server.",
+		},
+		5: {
+			mailData: `From: a@example.com
+To: b@example.com
+Subject: Nested
+MIME-Version: 1.0
+Content-Type: multipart/alternative; boundary="b1"
+
+--b1
+Content-Type: multipart/mixed; boundary="b2"
+
+--b2
+Content-Type: text/plain
+
+Nested text.
+--b2
+Content-Type: message/external-body; access-type=anon-ftp;
+	name="doc.pdf"; site="ftp.example.com"
+
+Content-Type: application/pdf
+
+--b2--
+--b1--
+`,
+			accessType:  "anon-ftp",
+			name:        "doc.pdf",
+			site:        "ftp.example.com",
+			contentType: "application/pdf",
+			textBody:    "Nested text.",
+		},
+	}
+
+	for index, td := range testData {
+		e, err := Parse(strings.NewReader(td.mailData))
+		if err != nil {
+			t.Errorf("[Test Case %v] Unexpected error: %v", index, err)
+			continue
+		}
+
+		if e.TextBody != td.textBody {
+			t.Errorf("[Test Case %v] Wrong text body. Expected: %q, Got: %q", index, td.textBody, e.TextBody)
+		}
+
+		if len(e.ExternalBodies) != 1 {
+			t.Errorf("[Test Case %v] Expected one external body, got %v", index, len(e.ExternalBodies))
+			continue
+		}
+		eb := e.ExternalBodies[0]
+
+		if eb.AccessType != td.accessType {
+			t.Errorf("[Test Case %v] Wrong access type. Expected: %q, Got: %q", index, td.accessType, eb.AccessType)
+		}
+		if eb.URL != td.url {
+			t.Errorf("[Test Case %v] Wrong url. Expected: %q, Got: %q", index, td.url, eb.URL)
+		}
+		if eb.Name != td.name || eb.Site != td.site || eb.Directory != td.directory {
+			t.Errorf("[Test Case %v] Wrong location. Expected: %q %q %q, Got: %q %q %q", index, td.name, td.site, td.directory, eb.Name, eb.Site, eb.Directory)
+		}
+		if eb.Size != td.size {
+			t.Errorf("[Test Case %v] Wrong size. Expected: %v, Got: %v", index, td.size, eb.Size)
+		}
+		if !eb.Expiration.Equal(td.expiration) {
+			t.Errorf("[Test Case %v] Wrong expiration. Expected: %v, Got: %v", index, td.expiration, eb.Expiration)
+		}
+		if eb.ContentType != td.contentType {
+			t.Errorf("[Test Case %v] Wrong phantom content type. Expected: %q, Got: %q", index, td.contentType, eb.ContentType)
+		}
+		if eb.ContentID != td.contentID {
+			t.Errorf("[Test Case %v] Wrong phantom content id. Expected: %q, Got: %q", index, td.contentID, eb.ContentID)
+		}
+	}
+}
+
+func TestWriteExternalBody(t *testing.T) {
+	var testData = map[int]struct {
+		mailData string
+		modify   func(*Email)
+	}{
+		1: {
+			mailData: externalBodyMixedExample,
+		},
+		2: {
+			mailData: externalBodyMixedExample,
+			modify: func(e *Email) {
+				e.Subject = "Changed"
+			},
+		},
+		3: {
+			mailData: externalBodyMixedExample,
+			modify: func(e *Email) {
+				e.TextBody = "See the new file."
+				e.ExternalBodies[0].Name = "q2.tar.gz"
+			},
+		},
+	}
+
+	for index, td := range testData {
+		e, err := Parse(strings.NewReader(td.mailData))
+		if err != nil {
+			t.Errorf("[Test Case %v] Unexpected error: %v", index, err)
+			continue
+		}
+		if td.modify != nil {
+			td.modify(&e)
+		}
+
+		buf := new(bytes.Buffer)
+		if _, err := e.WriteTo(buf); err != nil {
+			t.Errorf("[Test Case %v] %v", index, err)
+			continue
+		}
+
+		written, err := Parse(buf)
+		if err != nil {
+			t.Errorf("[Test Case %v] Can't parse written email: %v", index, err)
+			continue
+		}
+
+		if len(written.ExternalBodies) != len(e.ExternalBodies) {
+			t.Errorf("[Test Case %v] Expected %v external bodies, got %v", index, len(e.ExternalBodies), len(written.ExternalBodies))
+			continue
+		}
+		for i, eb := range written.ExternalBodies {
+			expected := e.ExternalBodies[i]
+			if eb.AccessType != expected.AccessType || eb.Name != expected.Name || eb.Site != expected.Site || eb.Directory != expected.Directory {
+				t.Errorf("[Test Case %v] Wrong location. Expected: %q %q %q %q, Got: %q %q %q %q", index,
+					expected.AccessType, expected.Name, expected.Site, expected.Directory, eb.AccessType, eb.Name, eb.Site, eb.Directory)
+			}
+			if !eb.Expiration.Equal(expected.Expiration) {
+				t.Errorf("[Test Case %v] Wrong expiration. Expected: %v, Got: %v", index, expected.Expiration, eb.Expiration)
+			}
+			if eb.ContentType != expected.ContentType || eb.Header.Get("Content-Transfer-Encoding") != expected.Header.Get("Content-Transfer-Encoding") {
+				t.Errorf("[Test Case %v] Wrong phantom header. Expected: %v, Got: %v", index, expected.Header, eb.Header)
+			}
+		}
+		if written.TextBody != e.TextBody {
+			t.Errorf("[Test Case %v] Wrong text body. Expected: %q, Got: %q", index, e.TextBody, written.TextBody)
+		}
+	}
+}
+
+const externalBodyMixedExample = `From: a@example.com
+To: b@example.com
+Subject: Mixed
+MIME-Version: 1.0
+Content-Type: multipart/mixed; boundary="b1"
+
+--b1
+Content-Type: text/plain
+
+See the attached file.
+--b1
+Content-Type: message/external-body; access-type=ANON-FTP;
+	name="q1.tar.gz"; site="ftp.example.com"; directory="pub";
+	expiration="Fri, 14 Jun 2019 10:00:00 +0000"
+
+Content-Type: application/x-tar
+Content-Transfer-Encoding: binary
+
+--b1--
+`
@@ -0,0 +1,187 @@
+package parsemail
+
+import (
+	"bytes"
+	"strings"
+)
+
+// format=flowed text (RFC 3676), whose soft line breaks are marked by a trailing space
+
+// FlowedLineLength is the line length recommended by RFC 3676 for flowed text
+const FlowedLineLength = 78
+
+const flowedSignatureSeparator = "-- "
+
+// FlowedParagraph is a logical line of flowed text with its quote depth
+type FlowedParagraph struct {
+	QuoteDepth int
+	Text       string
+}
+
+// ParseFlowed joins the soft broken lines of format=flowed text into paragraphs. The quote marks and
+// space-stuffing are removed from the text, when delSp is set the spaces marking soft breaks are removed too.
+func ParseFlowed(text string, delSp bool) (paragraphs []FlowedParagraph) {
+	text = strings.Replace(text, "\r\n", "\n", -1)
+	lines := strings.Split(text, "\n")
+	if len(lines) > 0 && lines[len(lines)-1] == "" {
+		lines = lines[:len(lines)-1]
+	}
+
+	var current *FlowedParagraph
+	for _, line := range lines {
+		depth := 0
+		for depth < len(line) && line[depth] == '>' {
+			depth++
+		}
+		line = line[depth:]
+		line = strings.TrimPrefix(line, " ")
+
+		// a change of the quote depth ends the paragraph even after a soft break
+		if current != nil && current.QuoteDepth != depth {
+			paragraphs = append(paragraphs, *current)
+			current = nil
+		}
+		if current == nil {
+			current = &FlowedParagraph{QuoteDepth: depth}
+		}
+
+		if line == flowedSignatureSeparator || !strings.HasSuffix(line, " ") {
+			current.Text += line
+			paragraphs = append(paragraphs, *current)
+			current = nil
+			continue
+		}
+
+		if delSp {
+			line = line[:len(line)-1]
+		}
+		current.Text += line
+	}
+	if current != nil {
+		paragraphs = append(paragraphs, *current)
+	}
+
+	return
+}
+
+// DecodeFlowed converts format=flowed text into text with hard line breaks only, one line per paragraph.
+// Quoted paragraphs are prefixed with one '>' per quote depth followed by a space.
+func DecodeFlowed(text string, delSp bool) string {
+	var lines []string
+	for _, p := range ParseFlowed(text, delSp) {
+		lines = append(lines, quotePrefix(p.QuoteDepth)+p.Text)
+	}
+
+	return strings.Join(lines, "\n")
+}
+
+// EncodeFlowed converts text into format=flowed text (delsp=no) with lines of at most width characters,
+// except for words which don't fit. Lines starting with '>' are treated as quoted.
+func EncodeFlowed(text string, width int) string {
+	if width <= 0 {
+		width = FlowedLineLength
+	}
+
+	text = strings.Replace(text, "\r\n", "\n", -1)
+	var out []string
+	for _, line := range strings.Split(text, "\n") {
+		depth := 0
+		for depth < len(line) && line[depth] == '>' {
+			depth++
+		}
+		prefix := quotePrefix(depth)
+		if depth > 0 {
+			line = strings.TrimPrefix(line[depth:], " ")
+		}
+
+		if line != flowedSignatureSeparator {
+			line = strings.TrimRight(line, " ")
+		}
+
+		for _, l := range wrapFlowed(line, width-len(prefix)) {
+			if depth == 0 && (strings.HasPrefix(l, " ") || strings.HasPrefix(l, ">") || strings.HasPrefix(l, "From ")) {
+				l = " " + l
+			}
+			out = append(out, prefix+l)
+		}
+	}
+
+	return strings.Join(out, "\r\n")
+}
+
+// wrapFlowed breaks line after spaces, leaving the space at the end of every line but the last one
+func wrapFlowed(line string, width int) (lines []string) {
+	if width < 1 {
+		width = 1
+	}
+
+	for len(line) > width {
+		i := strings.LastIndexByte(line[:width], ' ')
+		if i <= 0 {
+			i = strings.IndexByte(line[width:], ' ')
+			if i < 0 {
+				break
+			}
+			i += width
+		}
+		if i == len(line)-1 {
+			break
+		}
+
+		lines = append(lines, line[:i+1])
+		line = line[i+1:]
+	}
+
+	return append(lines, line)
+}
+
+func quotePrefix(depth int) string {
+	if depth == 0 {
+		return ""
+	}
+
+	return strings.Repeat(">", depth) + " "
+}
+
+func isFlowed(params map[string]string) bool {
+	return strings.EqualFold(params["format"], "flowed")
+}
+
+// decodeFlowedBodies replaces the format=flowed text bodies of email with their decoded text and rebuilds
+// TextBody from the decoded text bodies
+func decodeFlowedBodies(email *Email) error {
+	flowed := false
+	for _, tb := range email.TextBodies {
+		flowed = flowed || isFlowed(tb.Params)
+	}
+	if !flowed {
+		return nil
+	}
+
+	var text strings.Builder
+	for _, tb := range email.TextBodies {
+		data, err := readAndReset(&tb.Data)
+		if err != nil {
+			return err
+		}
+
+		body := string(data)
+		if isFlowed(tb.Params) {
+			body = DecodeFlowed(body, strings.EqualFold(tb.Params["delsp"], "yes"))
+
+			params := map[string]string{}
+			for k, v := range tb.Params {
+				if k != "format" && k != "delsp" {
+					params[k] = v
+				}
+			}
+			tb.Params = params
+			tb.Data = bytes.NewReader([]byte(body))
+		}
+		text.WriteString(strings.TrimSuffix(body, "\n"))
+	}
+	email.TextBody = text.String()
+	email.textBodyRebuilt()
+
+	return nil
+}
@@ -0,0 +1,146 @@
+package parsemail
+
+import (
+	"bytes"
+	"io/ioutil"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestParseFlowed(t *testing.T) {
+	var testData = map[int]struct {
+		text       string
+		delSp      bool
+		paragraphs []FlowedParagraph
+	}{
+		1: {
+			text: "This is a long \r\nparagraph.\r\nSecond line\r\n",
+			paragraphs: []FlowedParagraph{
+				{Text: "This is a long paragraph."},
+				{Text: "Second line"},
+			},
+		},
+		2: {
+			text:  "Wrapped with del \r\nsp. \r\nSoft break  \r\nkept\r\n",
+			delSp: true,
+			paragraphs: []FlowedParagraph{
+				{Text: "Wrapped with delsp.Soft break kept"},
+			},
+		},
+		3: {
+			text: ">> Nested quote \r\n>> continues\r\n> Outer quote \r\nUnquoted\r\n",
+			paragraphs: []FlowedParagraph{
+				{QuoteDepth: 2, Text: "Nested quote continues"},
+				{QuoteDepth: 1, Text: "Outer quote "},
+				{Text: "Unquoted"},
+			},
+		},
+		4: {
+			text: " From here\r\n >not a quote\r\n-- \r\nSignature\r\n",
+			paragraphs: []FlowedParagraph{
+				{Text: "From here"},
+				{Text: ">not a quote"},
+				{Text: "-- "},
+				{Text: "Signature"},
+			},
+		},
+	}
+
+	for index, td := range testData {
+		paragraphs := ParseFlowed(td.text, td.delSp)
+		if !reflect.DeepEqual(paragraphs, td.paragraphs) {
+			t.Errorf("[Test Case %v] Wrong paragraphs. Expected: %+v, Got: %+v", index, td.paragraphs, paragraphs)
+		}
+	}
+}
+
+func TestEncodeFlowed(t *testing.T) {
+	var testData = map[int]struct {
+		text    string
+		width   int
+		encoded string
+		decoded string
+	}{
+		1: {
+			text:    "The quick brown fox jumps over the lazy dog",
+			width:   20,
+			encoded: "The quick brown fox \r\njumps over the lazy \r\ndog",
+			decoded: "The quick brown fox jumps over the lazy dog",
+		},
+		2: {
+			text:    "> quoted text that wraps\nFrom me   \n>> deeper",
+			width:   16,
+			encoded: "> quoted text \r\n> that wraps\r\n From me\r\n>> deeper",
+			decoded: "> quoted text that wraps\nFrom me\n>> deeper",
+		},
+		3: {
+			text:    "averyveryverylongword and more",
+			width:   10,
+			encoded: "averyveryverylongword \r\nand more",
+			decoded: "averyveryverylongword and more",
+		},
+	}
+
+	for index, td := range testData {
+		encoded := EncodeFlowed(td.text, td.width)
+		if encoded != td.encoded {
+			t.Errorf("[Test Case %v] Wrong encoding. Expected: %q, Got: %q", index, td.encoded, encoded)
+		}
+
+		decoded := DecodeFlowed(encoded, false)
+		if decoded != td.decoded {
+			t.Errorf("[Test Case %v] Wrong decoding. Expected: %q, Got: %q", index, td.decoded, decoded)
+		}
+	}
+}
+
+func TestParseWithOptionsDecodeFlowed(t *testing.T) {
+	mailData := "From: a@example.com\r\n" +
+		"To: b@example.com\r\n" +
+		"Subject: Flowed\r\n" +
+		"MIME-Version: 1.0\r\n" +
+		"Content-Type: text/plain; charset=utf-8; format=flowed; delsp=yes\r\n" +
+		"\r\n" +
+		"Hello, this para \r\n" +
+		"graph was wrapped.\r\n" +
+		"> Quoted text  \r\n" +
+		"> that was wrapped too.\r\n"
+	e, err := ParseWithOptions(strings.NewReader(mailData), ParseOptions{DecodeFlowed: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expected := "Hello, this paragraph was wrapped.\n> Quoted text that was wrapped too."
+	if e.TextBody != expected {
+		t.Errorf("Wrong text body. Expected: %q, Got: %q", expected, e.TextBody)
+	}
+
+	data, _ := ioutil.ReadAll(e.TextBodies[0].Data)
+	if string(data) != expected {
+		t.Errorf("Wrong decoded text body data: %q", data)
+	}
+	if _, ok := e.TextBodies[0].Params["format"]; ok {
+		t.Errorf("Decoded text body is still marked as flowed: %v", e.TextBodies[0].Params)
+	}
+}
+
+func TestMessageBuilderFlowedText(t *testing.T) {
+	text := strings.Repeat("word ", 30) + "end"
+
+	buf := new(bytes.Buffer)
+	if _, err := NewMessage().From("a@example.com").FlowedText(text).WriteTo(buf); err != nil {
+		t.Fatal(err)
+	}
+
+	e, err := ParseWithOptions(buf, ParseOptions{DecodeFlowed: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(e.ContentType, "format=flowed") {
+		t.Errorf("Wrong content type: %q", e.ContentType)
+	}
+	if e.TextBody != text {
+		t.Errorf("Wrong text body. Expected: %q, Got: %q", text, e.TextBody)
+	}
+}
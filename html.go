@@ -0,0 +1,351 @@
+package parsemail
+
+import (
+	"html"
+	"strings"
+)
+
+// A lenient HTML parser for the bodies of emails, building a simplified document tree without
+// the full HTML5 tree construction rules
+
+type htmlNodeType int
+
+const (
+	htmlDocumentNode htmlNodeType = iota
+	htmlElementNode
+	htmlTextNode
+	htmlCommentNode
+	htmlDoctypeNode
+)
+
+type htmlAttribute struct {
+	name  string
+	value string
+}
+
+type htmlNode struct {
+	typ htmlNodeType
+	// name is the lowercased tag name of elements
+	name  string
+	attrs []htmlAttribute
+	// data holds the unescaped text of text nodes and the content of comments and doctypes
+	data     string
+	parent   *htmlNode
+	children []*htmlNode
+}
+
+func (n *htmlNode) attr(name string) (string, bool) {
+	for _, a := range n.attrs {
+		if a.name == name {
+			return a.value, true
+		}
+	}
+
+	return "", false
+}
+
+func (n *htmlNode) appendChild(c *htmlNode) {
+	c.parent = n
+	n.children = append(n.children, c)
+}
+
+var htmlVoidElements = map[string]bool{
+	"area": true, "base": true, "br": true, "col": true, "embed": true, "hr": true, "img": true, "input": true,
+	"link": true, "meta": true, "param": true, "source": true, "track": true, "wbr": true,
+}
+
+// htmlRawTextElements hold text which isn't parsed as markup
+var htmlRawTextElements = map[string]bool{
+	"script": true, "style": true, "textarea": true, "title": true, "xmp": true, "iframe": true, "noembed": true,
+	"noframes": true,
+}
+
+// htmlParagraphClosers are the elements which implicitly close an open p element
+var htmlParagraphClosers = map[string]bool{
+	"address": true, "article": true, "aside": true, "blockquote": true, "div": true, "dl": true, "fieldset": true,
+	"footer": true, "form": true, "h1": true, "h2": true, "h3": true, "h4": true, "h5": true, "h6": true,
+	"header": true, "hr": true, "main": true, "nav": true, "ol": true, "p": true, "pre": true, "section": true,
+	"table": true, "ul": true,
+}
+
+// htmlImpliedEnds lists for elements which close an open element of the same kind the elements
+// the search for it stops at
+var htmlImpliedEnds = map[string][]string{
+	"li":     {"ul", "ol"},
+	"dt":     {"dl"},
+	"dd":     {"dl"},
+	"tr":     {"table", "thead", "tbody", "tfoot"},
+	"td":     {"tr", "table"},
+	"th":     {"tr", "table"},
+	"option": {"select", "datalist"},
+	"thead":  {"table"},
+	"tbody":  {"table"},
+	"tfoot":  {"table"},
+}
+
+var htmlImpliedEndNames = map[string][]string{
+	"dt":    {"dt", "dd"},
+	"dd":    {"dt", "dd"},
+	"td":    {"td", "th"},
+	"th":    {"td", "th"},
+	"thead": {"thead", "tbody", "tfoot"},
+	"tbody": {"thead", "tbody", "tfoot"},
+	"tfoot": {"thead", "tbody", "tfoot"},
+}
+
+// parseHTML parses s into a document node
+func parseHTML(s string) *htmlNode {
+	doc := &htmlNode{typ: htmlDocumentNode}
+	p := &htmlParser{s: s, doc: doc, stack: []*htmlNode{doc}}
+	p.parse()
+
+	return doc
+}
+
+type htmlParser struct {
+	s     string
+	pos   int
+	doc   *htmlNode
+	stack []*htmlNode
+}
+
+func (p *htmlParser) current() *htmlNode {
+	return p.stack[len(p.stack)-1]
+}
+
+func (p *htmlParser) parse() {
+	for p.pos < len(p.s) {
+		lt := strings.IndexByte(p.s[p.pos:], '<')
+		if lt < 0 {
+			p.text(p.s[p.pos:])
+			return
+		}
+		if lt > 0 {
+			p.text(p.s[p.pos : p.pos+lt])
+			p.pos += lt
+		}
+
+		rest := p.s[p.pos:]
+		switch {
+		case strings.HasPrefix(rest, "<!-->") || strings.HasPrefix(rest, "<!--->"):
+			// abruptly closed empty comments
+			p.current().appendChild(&htmlNode{typ: htmlCommentNode})
+			p.pos += strings.IndexByte(rest, '>') + 1
+		case strings.HasPrefix(rest, "<!--"):
+			end := strings.Index(rest[4:], "-->")
+			if end < 0 {
+				p.current().appendChild(&htmlNode{typ: htmlCommentNode, data: rest[4:]})
+				p.pos = len(p.s)
+				continue
+			}
+			p.current().appendChild(&htmlNode{typ: htmlCommentNode, data: rest[4 : 4+end]})
+			p.pos += 4 + end + 3
+		case strings.HasPrefix(rest, "<!") || strings.HasPrefix(rest, "<?"):
+			end := strings.IndexByte(rest, '>')
+			if end < 0 {
+				end = len(rest) - 1
+			}
+			if len(rest) > 9 && strings.EqualFold(rest[2:9], "doctype") {
+				p.current().appendChild(&htmlNode{typ: htmlDoctypeNode, data: strings.TrimSpace(rest[9:end])})
+			}
+			p.pos += end + 1
+		case strings.HasPrefix(rest, "</") && len(rest) > 2 && isHTMLLetter(rest[2]):
+			end := strings.IndexByte(rest, '>')
+			if end < 0 {
+				end = len(rest) - 1
+			}
+			name := rest[2:]
+			if i := strings.IndexAny(name, " \t\r\n\f/>"); i >= 0 {
+				name = name[:i]
+			}
+			p.endTag(strings.ToLower(name))
+			p.pos += end + 1
+		case len(rest) > 1 && isHTMLLetter(rest[1]):
+			p.startTag()
+		default:
+			p.text("<")
+			p.pos++
+		}
+	}
+}
+
+func (p *htmlParser) text(s string) {
+	if s == "" {
+		return
+	}
+
+	parent := p.current()
+	if n := len(parent.children); n > 0 && parent.children[n-1].typ == htmlTextNode {
+		parent.children[n-1].data += html.UnescapeString(s)
+		return
+	}
+	parent.appendChild(&htmlNode{typ: htmlTextNode, data: html.UnescapeString(s)})
+}
+
+// startTag parses the tag at p.pos along with its attributes
+func (p *htmlParser) startTag() {
+	i := p.pos + 1
+	for i < len(p.s) && !isHTMLSpace(p.s[i]) && p.s[i] != '/' && p.s[i] != '>' {
+		i++
+	}
+	n := &htmlNode{typ: htmlElementNode, name: strings.ToLower(p.s[p.pos+1 : i])}
+
+	selfClosing := false
+	for i < len(p.s) && p.s[i] != '>' {
+		c := p.s[i]
+		if isHTMLSpace(c) {
+			i++
+			continue
+		}
+		if c == '/' {
+			selfClosing = i+1 < len(p.s) && p.s[i+1] == '>'
+			i++
+			continue
+		}
+
+		start := i
+		for i < len(p.s) && !isHTMLSpace(p.s[i]) && p.s[i] != '=' && p.s[i] != '>' && p.s[i] != '/' {
+			i++
+		}
+		attr := htmlAttribute{name: strings.ToLower(p.s[start:i])}
+
+		j := i
+		for j < len(p.s) && isHTMLSpace(p.s[j]) {
+			j++
+		}
+		if j < len(p.s) && p.s[j] == '=' {
+			j++
+			for j < len(p.s) && isHTMLSpace(p.s[j]) {
+				j++
+			}
+			if j < len(p.s) && (p.s[j] == '"' || p.s[j] == '\'') {
+				end := strings.IndexByte(p.s[j+1:], p.s[j])
+				if end < 0 {
+					end = len(p.s) - j - 1
+				}
+				attr.value = p.s[j+1 : j+1+end]
+				i = j + 1 + end + 1
+			} else {
+				start := j
+				for j < len(p.s) && !isHTMLSpace(p.s[j]) && p.s[j] != '>' {
+					j++
+				}
+				attr.value = p.s[start:j]
+				i = j
+			}
+			attr.value = html.UnescapeString(attr.value)
+		}
+
+		if _, exists := n.attr(attr.name); !exists && attr.name != "" {
+			n.attrs = append(n.attrs, attr)
+		}
+	}
+	p.pos = i + 1
+	if p.pos > len(p.s) {
+		p.pos = len(p.s)
+	}
+
+	p.closeImplied(n.name)
+	p.current().appendChild(n)
+
+	if htmlVoidElements[n.name] || selfClosing {
+		return
+	}
+
+	if htmlRawTextElements[n.name] {
+		end := indexFold(p.s[p.pos:], "</"+n.name)
+		if end < 0 {
+			end = len(p.s) - p.pos
+		}
+		if end > 0 {
+			text := p.s[p.pos : p.pos+end]
+			if n.name == "textarea" || n.name == "title" {
+				text = html.UnescapeString(text)
+			}
+			n.appendChild(&htmlNode{typ: htmlTextNode, data: text})
+		}
+		p.pos += end
+		if gt := strings.IndexByte(p.s[p.pos:], '>'); gt >= 0 {
+			p.pos += gt + 1
+		} else {
+			p.pos = len(p.s)
+		}
+		return
+	}
+
+	p.stack = append(p.stack, n)
+}
+
+// closeImplied closes the open elements a new name element ends, like a p followed by a div
+// or an li followed by another li
+func (p *htmlParser) closeImplied(name string) {
+	if htmlParagraphClosers[name] {
+		p.closeWithin("p", []string{"button", "td", "th", "li", "blockquote", "div"})
+	}
+
+	if scope, ok := htmlImpliedEnds[name]; ok {
+		names := htmlImpliedEndNames[name]
+		if names == nil {
+			names = []string{name}
+		}
+		for _, n := range names {
+			if p.closeWithin(n, scope) {
+				break
+			}
+		}
+	}
+}
+
+// closeWithin pops the stack up to and including the innermost name element, unless one of the scope
+// elements is open inside it
+func (p *htmlParser) closeWithin(name string, scope []string) bool {
+	for i := len(p.stack) - 1; i > 0; i-- {
+		switch n := p.stack[i].name; {
+		case n == name:
+			p.stack = p.stack[:i]
+			return true
+		case containsString(scope, n):
+			return false
+		}
+	}
+
+	return false
+}
+
+func (p *htmlParser) endTag(name string) {
+	for i := len(p.stack) - 1; i > 0; i-- {
+		if p.stack[i].name == name {
+			p.stack = p.stack[:i]
+			return
+		}
+	}
+}
+
+func isHTMLLetter(c byte) bool {
+	return c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z'
+}
+
+func isHTMLSpace(c byte) bool {
+	return c == ' ' || c == '\t' || c == '\n' || c == '\r' || c == '\f'
+}
+
+func containsString(list []string, s string) bool {
+	for _, item := range list {
+		if item == s {
+			return true
+		}
+	}
+
+	return false
+}
+
+// indexFold returns the index of the first case insensitive occurrence of the ASCII string substr in s
+func indexFold(s, substr string) int {
+	for i := 0; i+len(substr) <= len(s); i++ {
+		if strings.EqualFold(s[i:i+len(substr)], substr) {
+			return i
+		}
+	}
+
+	return -1
+}
@@ -0,0 +1,65 @@
+package parsemail
+
+import (
+	"strings"
+	"testing"
+)
+
+// dumpHTML writes the tree of n in a compact form: elements as name[attr=value](children), text quoted
+func dumpHTML(n *htmlNode) string {
+	var parts []string
+	for _, c := range n.children {
+		switch c.typ {
+		case htmlTextNode:
+			parts = append(parts, `"`+c.data+`"`)
+		case htmlCommentNode:
+			parts = append(parts, "<!--"+c.data+"-->")
+		case htmlElementNode:
+			s := c.name
+			for _, a := range c.attrs {
+				s += "[" + a.name + "=" + a.value + "]"
+			}
+			if len(c.children) > 0 {
+				s += "(" + dumpHTML(c) + ")"
+			}
+			parts = append(parts, s)
+		}
+	}
+
+	return strings.Join(parts, " ")
+}
+
+func TestParseHTML(t *testing.T) {
+	var testData = map[int]struct {
+		html string
+		tree string
+	}{
+		1: {
+			html: `<P CLASS="a" id=b data-x='1 &amp; 2' hidden>Text &lt;here&gt;</p>`,
+			tree: `p[class=a][id=b][data-x=1 & 2][hidden=]("Text <here>")`,
+		},
+		2: {
+			html: `<ul><li>One<li>Two</ul><p>Para<div>Block</div>`,
+			tree: `ul(li("One") li("Two")) p("Para") div("Block")`,
+		},
+		3: {
+			html: `<table><tr><td>A<td>B<tr><td>C</table>`,
+			tree: `table(tr(td("A") td("B")) tr(td("C")))`,
+		},
+		4: {
+			html: `<script>if (a < b) { document.write('</div>') }</SCRIPT><br/><img src=x.png alt="">`,
+			tree: `script("if (a < b) { document.write('</div>') }") br img[src=x.png][alt=]`,
+		},
+		5: {
+			html: `<!DOCTYPE html><!-- comment --><b>bold <i>both</b> after</i> 1 < 2`,
+			tree: `<!-- comment --> b("bold " i("both")) " after 1 < 2"`,
+		},
+	}
+
+	for index, td := range testData {
+		tree := dumpHTML(parseHTML(td.html))
+		if tree != td.tree {
+			t.Errorf("[Test Case %v] Wrong tree.\nExpected: %s\nGot:      %s", index, td.tree, tree)
+		}
+	}
+}
@@ -0,0 +1,360 @@
+package parsemail
+
+import (
+	"strconv"
+	"strings"
+	"unicode"
+)
+
+// Plain text rendering of HTML bodies, for mail which only has an HTML body
+
+// htmlSkippedElements never contribute to the text
+var htmlSkippedElements = map[string]bool{
+	"head": true, "script": true, "style": true, "title": true, "template": true, "noscript": true,
+	"iframe": true, "object": true, "embed": true, "svg": true, "select": true,
+}
+
+// htmlParagraphElements are separated from the surrounding text by blank lines
+var htmlParagraphElements = map[string]bool{
+	"p": true, "h1": true, "h2": true, "h3": true, "h4": true, "h5": true, "h6": true, "dl": true,
+	"figure": true, "fieldset": true,
+}
+
+// htmlBlockElements start on a new line
+var htmlBlockElements = map[string]bool{
+	"div": true, "section": true, "article": true, "header": true, "footer": true, "nav": true, "main": true,
+	"aside": true, "address": true, "center": true, "form": true, "dt": true, "dd": true, "caption": true,
+	"details": true, "summary": true, "figcaption": true, "body": true, "html": true,
+}
+
+const htmlTextRule = "----------"
+
+// HTMLToText renders an HTML body as plain text. Block elements, list items and table rows start new lines,
+// quotes are prefixed with "> " and links are numbered like text[1], with their URLs listed at the end.
+func HTMLToText(body string) string {
+	r := &htmlTextRenderer{linkNumbers: map[string]int{}}
+	text := r.renderBlock(parseHTML(body).children, false)
+
+	if len(r.links) > 0 {
+		var footnotes []string
+		for i, link := range r.links {
+			footnotes = append(footnotes, "["+strconv.Itoa(i+1)+"] "+link)
+		}
+		text = joinParagraphs(text, strings.Join(footnotes, "\n"))
+	}
+
+	return text
+}
+
+type htmlTextRenderer struct {
+	links       []string
+	linkNumbers map[string]int
+}
+
+// htmlTextWriter collapses white space and separates blocks, the line breaks pending at the end
+// are only written when more text follows
+type htmlTextWriter struct {
+	b        strings.Builder
+	space    bool
+	newlines int
+}
+
+func (w *htmlTextWriter) write(s string) {
+	if s == "" {
+		return
+	}
+
+	if w.b.Len() > 0 {
+		if w.newlines > 0 {
+			w.b.WriteString(strings.Repeat("\n", w.newlines))
+		} else if w.space {
+			w.b.WriteByte(' ')
+		}
+	}
+	w.newlines, w.space = 0, false
+	w.b.WriteString(s)
+}
+
+// text writes s with its white space collapsed
+func (w *htmlTextWriter) text(s string) {
+	words := strings.Fields(s)
+	if len(words) == 0 {
+		if s != "" {
+			w.space = true
+		}
+		return
+	}
+
+	if strings.TrimLeftFunc(s, unicode.IsSpace) != s {
+		w.space = true
+	}
+	w.write(strings.Join(words, " "))
+	if strings.TrimRightFunc(s, unicode.IsSpace) != s {
+		w.space = true
+	}
+}
+
+// lines writes preformatted or already rendered text as it is
+func (w *htmlTextWriter) lines(s string) {
+	w.write(s)
+}
+
+func (w *htmlTextWriter) breakLines(n int) {
+	if n > w.newlines {
+		w.newlines = n
+	}
+	w.space = false
+}
+
+func (w *htmlTextWriter) String() string {
+	return w.b.String()
+}
+
+// renderBlock renders nodes into a separate block of text
+func (r *htmlTextRenderer) renderBlock(nodes []*htmlNode, pre bool) string {
+	w := &htmlTextWriter{}
+	for _, n := range nodes {
+		r.render(w, n, pre)
+	}
+
+	return w.String()
+}
+
+func (r *htmlTextRenderer) render(w *htmlTextWriter, n *htmlNode, pre bool) {
+	switch n.typ {
+	case htmlTextNode:
+		if pre {
+			w.lines(strings.Replace(n.data, "\r\n", "\n", -1))
+		} else {
+			w.text(n.data)
+		}
+		return
+	case htmlElementNode:
+	default:
+		return
+	}
+
+	switch {
+	case htmlSkippedElements[n.name]:
+	case n.name == "br":
+		w.newlines++
+		w.space = false
+	case n.name == "hr":
+		w.breakLines(2)
+		w.write(htmlTextRule)
+		w.breakLines(2)
+	case n.name == "img":
+		if alt, _ := n.attr("alt"); strings.TrimSpace(alt) != "" {
+			w.write("[" + strings.Join(strings.Fields(alt), " ") + "]")
+		}
+	case n.name == "a":
+		r.renderLink(w, n, pre)
+	case n.name == "pre":
+		w.breakLines(2)
+		w.lines(strings.TrimSuffix(strings.TrimPrefix(r.renderBlock(n.children, true), "\n"), "\n"))
+		w.breakLines(2)
+	case n.name == "blockquote":
+		w.breakLines(2)
+		w.lines(prefixLines(r.renderBlock(n.children, pre), "> ", "> "))
+		w.breakLines(2)
+	case n.name == "ul" || n.name == "ol":
+		r.renderList(w, n, pre)
+	case n.name == "li":
+		// an item outside of a list
+		w.breakLines(1)
+		w.lines(prefixLines(r.renderBlock(n.children, pre), "* ", "  "))
+		w.breakLines(1)
+	case n.name == "table":
+		r.renderTable(w, n, pre)
+	case htmlParagraphElements[n.name]:
+		w.breakLines(2)
+		r.renderChildren(w, n, pre)
+		w.breakLines(2)
+	case htmlBlockElements[n.name]:
+		w.breakLines(1)
+		r.renderChildren(w, n, pre)
+		w.breakLines(1)
+	default:
+		r.renderChildren(w, n, pre)
+	}
+}
+
+func (r *htmlTextRenderer) renderChildren(w *htmlTextWriter, n *htmlNode, pre bool) {
+	for _, c := range n.children {
+		r.render(w, c, pre)
+	}
+}
+
+// renderLink writes the text of a link followed by the number of its footnote, links whose text is
+// their URL are written as they are
+func (r *htmlTextRenderer) renderLink(w *htmlTextWriter, n *htmlNode, pre bool) {
+	href, _ := n.attr("href")
+	href = strings.TrimSpace(href)
+
+	lower := strings.ToLower(href)
+	if href == "" || strings.HasPrefix(href, "#") || strings.HasPrefix(lower, "javascript:") {
+		r.renderChildren(w, n, pre)
+		return
+	}
+
+	text := r.renderBlock(n.children, pre)
+	if text == "" {
+		w.write(href)
+		return
+	}
+	w.lines(text)
+
+	if text == href || "mailto:"+text == lower || strings.TrimSuffix(text, "/") == strings.TrimSuffix(href, "/") {
+		return
+	}
+
+	number, ok := r.linkNumbers[href]
+	if !ok {
+		r.links = append(r.links, href)
+		number = len(r.links)
+		r.linkNumbers[href] = number
+	}
+	w.b.WriteString("[" + strconv.Itoa(number) + "]")
+}
+
+func (r *htmlTextRenderer) renderList(w *htmlTextWriter, n *htmlNode, pre bool) {
+	number := 1
+	if start, ok := n.attr("start"); ok {
+		if s, err := strconv.Atoi(strings.TrimSpace(start)); err == nil {
+			number = s
+		}
+	}
+
+	nested := false
+	for p := n.parent; p != nil; p = p.parent {
+		nested = nested || p.name == "li"
+	}
+	if nested {
+		w.breakLines(1)
+	} else {
+		w.breakLines(2)
+	}
+
+	for _, item := range n.children {
+		if item.typ != htmlElementNode || item.name != "li" {
+			r.render(w, item, pre)
+			continue
+		}
+
+		marker := "* "
+		if n.name == "ol" {
+			marker = strconv.Itoa(number) + ". "
+			number++
+		}
+
+		w.breakLines(1)
+		w.lines(prefixLines(r.renderBlock(item.children, pre), marker, strings.Repeat(" ", len(marker))))
+		w.breakLines(1)
+	}
+
+	if nested {
+		w.breakLines(1)
+	} else {
+		w.breakLines(2)
+	}
+}
+
+// renderTable writes every row on its own line with the cells separated by " | ", rows with cells spanning
+// multiple lines, as in layout tables, have their cells written one after the other
+func (r *htmlTextRenderer) renderTable(w *htmlTextWriter, n *htmlNode, pre bool) {
+	w.breakLines(2)
+
+	var rows []*htmlNode
+	var collect func(n *htmlNode)
+	collect = func(n *htmlNode) {
+		for _, c := range n.children {
+			switch c.name {
+			case "tr":
+				rows = append(rows, c)
+			case "thead", "tbody", "tfoot":
+				collect(c)
+			case "caption":
+				w.breakLines(1)
+				r.renderChildren(w, c, pre)
+				w.breakLines(1)
+			}
+		}
+	}
+	collect(n)
+
+	for _, row := range rows {
+		var cells []string
+		multiline := false
+		for _, c := range row.children {
+			if c.typ != htmlElementNode || (c.name != "td" && c.name != "th") {
+				continue
+			}
+			if cell := r.renderBlock(c.children, pre); cell != "" {
+				cells = append(cells, cell)
+				multiline = multiline || strings.Contains(cell, "\n")
+			}
+		}
+		if len(cells) == 0 {
+			continue
+		}
+
+		w.breakLines(1)
+		if multiline {
+			for _, cell := range cells {
+				w.breakLines(1)
+				w.lines(cell)
+			}
+		} else {
+			w.lines(strings.Join(cells, " | "))
+		}
+		w.breakLines(1)
+	}
+
+	w.breakLines(2)
+}
+
+// prefixLines prefixes the first line of text with first and the other lines with rest
+func prefixLines(text, first, rest string) string {
+	if text == "" {
+		return ""
+	}
+
+	lines := strings.Split(text, "\n")
+	for i, line := range lines {
+		prefix := rest
+		if i == 0 {
+			prefix = first
+		}
+		if line == "" {
+			prefix = strings.TrimRight(prefix, " ")
+		}
+		lines[i] = prefix + line
+	}
+
+	return strings.Join(lines, "\n")
+}
+
+// fillTextBody renders the HTML bodies of email into TextBody when it has no text body, the bodies are
+// decoded from their charset first so TextBody holds UTF-8 text
+func fillTextBody(email *Email) error {
+	if email.TextBody != "" || email.HTMLBody == "" {
+		return nil
+	}
+
+	var text []string
+	for _, hb := range email.HTMLBodies {
+		data, err := readAndReset(&hb.Data)
+		if err != nil {
+			return err
+		}
+		html, _ := decodeCharset(data, hb.Params["charset"])
+		text = append(text, HTMLToText(html))
+	}
+	if len(email.HTMLBodies) == 0 {
+		text = append(text, HTMLToText(email.HTMLBody))
+	}
+
+	email.TextBody = joinParagraphs(text...)
+
+	return nil
+}
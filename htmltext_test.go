@@ -0,0 +1,129 @@
+package parsemail
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestHTMLToText(t *testing.T) {
+	var testData = map[int]struct {
+		html string
+		text string
+	}{
+		1: {
+			html: "<html><head><title>Title</title><style>p { color: red }</style></head>" +
+				"<body><h1>News</h1><p>Hello&nbsp;<b>World</b>,\n   welcome!</p><script>alert(1)</script></body></html>",
+			text: "News\n\nHello World, welcome!",
+		},
+		2: {
+			html: `<p>See <a href="https://example.com/a">our site</a>, <a href="https://example.com/">https://example.com/</a>` +
+				` and <a href="mailto:info@example.com">info@example.com</a>.</p><p><a href="https://example.com/a">Again</a>` +
+				` <a href="#top">top</a> <a href="https://example.com/b"><img src="b.png" alt="Banner"></a></p>`,
+			text: "See our site[1], https://example.com/ and info@example.com.\n\nAgain[1] top [Banner][2]\n\n" +
+				"[1] https://example.com/a\n[2] https://example.com/b",
+		},
+		3: {
+			html: `<ul><li>One<li>Two<ul><li>Nested</li></ul></li></ul><ol start="3"><li>Three</li><li>Four<br>lines</li></ol>`,
+			text: "* One\n* Two\n  * Nested\n\n3. Three\n4. Four\n   lines",
+		},
+		4: {
+			html: `<table><thead><tr><th>Name</th><th>Price</th></tr></thead><tbody><tr><td>Tea</td><td>&euro;3</td></tr>` +
+				`<tr><td></td></tr></tbody></table>` +
+				`<table><tr><td><p>Layout</p><p>cell</p></td><td>Side</td></tr></table>`,
+			text: "Name | Price\nTea | €3\n\nLayout\n\ncell\nSide",
+		},
+		5: {
+			html: "<div>Reply</div><blockquote><p>Quoted</p><blockquote>Deeper</blockquote></blockquote><pre>  code\n    block\n</pre>",
+			text: "Reply\n\n> Quoted\n>\n> > Deeper\n\n  code\n    block",
+		},
+		6: {
+			html: "Line<br>break<br><br>paragraph<hr>end",
+			text: "Line\nbreak\n\nparagraph\n\n----------\n\nend",
+		},
+	}
+
+	for index, td := range testData {
+		text := HTMLToText(td.html)
+		if text != td.text {
+			t.Errorf("[Test Case %v] Wrong text.\nExpected: %q\nGot:      %q", index, td.text, text)
+		}
+	}
+}
+
+func TestParseWithOptionsTextFromHTML(t *testing.T) {
+	var testData = map[int]struct {
+		mailData string
+		textBody string
+	}{
+		1: {
+			mailData: `From: a@example.com
+To: b@example.com
+Subject: Newsletter
+MIME-Version: 1.0
+Content-Type: text/html; charset=utf-8
+Content-Transfer-Encoding: quoted-printable
+
+<p>Hello <a href=3D"https://example.com">reader</a></p>
+`,
+			textBody: "Hello reader[1]\n\n[1] https://example.com",
+		},
+		2: {
+			mailData: `From: a@example.com
+To: b@example.com
+Subject: Both
+MIME-Version: 1.0
+Content-Type: multipart/alternative; boundary="b1"
+
+--b1
+Content-Type: text/plain
+
+Plain text
+--b1
+Content-Type: text/html
+
+<p>HTML text</p>
+--b1--
+`,
+			textBody: "Plain text",
+		},
+		3: {
+			mailData: "From: a@example.com\n" +
+				"To: b@example.com\n" +
+				"Subject: Cyrillic\n" +
+				"MIME-Version: 1.0\n" +
+				"Content-Type: text/html; charset=windows-1251\n" +
+				"Content-Transfer-Encoding: 8bit\n" +
+				"\n" +
+				"<p>\xcf\xf0\xe8\xe2\xe5\xf2, <b>\xec\xe8\xf0</b>!</p>\n",
+			textBody: "Привет, мир!",
+		},
+		4: {
+			mailData: `From: a@example.com
+To: b@example.com
+Subject: Latin 2
+MIME-Version: 1.0
+Content-Type: multipart/alternative; boundary="b1"
+
+--b1
+Content-Type: text/html; charset="ISO-8859-2"
+Content-Transfer-Encoding: quoted-printable
+
+<p>=BEluou=E8k=FD k=F9=F2</p>
+--b1--
+`,
+			textBody: "žluoučký kůň",
+		},
+	}
+
+	for index, td := range testData {
+		e, err := ParseWithOptions(strings.NewReader(td.mailData), ParseOptions{TextFromHTML: true})
+		if err != nil {
+			t.Errorf("[Test Case %v] Unexpected error: %v", index, err)
+			continue
+		}
+
+		if e.TextBody != td.textBody {
+			t.Errorf("[Test Case %v] Wrong text body. Expected: %q, Got: %q", index, td.textBody, e.TextBody)
+		}
+	}
+}
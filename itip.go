@@ -0,0 +1,185 @@
+package parsemail
+
+import (
+	"fmt"
+	"net/mail"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// iTIP (RFC 5546) replies to meeting invitations
+
+// Participation statuses of a reply to an invitation
+const (
+	PartStatAccepted  = "ACCEPTED"
+	PartStatDeclined  = "DECLINED"
+	PartStatTentative = "TENTATIVE"
+)
+
+const calendarLineLength = 75
+
+var partStatSubjects = map[string]string{
+	PartStatAccepted:  "Accepted",
+	PartStatDeclined:  "Declined",
+	PartStatTentative: "Tentative",
+}
+
+var partStatVerbs = map[string]string{
+	PartStatAccepted:  "accepted",
+	PartStatDeclined:  "declined",
+	PartStatTentative: "tentatively accepted",
+}
+
+// CalendarReplyOptions configure the reply composed by BuildCalendarReply
+type CalendarReplyOptions struct {
+	// From is the address of the attendee replying to the invitation
+	From string
+	// PartStat is the participation status of the attendee: PartStatAccepted, PartStatDeclined or PartStatTentative
+	PartStat string
+	// Comment is sent to the organizer along with the status
+	Comment string
+}
+
+// BuildCalendarReply starts composing an iTIP REPLY to the METHOD:REQUEST invitation in email. The reply is addressed
+// to the organizer and holds a text body along with a text/calendar; method=REPLY alternative, which carries the
+// participation status of the From attendee for the UID and sequence of every event of the invitation.
+func BuildCalendarReply(email Email, opts CalendarReplyOptions) *MessageBuilder {
+	b := NewMessage().From(opts.From)
+	if b.err != nil {
+		return b
+	}
+
+	cal := email.Calendar
+	switch {
+	case cal == nil || cal.Method != "REQUEST":
+		b.err = fmt.Errorf("email doesn't contain a calendar request")
+		return b
+	case len(cal.Events) == 0:
+		b.err = fmt.Errorf("calendar request without events")
+		return b
+	case partStatSubjects[opts.PartStat] == "":
+		b.err = fmt.Errorf("invalid participation status: %s", opts.PartStat)
+		return b
+	}
+
+	event := cal.Events[0]
+	if event.Organizer == nil || event.Organizer.Address == "" {
+		b.err = fmt.Errorf("calendar request without organizer")
+		return b
+	}
+
+	attendee := &mail.Address{Name: b.email.From[0].Name, Address: b.email.From[0].Address}
+	for _, a := range event.Attendees {
+		if a.Address != nil && strings.EqualFold(a.Address.Address, attendee.Address) {
+			if attendee.Name == "" {
+				attendee.Name = a.Address.Name
+			}
+			attendee.Address = a.Address.Address
+			break
+		}
+	}
+
+	b.email.To = []*mail.Address{event.Organizer}
+	b.Subject(partStatSubjects[opts.PartStat] + ": " + event.Summary)
+	if email.MessageID != "" {
+		b.InReplyTo(email.MessageID)
+	}
+	b.References(replyReferences(email)...)
+
+	author := attendee.Address
+	if attendee.Name != "" {
+		author = attendee.Name
+	}
+	b.Text(joinParagraphs(fmt.Sprintf("%s has %s this invitation.", author, partStatVerbs[opts.PartStat]), opts.Comment))
+
+	b.Calendar("REPLY", formatCalendarReply(cal, attendee, opts, time.Now()))
+
+	return b
+}
+
+// formatCalendarReply returns the VCALENDAR of a reply, the events keep the properties identifying them
+// and describing the meeting while the attendee list only holds the replying attendee
+func formatCalendarReply(cal *Calendar, attendee *mail.Address, opts CalendarReplyOptions, now time.Time) string {
+	lines := []string{
+		"BEGIN:VCALENDAR",
+		"PRODID:-//parsemail//iTIP reply//EN",
+		"VERSION:2.0",
+		"METHOD:REPLY",
+	}
+
+	for _, event := range cal.Events {
+		lines = append(lines, "BEGIN:VEVENT", "UID:"+event.UID)
+		if event.RecurrenceIDAllDay {
+			lines = append(lines, "RECURRENCE-ID;VALUE=DATE:"+event.RecurrenceID.Format(calendarDateFormat))
+		} else if !event.RecurrenceID.IsZero() {
+			lines = append(lines, "RECURRENCE-ID:"+event.RecurrenceID.UTC().Format(calendarDateTimeFormatUTC))
+		}
+		lines = append(lines,
+			"SEQUENCE:"+strconv.Itoa(event.Sequence),
+			"DTSTAMP:"+now.UTC().Format(calendarDateTimeFormatUTC),
+		)
+		if event.AllDay {
+			lines = append(lines,
+				"DTSTART;VALUE=DATE:"+event.Start.Format(calendarDateFormat),
+				"DTEND;VALUE=DATE:"+event.End.Format(calendarDateFormat),
+			)
+		} else {
+			lines = append(lines,
+				"DTSTART:"+event.Start.UTC().Format(calendarDateTimeFormatUTC),
+				"DTEND:"+event.End.UTC().Format(calendarDateTimeFormatUTC),
+			)
+		}
+		if event.Summary != "" {
+			lines = append(lines, "SUMMARY:"+escapeCalendarText(event.Summary))
+		}
+		if event.Organizer != nil {
+			lines = append(lines, "ORGANIZER"+formatCalendarCN(event.Organizer.Name)+":mailto:"+event.Organizer.Address)
+		}
+		lines = append(lines, "ATTENDEE;PARTSTAT="+opts.PartStat+formatCalendarCN(attendee.Name)+":mailto:"+attendee.Address)
+		if opts.Comment != "" {
+			lines = append(lines, "COMMENT:"+escapeCalendarText(opts.Comment))
+		}
+		lines = append(lines, "END:VEVENT")
+	}
+	lines = append(lines, "END:VCALENDAR")
+
+	for i, line := range lines {
+		lines[i] = foldCalendarLine(line)
+	}
+
+	return strings.Join(lines, "\r\n") + "\r\n"
+}
+
+func formatCalendarCN(name string) string {
+	if name == "" {
+		return ""
+	}
+	if strings.ContainsAny(name, ",;:") {
+		return `;CN="` + strings.Replace(name, `"`, "'", -1) + `"`
+	}
+
+	return ";CN=" + name
+}
+
+func escapeCalendarText(s string) string {
+	return strings.NewReplacer(`\`, `\\`, ";", `\;`, ",", `\,`, "\r\n", `\n`, "\n", `\n`).Replace(s)
+}
+
+// foldCalendarLine splits lines longer than 75 octets, without splitting UTF-8 sequences
+func foldCalendarLine(line string) string {
+	var out strings.Builder
+	limit := calendarLineLength
+	for len(line) > limit {
+		i := limit
+		for i > 0 && line[i]&0xC0 == 0x80 {
+			i--
+		}
+		out.WriteString(line[:i] + "\r\n ")
+		line = line[i:]
+		limit = calendarLineLength - 1
+	}
+	out.WriteString(line)
+
+	return out.String()
+}
@@ -0,0 +1,187 @@
+package parsemail
+
+import (
+	"bytes"
+	"net/mail"
+	"strings"
+	"testing"
+	"time"
+)
+
+const invitationCalendar = "BEGIN:VCALENDAR\r\n" +
+	"METHOD:REQUEST\r\n" +
+	"VERSION:2.0\r\n" +
+	"BEGIN:VEVENT\r\n" +
+	"UID:meeting-1@example.com\r\n" +
+	"SEQUENCE:2\r\n" +
+	"SUMMARY:Planning\\, Q3\r\n" +
+	"DTSTART:20190614T080000Z\r\n" +
+	"DTEND:20190614T093000Z\r\n" +
+	"ORGANIZER;CN=John:mailto:john@example.com\r\n" +
+	"ATTENDEE;PARTSTAT=NEEDS-ACTION;RSVP=TRUE;CN=Jane Doe:mailto:jane@example.com\r\n" +
+	"ATTENDEE;PARTSTAT=NEEDS-ACTION;CN=Bob:mailto:bob@example.com\r\n" +
+	"END:VEVENT\r\n" +
+	"END:VCALENDAR\r\n"
+
+func TestBuildCalendarReply(t *testing.T) {
+	var testData = map[int]struct {
+		opts CalendarReplyOptions
+
+		subject  string
+		text     string
+		attendee string
+	}{
+		1: {
+			opts:     CalendarReplyOptions{From: "jane@example.com", PartStat: PartStatAccepted},
+			subject:  "Accepted: Planning, Q3",
+			text:     "Jane Doe has accepted this invitation.",
+			attendee: "Jane Doe <jane@example.com>",
+		},
+		2: {
+			opts:     CalendarReplyOptions{From: "Bobby <BOB@example.com>", PartStat: PartStatDeclined, Comment: "On vacation"},
+			subject:  "Declined: Planning, Q3",
+			text:     "Bobby has declined this invitation.\n\nOn vacation",
+			attendee: "Bobby <bob@example.com>",
+		},
+		3: {
+			opts:     CalendarReplyOptions{From: "jane@example.com", PartStat: PartStatTentative},
+			subject:  "Tentative: Planning, Q3",
+			text:     "Jane Doe has tentatively accepted this invitation.",
+			attendee: "Jane Doe <jane@example.com>",
+		},
+	}
+
+	invitation := new(bytes.Buffer)
+	_, err := NewMessage().
+		From("John <john@example.com>").
+		To("jane@example.com", "bob@example.com").
+		Subject("Invitation: Planning, Q3").
+		MessageID("invitation@example.com").
+		Text("You are invited.").
+		Calendar("REQUEST", invitationCalendar).
+		WriteTo(invitation)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for index, td := range testData {
+		original, err := Parse(bytes.NewReader(invitation.Bytes()))
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		buf := new(bytes.Buffer)
+		if _, err := BuildCalendarReply(original, td.opts).WriteTo(buf); err != nil {
+			t.Errorf("[Test Case %v] Unexpected error: %v", index, err)
+			continue
+		}
+
+		reply, err := Parse(buf)
+		if err != nil {
+			t.Errorf("[Test Case %v] Reply can't be parsed: %v", index, err)
+			continue
+		}
+
+		if mediaType, _, _ := parseContentType(reply.ContentType); mediaType != contentTypeMultipartAlternative {
+			t.Errorf("[Test Case %v] Wrong content type. Expected: %q, Got: %q", index, contentTypeMultipartAlternative, reply.ContentType)
+		}
+		if reply.Subject != td.subject {
+			t.Errorf("[Test Case %v] Wrong subject. Expected: %q, Got: %q", index, td.subject, reply.Subject)
+		}
+		if len(reply.To) != 1 || reply.To[0].Address != "john@example.com" {
+			t.Errorf("[Test Case %v] Reply not addressed to the organizer: %v", index, reply.To)
+		}
+		if len(reply.InReplyTo) != 1 || reply.InReplyTo[0] != "invitation@example.com" {
+			t.Errorf("[Test Case %v] Wrong In-Reply-To: %v", index, reply.InReplyTo)
+		}
+		if text := strings.Replace(reply.TextBody, "\r\n", "\n", -1); text != td.text {
+			t.Errorf("[Test Case %v] Wrong text body. Expected: %q, Got: %q", index, td.text, text)
+		}
+
+		if len(reply.EmbeddedFiles) != 1 || !strings.Contains(reply.EmbeddedFiles[0].ContentType, "method=REPLY") {
+			t.Errorf("[Test Case %v] Missing text/calendar; method=REPLY part: %+v", index, reply.EmbeddedFiles)
+		}
+
+		cal := reply.Calendar
+		if cal == nil || cal.Method != "REPLY" || len(cal.Events) != 1 {
+			t.Errorf("[Test Case %v] Wrong calendar: %+v", index, cal)
+			continue
+		}
+		e := cal.Events[0]
+		if e.UID != "meeting-1@example.com" || e.Sequence != 2 || e.Summary != "Planning, Q3" {
+			t.Errorf("[Test Case %v] Wrong event: %+v", index, e)
+		}
+		if !e.Start.Equal(original.Calendar.Events[0].Start) || !e.End.Equal(original.Calendar.Events[0].End) {
+			t.Errorf("[Test Case %v] Wrong event time: %v - %v", index, e.Start, e.End)
+		}
+		if len(e.Attendees) != 1 {
+			t.Errorf("[Test Case %v] Expected only the replying attendee, got %v", index, len(e.Attendees))
+			continue
+		}
+		if a := e.Attendees[0]; a.PartStat != td.opts.PartStat || formatAddressListForDisplay([]*mail.Address{a.Address}) != td.attendee {
+			t.Errorf("[Test Case %v] Wrong attendee. Expected: %v %v, Got: %v %v", index, td.attendee, td.opts.PartStat, a.Address, a.PartStat)
+		}
+	}
+}
+
+func TestBuildCalendarReplyErrors(t *testing.T) {
+	var testData = map[int]struct {
+		email Email
+		opts  CalendarReplyOptions
+	}{
+		1: {email: Email{}, opts: CalendarReplyOptions{From: "jane@example.com", PartStat: PartStatAccepted}},
+		2: {email: Email{Calendar: &Calendar{Method: "CANCEL", Events: []*CalendarEvent{{}}}}, opts: CalendarReplyOptions{From: "jane@example.com", PartStat: PartStatAccepted}},
+		3: {email: Email{Calendar: &Calendar{Method: "REQUEST", Events: []*CalendarEvent{{Organizer: &mail.Address{Address: "john@example.com"}}}}}, opts: CalendarReplyOptions{From: "jane@example.com", PartStat: "MAYBE"}},
+		4: {email: Email{Calendar: &Calendar{Method: "REQUEST", Events: []*CalendarEvent{{}}}}, opts: CalendarReplyOptions{From: "jane@example.com", PartStat: PartStatAccepted}},
+	}
+
+	for index, td := range testData {
+		if _, err := BuildCalendarReply(td.email, td.opts).Build(); err == nil {
+			t.Errorf("[Test Case %v] Expected an error", index)
+		}
+	}
+}
+
+func TestFormatCalendarReplyRecurrenceID(t *testing.T) {
+	var testData = map[int]struct {
+		recurrenceID string
+		expected     string
+	}{
+		1: {
+			recurrenceID: "RECURRENCE-ID;VALUE=DATE:20190617",
+			expected:     "RECURRENCE-ID;VALUE=DATE:20190617\r\n",
+		},
+		2: {
+			recurrenceID: "RECURRENCE-ID;TZID=Europe/Bratislava:20190617T100000",
+			expected:     "RECURRENCE-ID:20190617T080000Z\r\n",
+		},
+	}
+
+	for index, td := range testData {
+		cal, err := ParseCalendar([]byte("BEGIN:VCALENDAR\r\nMETHOD:REQUEST\r\nBEGIN:VEVENT\r\nUID:weekly-1\r\n" +
+			td.recurrenceID + "\r\nDTSTART;VALUE=DATE:20190618\r\nORGANIZER:mailto:john@example.com\r\nEND:VEVENT\r\nEND:VCALENDAR\r\n"))
+		if err != nil {
+			t.Errorf("[Test Case %v] Unexpected error: %v", index, err)
+			continue
+		}
+
+		reply := formatCalendarReply(cal, &mail.Address{Address: "jane@example.com"}, CalendarReplyOptions{PartStat: PartStatAccepted}, time.Now())
+		if !strings.Contains(reply, "\r\n"+td.expected) {
+			t.Errorf("[Test Case %v] Wrong recurrence id. Expected: %q, Got: %q", index, td.expected, reply)
+		}
+	}
+}
+
+func TestFoldCalendarLine(t *testing.T) {
+	line := "SUMMARY:" + strings.Repeat("ä", 60)
+	folded := foldCalendarLine(line)
+
+	for _, l := range strings.Split(folded, "\r\n") {
+		if len(l) > calendarLineLength {
+			t.Errorf("Line longer than %v octets: %q", calendarLineLength, l)
+		}
+	}
+	if strings.Replace(folded, "\r\n ", "", -1) != line {
+		t.Errorf("Folded line doesn't unfold to the original: %q", folded)
+	}
+}
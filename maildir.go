@@ -0,0 +1,205 @@
+package parsemail
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync/atomic"
+	"time"
+)
+
+const maildirInfoSeparator = ":2,"
+
+var maildirDeliveries int64
+
+// Maildir is the path of a maildir directory holding the cur, new and tmp subdirectories
+type Maildir string
+
+// MaildirFlags are the standard flags stored in the info part of a maildir file name
+type MaildirFlags struct {
+	Draft   bool
+	Flagged bool
+	Passed  bool
+	Replied bool
+	Seen    bool
+	Trashed bool
+}
+
+// String returns the flags in the order they appear in maildir file names
+func (f MaildirFlags) String() string {
+	flags := ""
+	for _, flag := range []struct {
+		set  bool
+		code string
+	}{
+		{f.Draft, "D"},
+		{f.Flagged, "F"},
+		{f.Passed, "P"},
+		{f.Replied, "R"},
+		{f.Seen, "S"},
+		{f.Trashed, "T"},
+	} {
+		if flag.set {
+			flags += flag.code
+		}
+	}
+
+	return flags
+}
+
+func parseMaildirFlags(info string) (f MaildirFlags) {
+	f.Draft = strings.Contains(info, "D")
+	f.Flagged = strings.Contains(info, "F")
+	f.Passed = strings.Contains(info, "P")
+	f.Replied = strings.Contains(info, "R")
+	f.Seen = strings.Contains(info, "S")
+	f.Trashed = strings.Contains(info, "T")
+
+	return
+}
+
+// MaildirMessage is a message read from a maildir
+type MaildirMessage struct {
+	Email Email
+	// Key is the unique name of the message, without the info part
+	Key   string
+	Flags MaildirFlags
+	// New is set for messages in the new directory, which weren't seen by any mail client yet
+	New  bool
+	Path string
+}
+
+// MaildirReader reads the messages of a maildir
+type MaildirReader struct {
+	paths []string
+	next  int
+}
+
+// NewMaildirReader returns a reader of the messages in the new and cur directories of d
+func NewMaildirReader(d Maildir) (*MaildirReader, error) {
+	mr := &MaildirReader{}
+
+	for _, sub := range []string{"new", "cur"} {
+		files, err := ioutil.ReadDir(filepath.Join(string(d), sub))
+		if err != nil {
+			return nil, err
+		}
+
+		var names []string
+		for _, f := range files {
+			if !f.IsDir() && !strings.HasPrefix(f.Name(), ".") {
+				names = append(names, f.Name())
+			}
+		}
+		sort.Strings(names)
+
+		for _, name := range names {
+			mr.paths = append(mr.paths, filepath.Join(string(d), sub, name))
+		}
+	}
+
+	return mr, nil
+}
+
+// Next parses the next message. It returns io.EOF when there are no more messages. When a message can't
+// be parsed, the error is returned together with its key and flags and reading can continue.
+func (mr *MaildirReader) Next() (*MaildirMessage, error) {
+	if mr.next >= len(mr.paths) {
+		return nil, io.EOF
+	}
+
+	path := mr.paths[mr.next]
+	mr.next++
+
+	msg := &MaildirMessage{
+		Path: path,
+		New:  filepath.Base(filepath.Dir(path)) == "new",
+	}
+
+	msg.Key = filepath.Base(path)
+	if i := strings.Index(msg.Key, maildirInfoSeparator); i >= 0 {
+		msg.Flags = parseMaildirFlags(msg.Key[i+len(maildirInfoSeparator):])
+		msg.Key = msg.Key[:i]
+	}
+
+	f, err := os.Open(path)
+	if err != nil {
+		return msg, err
+	}
+	defer f.Close()
+
+	msg.Email, err = Parse(f)
+	if err != nil {
+		return msg, fmt.Errorf("maildir message %s: %v", msg.Key, err)
+	}
+
+	return msg, nil
+}
+
+// Create creates the maildir directories if they don't exist yet
+func (d Maildir) Create() error {
+	for _, sub := range []string{"cur", "new", "tmp"} {
+		if err := os.MkdirAll(filepath.Join(string(d), sub), 0700); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// Deliver serializes email into the maildir and returns its key. The message is stored with the LF line endings
+// of local mail, it is written to tmp first and moved to new only once it is completely written and synced,
+// so readers never see partial messages.
+func (d Maildir) Deliver(email *Email) (string, error) {
+	key, err := newMaildirKey()
+	if err != nil {
+		return "", err
+	}
+
+	tmp := filepath.Join(string(d), "tmp", key)
+	f, err := os.OpenFile(tmp, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0600)
+	if err != nil {
+		return "", err
+	}
+
+	buf := new(bytes.Buffer)
+	if _, err = email.WriteTo(buf); err == nil {
+		_, err = f.Write(bytes.Replace(buf.Bytes(), []byte("\r\n"), []byte("\n"), -1))
+	}
+	if err == nil {
+		err = f.Sync()
+	}
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		os.Remove(tmp)
+		return "", err
+	}
+
+	if err := os.Rename(tmp, filepath.Join(string(d), "new", key)); err != nil {
+		os.Remove(tmp)
+		return "", err
+	}
+
+	return key, nil
+}
+
+// newMaildirKey returns a unique message name in the <seconds>.M<usec>P<pid>Q<counter>.<host> form
+func newMaildirKey() (string, error) {
+	host, err := os.Hostname()
+	if err != nil {
+		return "", err
+	}
+	host = strings.Replace(host, "/", `\057`, -1)
+	host = strings.Replace(host, ":", `\072`, -1)
+
+	now := time.Now()
+
+	return fmt.Sprintf("%d.M%dP%dQ%d.%s", now.Unix(), now.Nanosecond()/1000, os.Getpid(), atomic.AddInt64(&maildirDeliveries, 1), host), nil
+}
@@ -0,0 +1,107 @@
+package parsemail
+
+import (
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestMaildir(t *testing.T) {
+	dir, err := ioutil.TempDir("", "parsemail-maildir")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	md := Maildir(dir)
+	if err := md.Create(); err != nil {
+		t.Fatal(err)
+	}
+
+	e, err := NewMessage().From("jdoe@machine.example").Subject("delivered").Text("Hello.").Build()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	key, err := md.Deliver(&e)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if strings.ContainsAny(key, "/:") {
+		t.Errorf("Invalid key: %s", key)
+	}
+
+	if files, _ := ioutil.ReadDir(filepath.Join(dir, "tmp")); len(files) != 0 {
+		t.Errorf("Delivery left %v files in tmp", len(files))
+	}
+
+	if raw, err := ioutil.ReadFile(filepath.Join(dir, "new", key)); err != nil || strings.Contains(string(raw), "\r\n") {
+		t.Errorf("Delivered message not stored with LF line endings: %q %v", raw, err)
+	}
+
+	if err := ioutil.WriteFile(filepath.Join(dir, "cur", "1000.M1P1.host:2,FRS"), []byte(rfc5322exampleA11), 0600); err != nil {
+		t.Fatal(err)
+	}
+	if err := ioutil.WriteFile(filepath.Join(dir, "cur", ".hidden"), []byte("ignored"), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	mr, err := NewMaildirReader(md)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var testData = map[int]struct {
+		key     string
+		new     bool
+		flags   MaildirFlags
+		subject string
+	}{
+		1: {key: key, new: true, subject: "delivered"},
+		2: {key: "1000.M1P1.host", flags: MaildirFlags{Flagged: true, Replied: true, Seen: true}, subject: "Saying Hello"},
+	}
+
+	for index := 1; index <= len(testData); index++ {
+		td := testData[index]
+
+		msg, err := mr.Next()
+		if err != nil {
+			t.Fatalf("[Test Case %v] %v", index, err)
+		}
+
+		if msg.Key != td.key {
+			t.Errorf("[Test Case %v] Wrong key. Expected: %s, Got: %s", index, td.key, msg.Key)
+		}
+
+		if msg.New != td.new {
+			t.Errorf("[Test Case %v] Wrong new. Expected: %v, Got: %v", index, td.new, msg.New)
+		}
+
+		if msg.Flags != td.flags {
+			t.Errorf("[Test Case %v] Wrong flags. Expected: %s, Got: %s", index, td.flags, msg.Flags)
+		}
+
+		if msg.Email.Subject != td.subject {
+			t.Errorf("[Test Case %v] Wrong subject. Expected: %s, Got: %s", index, td.subject, msg.Email.Subject)
+		}
+	}
+
+	if _, err := mr.Next(); err != io.EOF {
+		t.Errorf("Expected EOF, got: %v", err)
+	}
+}
+
+func TestMaildirFlagsString(t *testing.T) {
+	f := MaildirFlags{Trashed: true, Seen: true, Draft: true, Passed: true}
+	if f.String() != "DPST" {
+		t.Errorf("Wrong flags. Expected: DPST, Got: %s", f.String())
+	}
+
+	if parseMaildirFlags(f.String()) != f {
+		t.Errorf("Flags don't round trip: %s", parseMaildirFlags(f.String()))
+	}
+}
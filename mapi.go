@@ -0,0 +1,183 @@
+package parsemail
+
+import (
+	"bytes"
+	"encoding/binary"
+	"strings"
+	"time"
+	"unicode/utf16"
+)
+
+// MAPI property types
+const (
+	MAPITypeInt16   = 0x0002
+	MAPITypeInt32   = 0x0003
+	MAPITypeBoolean = 0x000B
+	MAPITypeObject  = 0x000D
+	MAPITypeInt64   = 0x0014
+	MAPITypeString8 = 0x001E
+	MAPITypeUnicode = 0x001F
+	MAPITypeSysTime = 0x0040
+	MAPITypeBinary  = 0x0102
+)
+
+// fixed size MAPI property types which aren't mapped onto Email fields
+const (
+	mapiTypeFloat    = 0x0004
+	mapiTypeDouble   = 0x0005
+	mapiTypeCurrency = 0x0006
+	mapiTypeAppTime  = 0x0007
+	mapiTypeError    = 0x000A
+	mapiTypeCLSID    = 0x0048
+)
+
+// MAPI property ids mapped to Email fields
+const (
+	mapiMessageClass              = 0x001A
+	mapiSubject                   = 0x0037
+	mapiClientSubmitTime          = 0x0039
+	mapiSentRepresentingName      = 0x0042
+	mapiSentRepresentingEmail     = 0x0065
+	mapiTransportMessageHeaders   = 0x007D
+	mapiSenderAddrType            = 0x0C1E
+	mapiSenderName                = 0x0C1A
+	mapiSenderEmailAddress        = 0x0C1F
+	mapiRecipientType             = 0x0C15
+	mapiMessageDeliveryTime       = 0x0E06
+	mapiBody                      = 0x1000
+	mapiRTFCompressed             = 0x1009
+	mapiHTML                      = 0x1013
+	mapiInternetMessageID         = 0x1035
+	mapiInternetReferences        = 0x1039
+	mapiInReplyToID               = 0x1042
+	mapiDisplayName               = 0x3001
+	mapiAddrType                  = 0x3002
+	mapiEmailAddress              = 0x3003
+	mapiAttachDataBin             = 0x3701
+	mapiAttachFilename            = 0x3704
+	mapiAttachMethod              = 0x3705
+	mapiAttachLongFilename        = 0x3707
+	mapiAttachMimeTag             = 0x370E
+	mapiAttachContentID           = 0x3712
+	mapiSMTPAddress               = 0x39FE
+	mapiSenderSMTPAddress         = 0x5D01
+	mapiSentRepresentingSMTP      = 0x5D02
+	mapiAttachMethodEmbeddedMsg   = 5
+	mapiRecipientTypeTo           = 1
+	mapiRecipientTypeCc           = 2
+	mapiRecipientTypeBcc          = 3
+	mapiMultiValuedFlag           = 0x1000
+	mapiFiletimeEpochDifference   = 116444736000000000
+	mapiFiletimeIntervalsInSecond = 10000000
+)
+
+// MAPIProperty is a property of an Outlook message, recipient or attachment with its raw value
+type MAPIProperty struct {
+	ID    uint16
+	Type  uint16
+	Value []byte
+}
+
+// String decodes string properties, other types return an empty string
+func (p MAPIProperty) String() string {
+	switch p.Type {
+	case MAPITypeUnicode:
+		return decodeUTF16(p.Value)
+	case MAPITypeString8:
+		return decodeString8(p.Value)
+	case MAPITypeBinary:
+		return strings.TrimRight(string(p.Value), "\x00")
+	}
+
+	return ""
+}
+
+// Int decodes integer and boolean properties
+func (p MAPIProperty) Int() int64 {
+	switch {
+	case p.Type == MAPITypeInt16 && len(p.Value) >= 2:
+		return int64(int16(binary.LittleEndian.Uint16(p.Value)))
+	case (p.Type == MAPITypeInt32 || p.Type == MAPITypeBoolean) && len(p.Value) >= 4:
+		return int64(int32(binary.LittleEndian.Uint32(p.Value)))
+	case p.Type == MAPITypeInt64 && len(p.Value) >= 8:
+		return int64(binary.LittleEndian.Uint64(p.Value))
+	}
+
+	return 0
+}
+
+// Time decodes time properties
+func (p MAPIProperty) Time() time.Time {
+	if p.Type != MAPITypeSysTime || len(p.Value) < 8 {
+		return time.Time{}
+	}
+
+	return filetimeToTime(binary.LittleEndian.Uint64(p.Value))
+}
+
+// mapiProperties indexes properties by their id
+type mapiProperties map[uint16]MAPIProperty
+
+func (props mapiProperties) string(ids ...uint16) string {
+	for _, id := range ids {
+		if p, ok := props[id]; ok {
+			if s := p.String(); s != "" {
+				return s
+			}
+		}
+	}
+
+	return ""
+}
+
+func (props mapiProperties) bytes(id uint16) []byte {
+	if p, ok := props[id]; ok {
+		return p.Value
+	}
+
+	return nil
+}
+
+func (props mapiProperties) int(id uint16) int64 {
+	return props[id].Int()
+}
+
+func (props mapiProperties) time(ids ...uint16) time.Time {
+	for _, id := range ids {
+		if t := props[id].Time(); !t.IsZero() {
+			return t
+		}
+	}
+
+	return time.Time{}
+}
+
+func filetimeToTime(ft uint64) time.Time {
+	if ft == 0 {
+		return time.Time{}
+	}
+
+	intervals := int64(ft) - mapiFiletimeEpochDifference
+
+	return time.Unix(intervals/mapiFiletimeIntervalsInSecond, intervals%mapiFiletimeIntervalsInSecond*100).UTC()
+}
+
+func decodeUTF16(b []byte) string {
+	units := make([]uint16, len(b)/2)
+	for i := range units {
+		units[i] = binary.LittleEndian.Uint16(b[2*i:])
+	}
+
+	return strings.TrimRight(string(utf16.Decode(units)), "\x00")
+}
+
+// decodeString8 decodes 8-bit strings as Windows-1252, the most common ANSI code page
+func decodeString8(b []byte) string {
+	if i := bytes.IndexByte(b, 0); i >= 0 {
+		b = b[:i]
+	}
+
+	s, _ := decodeCharset(b, "windows-1252")
+
+	return s
+}
@@ -0,0 +1,372 @@
+package parsemail
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"io"
+	"net/textproto"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// MboxFormat is a variant of the mbox file format
+type MboxFormat int
+
+const (
+	// MboxO escapes "From " lines in message bodies with a single ">", which can't be reversed unambiguously
+	MboxO MboxFormat = iota
+	// MboxRD escapes "From " lines including already quoted ones (">From ") with an additional ">"
+	MboxRD
+	// MboxCL escapes like MboxO and adds a Content-Length header to every message
+	MboxCL
+	// MboxCL2 adds a Content-Length header to every message and doesn't escape anything
+	MboxCL2
+)
+
+var mboxDateFormats = []string{
+	time.ANSIC,
+	"Mon Jan _2 15:04:05 2006 -0700",
+	"Mon Jan _2 15:04:05 -0700 2006",
+	"Mon Jan _2 15:04:05 MST 2006",
+	time.RFC1123Z,
+}
+
+// MboxMessage is a message read from an mbox file with the envelope information from its From_ line
+type MboxMessage struct {
+	Email          Email
+	EnvelopeSender string
+	EnvelopeDate   time.Time
+}
+
+// MboxReader reads messages from an mbox file
+type MboxReader struct {
+	r      *bufio.Reader
+	format MboxFormat
+	from   []byte
+}
+
+// NewMboxReader returns a reader of the messages of the mbox file r stored in the given format
+func NewMboxReader(r io.Reader, format MboxFormat) *MboxReader {
+	return &MboxReader{
+		r:      bufio.NewReader(r),
+		format: format,
+	}
+}
+
+// Next parses the next message. It returns io.EOF when there are no more messages. When a message can't
+// be parsed, the error is returned together with the envelope information and reading can continue.
+func (mr *MboxReader) Next() (*MboxMessage, error) {
+	if mr.from == nil {
+		if err := mr.skipToFromLine(); err != nil {
+			return nil, err
+		}
+	}
+
+	msg := &MboxMessage{}
+	msg.EnvelopeSender, msg.EnvelopeDate = parseMboxFromLine(mr.from)
+	mr.from = nil
+
+	raw, err := mr.readMessage()
+	if err != nil {
+		return nil, err
+	}
+
+	msg.Email, err = Parse(bytes.NewReader(raw))
+	if err != nil {
+		return msg, fmt.Errorf("mbox message from %s: %v", msg.EnvelopeSender, err)
+	}
+
+	return msg, nil
+}
+
+// skipToFromLine skips anything preceding the first From_ line
+func (mr *MboxReader) skipToFromLine() error {
+	for {
+		line, err := mr.r.ReadBytes('\n')
+		if isMboxFromLine(line) {
+			mr.from = line
+			return nil
+		}
+
+		if err == io.EOF {
+			return io.EOF
+		} else if err != nil {
+			return err
+		}
+	}
+}
+
+func (mr *MboxReader) readMessage() ([]byte, error) {
+	if mr.format == MboxCL || mr.format == MboxCL2 {
+		return mr.readMessageWithContentLength()
+	}
+
+	return mr.readMessageUntilFromLine(new(bytes.Buffer))
+}
+
+// readMessageUntilFromLine appends lines to buf up to the next From_ line, un-escaping them as needed
+func (mr *MboxReader) readMessageUntilFromLine(buf *bytes.Buffer) ([]byte, error) {
+	for {
+		line, err := mr.r.ReadBytes('\n')
+		if err != nil && err != io.EOF {
+			return nil, err
+		}
+
+		if isMboxFromLine(line) {
+			mr.from = line
+			break
+		}
+
+		buf.Write(mr.unescape(line))
+
+		if err == io.EOF {
+			break
+		}
+	}
+
+	return trimMboxSeparator(buf.Bytes()), nil
+}
+
+// readMessageWithContentLength reads the message body using its Content-Length header and falls back to
+// reading up to the next From_ line when the header is missing
+func (mr *MboxReader) readMessageWithContentLength() ([]byte, error) {
+	buf := new(bytes.Buffer)
+	length := -1
+
+	for {
+		line, err := mr.r.ReadBytes('\n')
+		if err != nil && err != io.EOF {
+			return nil, err
+		}
+		buf.Write(line)
+
+		if name, value, ok := splitHeaderLine(line); ok && textproto.CanonicalMIMEHeaderKey(name) == "Content-Length" {
+			if n, err := strconv.Atoi(value); err == nil && n >= 0 {
+				length = n
+			}
+		}
+
+		if len(bytes.TrimRight(line, "\r\n")) == 0 || err == io.EOF {
+			break
+		}
+	}
+
+	if length < 0 {
+		return mr.readMessageUntilFromLine(buf)
+	}
+
+	body := make([]byte, length)
+	n, err := io.ReadFull(mr.r, body)
+	if err != nil && err != io.ErrUnexpectedEOF && err != io.EOF {
+		return nil, err
+	}
+	body = body[:n]
+	if mr.format == MboxCL {
+		body = mr.unescapeAll(body)
+	}
+	buf.Write(body)
+
+	// skip the separator up to the next From_ line
+	for {
+		line, err := mr.r.ReadBytes('\n')
+		if isMboxFromLine(line) {
+			mr.from = line
+			break
+		}
+		if err != nil {
+			break
+		}
+	}
+
+	return buf.Bytes(), nil
+}
+
+func (mr *MboxReader) unescape(line []byte) []byte {
+	switch mr.format {
+	case MboxRD:
+		quotes := 0
+		for quotes < len(line) && line[quotes] == '>' {
+			quotes++
+		}
+		if quotes > 0 && bytes.HasPrefix(line[quotes:], []byte("From ")) {
+			return line[1:]
+		}
+	case MboxO, MboxCL:
+		if bytes.HasPrefix(line, []byte(">From ")) {
+			return line[1:]
+		}
+	}
+
+	return line
+}
+
+func (mr *MboxReader) unescapeAll(body []byte) []byte {
+	lines := bytes.SplitAfter(body, []byte("\n"))
+	for i, line := range lines {
+		lines[i] = mr.unescape(line)
+	}
+
+	return bytes.Join(lines, nil)
+}
+
+func isMboxFromLine(line []byte) bool {
+	return bytes.HasPrefix(line, []byte("From "))
+}
+
+// parseMboxFromLine returns the envelope sender and date of a "From sender date" line
+func parseMboxFromLine(line []byte) (sender string, date time.Time) {
+	fields := strings.SplitN(strings.TrimSpace(strings.TrimPrefix(string(line), "From ")), " ", 2)
+	sender = fields[0]
+	if len(fields) < 2 {
+		return
+	}
+
+	value := strings.Join(strings.Fields(fields[1]), " ")
+	for _, format := range mboxDateFormats {
+		if t, err := time.Parse(format, value); err == nil {
+			return sender, t
+		}
+	}
+
+	return
+}
+
+// trimMboxSeparator removes the empty line separating the message from the next From_ line
+func trimMboxSeparator(raw []byte) []byte {
+	if bytes.HasSuffix(raw, []byte("\r\n\r\n")) {
+		return raw[:len(raw)-2]
+	}
+	if bytes.HasSuffix(raw, []byte("\n\n")) {
+		return raw[:len(raw)-1]
+	}
+
+	return raw
+}
+
+func splitHeaderLine(line []byte) (name, value string, ok bool) {
+	colon := bytes.IndexByte(line, ':')
+	if colon <= 0 || line[0] == ' ' || line[0] == '\t' {
+		return "", "", false
+	}
+
+	return string(line[:colon]), strings.TrimSpace(string(line[colon+1:])), true
+}
+
+// MboxWriter appends messages to an mbox file
+type MboxWriter struct {
+	w      io.Writer
+	format MboxFormat
+}
+
+// NewMboxWriter returns a writer appending messages to the mbox file w in the given format
+func NewMboxWriter(w io.Writer, format MboxFormat) *MboxWriter {
+	return &MboxWriter{
+		w:      w,
+		format: format,
+	}
+}
+
+// Write serializes the email of msg and appends it preceded by a From_ line. When the envelope sender or date
+// are not set, they are taken from the Sender (or first From) address and Date of the email.
+func (mw *MboxWriter) Write(msg *MboxMessage) error {
+	buf := new(bytes.Buffer)
+	if _, err := msg.Email.WriteTo(buf); err != nil {
+		return err
+	}
+
+	raw := bytes.Replace(buf.Bytes(), []byte("\r\n"), []byte("\n"), -1)
+	if !bytes.HasSuffix(raw, []byte("\n")) {
+		raw = append(raw, '\n')
+	}
+
+	header, body := raw, []byte{}
+	if i := bytes.Index(raw, []byte("\n\n")); i >= 0 {
+		header, body = raw[:i+1], raw[i+2:]
+	}
+
+	body = mw.escape(body)
+
+	out := new(bytes.Buffer)
+	out.WriteString(mboxFromLine(msg))
+	if mw.format == MboxCL || mw.format == MboxCL2 {
+		out.Write(removeHeaderField(header, "Content-Length"))
+		fmt.Fprintf(out, "Content-Length: %d\n", len(body))
+	} else {
+		out.Write(header)
+	}
+	out.WriteString("\n")
+	out.Write(body)
+	out.WriteString("\n")
+
+	_, err := mw.w.Write(out.Bytes())
+
+	return err
+}
+
+func (mw *MboxWriter) escape(body []byte) []byte {
+	if mw.format == MboxCL2 {
+		return body
+	}
+
+	lines := bytes.SplitAfter(body, []byte("\n"))
+	for i, line := range lines {
+		quoted := line
+		if mw.format == MboxRD {
+			quoted = bytes.TrimLeft(line, ">")
+		}
+
+		if bytes.HasPrefix(quoted, []byte("From ")) {
+			lines[i] = append([]byte(">"), line...)
+		}
+	}
+
+	return bytes.Join(lines, nil)
+}
+
+func mboxFromLine(msg *MboxMessage) string {
+	sender := msg.EnvelopeSender
+	if sender == "" && msg.Email.Sender != nil {
+		sender = msg.Email.Sender.Address
+	}
+	if sender == "" && len(msg.Email.From) > 0 {
+		sender = msg.Email.From[0].Address
+	}
+	if sender == "" {
+		sender = "MAILER-DAEMON"
+	}
+
+	date := msg.EnvelopeDate
+	if date.IsZero() {
+		date = msg.Email.Date
+	}
+	if date.IsZero() {
+		date = time.Now()
+	}
+
+	return "From " + sender + " " + date.UTC().Format(time.ANSIC) + "\n"
+}
+
+// removeHeaderField removes all occurrences of the field, including their continuation lines, from header
+func removeHeaderField(header []byte, name string) []byte {
+	out := new(bytes.Buffer)
+	skipping := false
+
+	for _, line := range bytes.SplitAfter(header, []byte("\n")) {
+		if len(line) > 0 && (line[0] == ' ' || line[0] == '\t') {
+			if !skipping {
+				out.Write(line)
+			}
+			continue
+		}
+
+		n, _, ok := splitHeaderLine(line)
+		skipping = ok && strings.EqualFold(n, name)
+		if !skipping {
+			out.Write(line)
+		}
+	}
+
+	return out.Bytes()
+}
@@ -0,0 +1,158 @@
+package parsemail
+
+import (
+	"io"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestMboxReader(t *testing.T) {
+	var testData = map[int]struct {
+		mboxData   string
+		format     MboxFormat
+		senders    []string
+		dates      []time.Time
+		textBodies []string
+	}{
+		1: {
+			mboxData: "From jdoe@machine.example Fri Nov 21 09:55:06 1997\n" +
+				rfc5322exampleA11 + "\n>From the start\n>>From quoted\n\n" +
+				"From mary@example.net  Fri Nov  7 10:01:10 1997\n" +
+				rfc5322exampleA2a + "\n\n",
+			format:  MboxO,
+			senders: []string{"jdoe@machine.example", "mary@example.net"},
+			dates: []time.Time{
+				time.Date(1997, 11, 21, 9, 55, 6, 0, time.UTC),
+				time.Date(1997, 11, 7, 10, 1, 10, 0, time.UTC),
+			},
+			textBodies: []string{
+				"This is a message just to say hello.\nSo, \"Hello\".\n\nFrom the start\n>>From quoted\n",
+				"This is a reply to your hello.\n\n",
+			},
+		},
+		2: {
+			mboxData: "From jdoe@machine.example Fri Nov 21 09:55:06 1997\n" +
+				rfc5322exampleA11 + "\n>From the start\n>>From quoted\n\n",
+			format:  MboxRD,
+			senders: []string{"jdoe@machine.example"},
+			dates:   []time.Time{time.Date(1997, 11, 21, 9, 55, 6, 0, time.UTC)},
+			textBodies: []string{
+				"This is a message just to say hello.\nSo, \"Hello\".\n\nFrom the start\n>From quoted\n",
+			},
+		},
+		3: {
+			mboxData: "From jdoe@machine.example Fri Nov 21 09:55:06 1997\n" +
+				"Subject: first\nContent-Length: 25\n\nFrom here on\n>From there\n\n" +
+				"From mary@example.net Fri Nov 21 10:01:10 1997\n" +
+				"Subject: second\nContent-Length: 3\n\nend\n",
+			format:     MboxCL2,
+			senders:    []string{"jdoe@machine.example", "mary@example.net"},
+			textBodies: []string{"From here on\n>From there\n", "end"},
+		},
+		4: {
+			mboxData: "From jdoe@machine.example Fri Nov 21 09:55:06 1997\n" +
+				"Subject: first\nContent-Length: 24\n\n>From here\n>>From there\n\n" +
+				"From mary@example.net Fri Nov 21 10:01:10 1997\n" +
+				"Subject: no length\n\nbody\n\n",
+			format:     MboxCL,
+			senders:    []string{"jdoe@machine.example", "mary@example.net"},
+			textBodies: []string{"From here\n>>From there\n", "body\n"},
+		},
+	}
+
+	for index, td := range testData {
+		mr := NewMboxReader(strings.NewReader(td.mboxData), td.format)
+
+		var messages []*MboxMessage
+		for {
+			msg, err := mr.Next()
+			if err == io.EOF {
+				break
+			} else if err != nil {
+				t.Errorf("[Test Case %v] %v", index, err)
+				break
+			}
+			messages = append(messages, msg)
+		}
+
+		if len(messages) != len(td.senders) {
+			t.Errorf("[Test Case %v] Wrong number of messages. Expected: %v, Got: %v", index, len(td.senders), len(messages))
+			continue
+		}
+
+		for i, msg := range messages {
+			if msg.EnvelopeSender != td.senders[i] {
+				t.Errorf("[Test Case %v] Wrong envelope sender %v. Expected: %s, Got: %s", index, i, td.senders[i], msg.EnvelopeSender)
+			}
+
+			if td.dates != nil && !msg.EnvelopeDate.Equal(td.dates[i]) {
+				t.Errorf("[Test Case %v] Wrong envelope date %v. Expected: %s, Got: %s", index, i, td.dates[i], msg.EnvelopeDate)
+			}
+
+			if msg.Email.TextBody != strings.TrimSuffix(td.textBodies[i], "\n") {
+				t.Errorf("[Test Case %v] Wrong text body %v. Expected: %q, Got: %q", index, i, td.textBodies[i], msg.Email.TextBody)
+			}
+		}
+	}
+}
+
+func TestMboxWriter(t *testing.T) {
+	for _, format := range []MboxFormat{MboxO, MboxRD, MboxCL, MboxCL2} {
+		buf := new(strings.Builder)
+		mw := NewMboxWriter(buf, format)
+
+		bodies := []string{"From the start\n>From quoted\nend", "second message"}
+		for i, body := range bodies {
+			e, err := NewMessage().
+				From("jdoe@machine.example").
+				Subject("message").
+				Date(time.Date(1997, 11, 21, 9, 55, 6+i, 0, time.UTC)).
+				Header("Content-Length", "1").
+				Text(body).
+				Build()
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if err := mw.Write(&MboxMessage{Email: e}); err != nil {
+				t.Fatal(err)
+			}
+		}
+
+		if !strings.HasPrefix(buf.String(), "From jdoe@machine.example Fri Nov 21 09:55:06 1997\n") {
+			t.Errorf("[Format %v] Wrong From_ line: %q", format, buf.String())
+		}
+
+		if (format == MboxCL || format == MboxCL2) && strings.Count(buf.String(), "Content-Length:") != 2 {
+			t.Errorf("[Format %v] Wrong Content-Length headers: %q", format, buf.String())
+		}
+
+		mr := NewMboxReader(strings.NewReader(buf.String()), format)
+		for i, body := range bodies {
+			msg, err := mr.Next()
+			if err != nil {
+				t.Errorf("[Format %v] %v", format, err)
+				break
+			}
+
+			expected := body
+			if format == MboxO || format == MboxCL {
+				// the quoted line can't be told apart from an escaped one
+				expected = strings.Replace(body, ">From quoted", "From quoted", 1)
+			}
+
+			if normalizeLineBreaks(msg.Email.TextBody) != normalizeLineBreaks(expected) {
+				t.Errorf("[Format %v] Wrong text body %v. Expected: %q, Got: %q", format, i, expected, msg.Email.TextBody)
+			}
+
+			if msg.EnvelopeDate.Second() != 6+i {
+				t.Errorf("[Format %v] Wrong envelope date %v: %v", format, i, msg.EnvelopeDate)
+			}
+		}
+
+		if _, err := mr.Next(); err != io.EOF {
+			t.Errorf("[Format %v] Expected EOF, got: %v", format, err)
+		}
+	}
+}
@@ -0,0 +1,259 @@
+package parsemail
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/mail"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// Outlook .msg files (MS-OXMSG) are compound files holding MAPI properties of the message
+// with storages for its recipients and attachments
+
+const (
+	msgPropertiesStream          = "__properties_version1.0"
+	msgSubstoragePrefix          = "__substg1.0_"
+	msgRecipientPrefix           = "__recip_version1.0_"
+	msgAttachmentPrefix          = "__attach_version1.0_"
+	msgTopLevelHeaderSize        = 32
+	msgEmbeddedHeaderSize        = 24
+	msgRecipientOrAttachmentSize = 8
+	msgPropertyEntrySize         = 16
+	msgMaxEmbeddingDepth         = 8
+)
+
+// ParseMsg parses an Outlook .msg file into parsemail.Email struct
+//
+// Recipients, bodies (including the compressed RTF body) and attachments are mapped onto the Email fields.
+// Embedded messages become message/rfc822 attachments. When the file holds the original transport headers,
+// the header fields are parsed from them.
+func ParseMsg(r io.Reader) (email Email, err error) {
+	data, err := ioutil.ReadAll(r)
+	if err != nil {
+		return
+	}
+
+	f, err := openCFB(data)
+	if err != nil {
+		return
+	}
+
+	return parseMsgStorage(f, f.root(), msgTopLevelHeaderSize, 0)
+}
+
+func parseMsgStorage(f *cfbFile, storage *cfbEntry, headerSize int, depth int) (email Email, err error) {
+	props, err := readMsgProperties(f, storage, headerSize)
+	if err != nil {
+		return
+	}
+
+	if headers := props.string(mapiTransportMessageHeaders); headers != "" {
+		if msg, herr := mail.ReadMessage(strings.NewReader(strings.TrimRight(headers, "\r\n") + "\r\n\r\n")); herr == nil {
+			if e, herr := createEmailFromHeader(msg.Header); herr == nil {
+				email = e
+			}
+		}
+	}
+
+	if email.Header == nil {
+		setMAPIHeaderFields(&email, props)
+
+		for _, name := range sortedChildren(storage, msgRecipientPrefix) {
+			rprops, err := readMsgProperties(f, storage.lookup(name), msgRecipientOrAttachmentSize)
+			if err != nil {
+				return email, err
+			}
+
+			a := msgAddress(rprops.string(mapiDisplayName), rprops.string(mapiSMTPAddress), rprops.string(mapiEmailAddress), rprops.string(mapiAddrType))
+			if a == nil {
+				continue
+			}
+
+			switch rprops.int(mapiRecipientType) {
+			case mapiRecipientTypeCc:
+				email.Cc = append(email.Cc, a)
+			case mapiRecipientTypeBcc:
+				email.Bcc = append(email.Bcc, a)
+			default:
+				email.To = append(email.To, a)
+			}
+		}
+	}
+
+	email.MAPIProperties = props
+	email.TextBody = props.string(mapiBody)
+	if p, ok := props[mapiHTML]; ok {
+		email.HTMLBody = strings.TrimRight(string(p.Value), "\x00")
+		if p.Type == MAPITypeUnicode {
+			email.HTMLBody = p.String()
+		}
+	}
+	if compressed := props.bytes(mapiRTFCompressed); len(compressed) > 0 {
+		if rtf, err := DecompressRTF(compressed); err == nil {
+			email.RTFBody = string(rtf)
+		}
+	}
+	setRTFBodies(&email)
+
+	for _, name := range sortedChildren(storage, msgAttachmentPrefix) {
+		if err = parseMsgAttachment(f, storage.lookup(name), &email, depth); err != nil {
+			return
+		}
+	}
+
+	return
+}
+
+func parseMsgAttachment(f *cfbFile, storage *cfbEntry, email *Email, depth int) error {
+	props, err := readMsgProperties(f, storage, msgRecipientOrAttachmentSize)
+	if err != nil {
+		return err
+	}
+
+	filename := props.string(mapiAttachLongFilename, mapiAttachFilename, mapiDisplayName)
+	contentType := props.string(mapiAttachMimeTag)
+	data := props.bytes(mapiAttachDataBin)
+
+	if props.int(mapiAttachMethod) == mapiAttachMethodEmbeddedMsg {
+		embedded := storage.lookup(fmt.Sprintf("%s%04X%04X", msgSubstoragePrefix, mapiAttachDataBin, MAPITypeObject))
+		if embedded == nil || depth >= msgMaxEmbeddingDepth {
+			return nil
+		}
+
+		inner, err := parseMsgStorage(f, embedded, msgEmbeddedHeaderSize, depth+1)
+		if err != nil {
+			return err
+		}
+
+		buf := new(bytes.Buffer)
+		if _, err := inner.WriteTo(buf); err != nil {
+			return err
+		}
+
+		if filename == "" {
+			filename = inner.Subject
+		}
+		if !strings.HasSuffix(strings.ToLower(filename), ".eml") {
+			filename += ".eml"
+		}
+		contentType, data = contentTypeMessageRFC822, buf.Bytes()
+	}
+
+	if contentType == "" {
+		contentType = contentTypeApplicationOctetStream
+	}
+
+	if cid := strings.Trim(props.string(mapiAttachContentID), "<>"); cid != "" && strings.Contains(email.HTMLBody, "cid:"+cid) {
+		email.EmbeddedFiles = append(email.EmbeddedFiles, EmbeddedFile{
+			CID:         cid,
+			ContentType: contentType,
+			Data:        bytes.NewReader(data),
+		})
+		return nil
+	}
+
+	email.Attachments = append(email.Attachments, Attachment{
+		Filename:    filename,
+		ContentType: contentType,
+		Data:        bytes.NewReader(data),
+	})
+
+	return nil
+}
+
+// readMsgProperties reads the fixed size properties from the property stream of storage and the
+// variable size ones from their substreams
+func readMsgProperties(f *cfbFile, storage *cfbEntry, headerSize int) (mapiProperties, error) {
+	props := mapiProperties{}
+
+	if stream := storage.lookup(msgPropertiesStream); stream != nil {
+		data, err := f.read(stream)
+		if err != nil {
+			return nil, err
+		}
+
+		for pos := headerSize; pos+msgPropertyEntrySize <= len(data); pos += msgPropertyEntrySize {
+			tag := binary.LittleEndian.Uint32(data[pos:])
+			p := MAPIProperty{ID: uint16(tag >> 16), Type: uint16(tag)}
+
+			// fixed size values are stored in the entry, others (including CLSIDs) in substreams
+			switch p.Type {
+			case MAPITypeInt16, MAPITypeInt32, MAPITypeBoolean, MAPITypeInt64, MAPITypeSysTime,
+				mapiTypeFloat, mapiTypeDouble, mapiTypeCurrency, mapiTypeAppTime, mapiTypeError:
+				p.Value = append([]byte{}, data[pos+8:pos+16]...)
+				props[p.ID] = p
+			}
+		}
+	}
+
+	for name, entry := range storage.children {
+		if entry.typ != cfbTypeStream || !strings.HasPrefix(name, strings.ToUpper(msgSubstoragePrefix)) {
+			continue
+		}
+
+		tag, err := strconv.ParseUint(name[len(msgSubstoragePrefix):], 16, 32)
+		if err != nil || len(name) != len(msgSubstoragePrefix)+8 {
+			continue
+		}
+
+		p := MAPIProperty{ID: uint16(tag >> 16), Type: uint16(tag)}
+		if p.Type&mapiMultiValuedFlag != 0 {
+			continue
+		}
+
+		if p.Value, err = f.read(entry); err != nil {
+			return nil, err
+		}
+		props[p.ID] = p
+	}
+
+	return props, nil
+}
+
+// setMAPIHeaderFields fills the header fields of email from the message properties
+func setMAPIHeaderFields(email *Email, props mapiProperties) {
+	email.Header = mail.Header{}
+	email.Subject = props.string(mapiSubject)
+	email.Date = props.time(mapiClientSubmitTime, mapiMessageDeliveryTime)
+	email.MessageID = strings.Trim(props.string(mapiInternetMessageID), "<> ")
+
+	hp := headerParser{}
+	email.InReplyTo = hp.parseMessageIdList(props.string(mapiInReplyToID))
+	email.References = hp.parseMessageIdList(props.string(mapiInternetReferences))
+
+	if from := msgAddress(props.string(mapiSentRepresentingName, mapiSenderName),
+		props.string(mapiSentRepresentingSMTP, mapiSenderSMTPAddress),
+		props.string(mapiSentRepresentingEmail, mapiSenderEmailAddress),
+		props.string(mapiSenderAddrType)); from != nil {
+		email.From = []*mail.Address{from}
+	}
+}
+
+// msgAddress builds an address preferring the SMTP one over Exchange distinguished names
+func msgAddress(name, smtp, address, addrType string) *mail.Address {
+	if smtp == "" && (addrType == "" || strings.EqualFold(addrType, "SMTP")) {
+		smtp = address
+	}
+
+	if smtp == "" && name == "" {
+		return nil
+	}
+
+	return &mail.Address{Name: name, Address: smtp}
+}
+
+func sortedChildren(storage *cfbEntry, prefix string) (names []string) {
+	for name, entry := range storage.children {
+		if entry.typ == cfbTypeStorage && strings.HasPrefix(name, strings.ToUpper(prefix)) {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+
+	return
+}
@@ -0,0 +1,173 @@
+package parsemail
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"io/ioutil"
+	"testing"
+	"time"
+	"unicode/utf16"
+)
+
+// compressedRTFExample is the compressed RTF example from MS-OXRTFCP
+var compressedRTFExample = []byte{
+	0x2d, 0x00, 0x00, 0x00, 0x2b, 0x00, 0x00, 0x00, 0x4c, 0x5a, 0x46, 0x75, 0xf1, 0xc5, 0xc7, 0xa7,
+	0x03, 0x00, 0x0a, 0x00, 0x72, 0x63, 0x70, 0x67, 0x31, 0x32, 0x35, 0x42, 0x32, 0x0a, 0xf3, 0x20,
+	0x68, 0x65, 0x6c, 0x09, 0x00, 0x20, 0x62, 0x77, 0x05, 0xb0, 0x6c, 0x64, 0x7d, 0x0a, 0x80, 0x0f,
+	0xa0,
+}
+
+func msgUnicode(id uint16, s string) *cfbTestNode {
+	units := utf16.Encode([]rune(s))
+	data := make([]byte, 2*len(units))
+	for i, u := range units {
+		binary.LittleEndian.PutUint16(data[2*i:], u)
+	}
+
+	return msgBinary(id, MAPITypeUnicode, data)
+}
+
+func msgBinary(id, typ uint16, data []byte) *cfbTestNode {
+	return &cfbTestNode{name: fmt.Sprintf("%s%04X%04X", msgSubstoragePrefix, id, typ), data: data}
+}
+
+// msgPropertyStream builds a property stream with the given header size holding fixed size values
+func msgPropertyStream(headerSize int, props ...MAPIProperty) *cfbTestNode {
+	data := make([]byte, headerSize)
+	for _, p := range props {
+		entry := make([]byte, msgPropertyEntrySize)
+		binary.LittleEndian.PutUint32(entry, uint32(p.ID)<<16|uint32(p.Type))
+		copy(entry[8:], p.Value)
+		data = append(data, entry...)
+	}
+
+	return &cfbTestNode{name: msgPropertiesStream, data: data}
+}
+
+func msgInt32(id uint16, v uint32) MAPIProperty {
+	b := make([]byte, 8)
+	binary.LittleEndian.PutUint32(b, v)
+	return MAPIProperty{ID: id, Type: MAPITypeInt32, Value: b}
+}
+
+func msgTime(id uint16, t time.Time) MAPIProperty {
+	b := make([]byte, 8)
+	binary.LittleEndian.PutUint64(b, uint64(t.UnixNano()/100+mapiFiletimeEpochDifference))
+	return MAPIProperty{ID: id, Type: MAPITypeSysTime, Value: b}
+}
+
+func msgRecipient(index int, name, address string, typ uint32) *cfbTestNode {
+	return &cfbTestNode{name: fmt.Sprintf("%s#%08X", msgRecipientPrefix, index), storage: true, children: []*cfbTestNode{
+		msgPropertyStream(msgRecipientOrAttachmentSize, msgInt32(mapiRecipientType, typ)),
+		msgUnicode(mapiDisplayName, name),
+		msgUnicode(mapiAddrType, "SMTP"),
+		msgUnicode(mapiEmailAddress, address),
+	}}
+}
+
+func TestParseMsg(t *testing.T) {
+	date := time.Date(2019, 4, 1, 7, 55, 0, 0, time.UTC)
+	attachment := bytes.Repeat([]byte("binary attachment data "), 300)
+
+	data := buildCFB([]*cfbTestNode{
+		msgPropertyStream(msgTopLevelHeaderSize, msgTime(mapiClientSubmitTime, date),
+			MAPIProperty{ID: 0x6001, Type: mapiTypeFloat, Value: []byte{0, 0, 0x80, 0x3F, 0, 0, 0, 0}},
+			MAPIProperty{ID: 0x6002, Type: mapiTypeDouble, Value: []byte{0, 0, 0, 0, 0, 0, 0xF0, 0x3F}},
+			MAPIProperty{ID: 0x6003, Type: mapiTypeCurrency, Value: []byte{0x10, 0x27, 0, 0, 0, 0, 0, 0}},
+			MAPIProperty{ID: 0x6004, Type: mapiTypeAppTime, Value: []byte{0, 0, 0, 0, 0, 0, 0xF0, 0x3F}},
+			MAPIProperty{ID: 0x6005, Type: mapiTypeError, Value: []byte{0x0F, 0x01, 0x04, 0x80, 0, 0, 0, 0}}),
+		msgBinary(0x6006, mapiTypeCLSID, bytes.Repeat([]byte{0xAB}, 16)),
+		msgUnicode(mapiSubject, "Quarterly report"),
+		msgUnicode(mapiSenderName, "Alice Example"),
+		msgUnicode(mapiSenderSMTPAddress, "alice@example.com"),
+		msgUnicode(mapiInternetMessageID, "<report@example.com>"),
+		msgUnicode(mapiBody, "Please find the report attached."),
+		msgBinary(mapiHTML, MAPITypeBinary, []byte(`<p>Please find the report attached.</p><img src="cid:logo@example.com">`)),
+		msgBinary(mapiRTFCompressed, MAPITypeBinary, compressedRTFExample),
+		msgRecipient(0, "Bob Example", "bob@example.com", mapiRecipientTypeTo),
+		msgRecipient(1, "Carol Example", "carol@example.com", mapiRecipientTypeCc),
+		{name: msgAttachmentPrefix + "#00000000", storage: true, children: []*cfbTestNode{
+			msgPropertyStream(msgRecipientOrAttachmentSize, msgInt32(mapiAttachMethod, 1)),
+			msgUnicode(mapiAttachLongFilename, "report.bin"),
+			msgBinary(mapiAttachDataBin, MAPITypeBinary, attachment),
+		}},
+		{name: msgAttachmentPrefix + "#00000001", storage: true, children: []*cfbTestNode{
+			msgPropertyStream(msgRecipientOrAttachmentSize, msgInt32(mapiAttachMethod, 1)),
+			msgUnicode(mapiAttachMimeTag, "image/png"),
+			msgUnicode(mapiAttachContentID, "logo@example.com"),
+			msgBinary(mapiAttachDataBin, MAPITypeBinary, []byte("png data")),
+		}},
+		{name: msgAttachmentPrefix + "#00000002", storage: true, children: []*cfbTestNode{
+			msgPropertyStream(msgRecipientOrAttachmentSize, msgInt32(mapiAttachMethod, mapiAttachMethodEmbeddedMsg)),
+			{name: fmt.Sprintf("%s%04X%04X", msgSubstoragePrefix, mapiAttachDataBin, MAPITypeObject), storage: true, children: []*cfbTestNode{
+				msgPropertyStream(msgEmbeddedHeaderSize),
+				msgUnicode(mapiTransportMessageHeaders, "From: Dave <dave@example.com>\r\nSubject: Original message\r\nDate: Mon, 01 Apr 2019 06:00:00 +0000\r\n"),
+				msgUnicode(mapiBody, "Original body"),
+			}},
+		}},
+	})
+
+	email, err := ParseMsg(bytes.NewReader(data))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if email.Subject != "Quarterly report" {
+		t.Errorf("Wrong subject. Expected: %s, Got: %s", "Quarterly report", email.Subject)
+	}
+
+	for id, typ := range map[uint16]uint16{0x6001: mapiTypeFloat, 0x6002: mapiTypeDouble, 0x6003: mapiTypeCurrency,
+		0x6004: mapiTypeAppTime, 0x6005: mapiTypeError, 0x6006: mapiTypeCLSID} {
+		if p, ok := email.MAPIProperties[id]; !ok || p.Type != typ || len(p.Value) < 8 {
+			t.Errorf("Wrong fixed size property %04X: %v", id, p)
+		}
+	}
+	if !email.Date.Equal(date) {
+		t.Errorf("Wrong date. Expected: %v, Got: %v", date, email.Date)
+	}
+	if email.MessageID != "report@example.com" {
+		t.Errorf("Wrong message id. Got: %s", email.MessageID)
+	}
+	if len(email.From) != 1 || email.From[0].String() != `"Alice Example" <alice@example.com>` {
+		t.Errorf("Wrong from: %v", email.From)
+	}
+	if len(email.To) != 1 || email.To[0].Address != "bob@example.com" {
+		t.Errorf("Wrong to: %v", email.To)
+	}
+	if len(email.Cc) != 1 || email.Cc[0].Address != "carol@example.com" {
+		t.Errorf("Wrong cc: %v", email.Cc)
+	}
+	if email.TextBody != "Please find the report attached." {
+		t.Errorf("Wrong text body: %q", email.TextBody)
+	}
+	if email.RTFBody != "{\\rtf1\\ansi\\ansicpg1252\\pard hello world}\r\n" {
+		t.Errorf("Wrong rtf body: %q", email.RTFBody)
+	}
+
+	if len(email.EmbeddedFiles) != 1 || email.EmbeddedFiles[0].CID != "logo@example.com" || email.EmbeddedFiles[0].ContentType != "image/png" {
+		t.Errorf("Wrong embedded files: %v", email.EmbeddedFiles)
+	}
+
+	if len(email.Attachments) != 2 {
+		t.Fatalf("Wrong number of attachments. Expected: 2, Got: %d", len(email.Attachments))
+	}
+
+	a := email.Attachments[0]
+	got, _ := ioutil.ReadAll(a.Data)
+	if a.Filename != "report.bin" || a.ContentType != contentTypeApplicationOctetStream || !bytes.Equal(got, attachment) {
+		t.Errorf("Wrong attachment %s (%s), %d bytes", a.Filename, a.ContentType, len(got))
+	}
+
+	a = email.Attachments[1]
+	if a.Filename != "Original message.eml" || a.ContentType != "message/rfc822" {
+		t.Errorf("Wrong embedded message attachment %s (%s)", a.Filename, a.ContentType)
+	}
+	inner, err := Parse(a.Data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if inner.Subject != "Original message" || inner.From[0].Address != "dave@example.com" || inner.TextBody != "Original body" {
+		t.Errorf("Wrong embedded message: %s from %v: %q", inner.Subject, inner.From, inner.TextBody)
+	}
+}
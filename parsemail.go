@@ -10,6 +10,7 @@ import (
 	"mime/multipart"
 	"mime/quotedprintable"
 	"net/mail"
+	"path/filepath"
 	"strings"
 	"time"
 )
@@ -18,6 +19,8 @@ const contentTypeMultipartSigned = "multipart/signed"
 const contentTypeMultipartMixed = "multipart/mixed"
 const contentTypeMultipartAlternative = "multipart/alternative"
 const contentTypeMultipartRelated = "multipart/related"
+const contentTypeMultipartDigest = "multipart/digest"
+const contentTypeMessageRFC822 = "message/rfc822"
 const contentTypeTextCalendar = "text/calendar"
 const contentTypeTextHtml = "text/html"
 const contentTypeTextPlain = "text/plain"
@@ -27,7 +30,12 @@ const maxDepthOfMultipartMixed = 3
 
 // Parse an email message read from io.Reader into parsemail.Email struct
 func Parse(r io.Reader) (email Email, err error) {
-	msg, err := mail.ReadMessage(r)
+	raw, err := ioutil.ReadAll(r)
+	if err != nil {
+		return
+	}
+
+	msg, err := mail.ReadMessage(bytes.NewReader(raw))
 	if err != nil {
 		return
 	}
@@ -37,6 +45,8 @@ func Parse(r io.Reader) (email Email, err error) {
 		return
 	}
 
+	email.RawHeaders, _ = parseRawHeaders(raw)
+
 	email.ContentType = msg.Header.Get("Content-Type")
 	contentType, params, err := parseContentType(email.ContentType)
 	if err != nil {
@@ -45,13 +55,19 @@ func Parse(r io.Reader) (email Email, err error) {
 
 	switch contentType {
 	case contentTypeMultipartSigned:
-		email.TextBody, email.HTMLBody, email.Attachments, email.EmbeddedFiles, email.TextBodies, email.HTMLBodies, err = parseMultipartMixed(msg.Body, params["boundary"], 1)
+		email.TextBody, email.HTMLBody, email.Attachments, email.EmbeddedFiles, email.TextBodies, email.HTMLBodies, email.AlternativeBodies, email.Digest, email.ExternalBodies, err = parseMultipartMixed(msg.Body, params["boundary"], 1)
 	case contentTypeMultipartMixed:
-		email.TextBody, email.HTMLBody, email.Attachments, email.EmbeddedFiles, email.TextBodies, email.HTMLBodies, err = parseMultipartMixed(msg.Body, params["boundary"], 1)
+		email.TextBody, email.HTMLBody, email.Attachments, email.EmbeddedFiles, email.TextBodies, email.HTMLBodies, email.AlternativeBodies, email.Digest, email.ExternalBodies, err = parseMultipartMixed(msg.Body, params["boundary"], 1)
 	case contentTypeMultipartAlternative:
-		email.TextBody, email.HTMLBody, email.Attachments, email.EmbeddedFiles, email.TextBodies, email.HTMLBodies, err = parseMultipartAlternative(msg.Body, params["boundary"])
+		email.TextBody, email.HTMLBody, email.Attachments, email.EmbeddedFiles, email.TextBodies, email.HTMLBodies, email.AlternativeBodies, email.Digest, email.ExternalBodies, err = parseMultipartAlternative(msg.Body, params["boundary"])
 	case contentTypeMultipartRelated:
-		email.TextBody, email.HTMLBody, email.Attachments, email.EmbeddedFiles, email.TextBodies, email.HTMLBodies, err = parseMultipartRelated(msg.Body, params["boundary"])
+		email.TextBody, email.HTMLBody, email.Attachments, email.EmbeddedFiles, email.TextBodies, email.HTMLBodies, email.AlternativeBodies, email.Digest, email.ExternalBodies, err = parseMultipartRelated(msg.Body, params["boundary"])
+	case contentTypeMultipartDigest:
+		email.Digest, email.Attachments, err = parseMultipartDigest(msg.Body, params["boundary"])
+	case contentTypeMessageExternalBody:
+		var eb ExternalBody
+		eb, err = parseExternalBody(msg.Body, params)
+		email.ExternalBodies = []ExternalBody{eb}
 	case contentTypeTextPlain:
 		buf := new(bytes.Buffer)
 		tee := io.TeeReader(msg.Body, buf)
@@ -93,6 +109,65 @@ func Parse(r io.Reader) (email Email, err error) {
 	default:
 		email.Content, err = decodeContent(msg.Body, msg.Header.Get("Content-Transfer-Encoding"))
 	}
+	if err != nil {
+		return
+	}
+
+	email.Calendar = findCalendar(&email)
+	email.Contacts = findContacts(&email)
+	email.source = newSourceMessage(raw, &email)
+
+	return
+}
+
+// ParseOptions enable optional decoding steps of ParseWithOptions
+type ParseOptions struct {
+	// DecodeTNEF replaces winmail.dat attachments with the attachments they contain and fills
+	// the bodies and MAPI properties of the email from them
+	DecodeTNEF bool
+	// DecodeUUEncoded adds the uuencoded and yEncoded files found in the text bodies to the attachments,
+	// TextBody is then rebuilt from the decoded text bodies
+	DecodeUUEncoded bool
+	// StripUUEncoded removes the decoded files from TextBody and TextBodies
+	StripUUEncoded bool
+	// DecodeFlowed joins the soft broken lines of format=flowed text bodies (RFC 3676), TextBody and
+	// TextBodies then hold the decoded text
+	DecodeFlowed bool
+	// TextFromHTML fills TextBody with the text rendering of the HTML body when the email has no text body
+	TextFromHTML bool
+}
+
+// ParseWithOptions parses an email message like Parse and then applies the decoding steps enabled in opts
+func ParseWithOptions(r io.Reader, opts ParseOptions) (email Email, err error) {
+	email, err = Parse(r)
+	if err != nil {
+		return
+	}
+
+	if opts.DecodeTNEF {
+		if err = decodeTNEFAttachments(&email); err != nil {
+			return
+		}
+	}
+
+	// encoded files go first, flowed decoding would join their lines ending with a space
+	if opts.DecodeUUEncoded {
+		if err = decodeEncodedFiles(&email, opts.StripUUEncoded); err != nil {
+			return
+		}
+	}
+
+	if opts.DecodeFlowed {
+		if err = decodeFlowedBodies(&email); err != nil {
+			return
+		}
+	}
+
+	if opts.TextFromHTML {
+		if err = fillTextBody(&email); err != nil {
+			return
+		}
+	}
 
 	return
 }
@@ -143,7 +218,7 @@ func parseContentType(contentTypeHeader string) (contentType string, params map[
 	return mime.ParseMediaType(contentTypeHeader)
 }
 
-func parseMultipartRelated(msg io.Reader, boundary string) (textBody, htmlBody string, attachments []Attachment, embeddedFiles []EmbeddedFile, textBodies []*TextBody, htmlBodies []*HTMLBody, err error) {
+func parseMultipartRelated(msg io.Reader, boundary string) (textBody, htmlBody string, attachments []Attachment, embeddedFiles []EmbeddedFile, textBodies []*TextBody, htmlBodies []*HTMLBody, alternativeBodies []*AlternativeBody, digest []*Email, externalBodies []ExternalBody, err error) {
 	pmr := multipart.NewReader(msg, boundary)
 	for {
 		part, err := NextPart(pmr)
@@ -151,24 +226,24 @@ func parseMultipartRelated(msg io.Reader, boundary string) (textBody, htmlBody s
 		if err == io.EOF {
 			break
 		} else if err != nil {
-			return textBody, htmlBody, attachments, embeddedFiles, textBodies, htmlBodies, err
+			return textBody, htmlBody, attachments, embeddedFiles, textBodies, htmlBodies, alternativeBodies, digest, externalBodies, err
 		}
 
 		contentType, params := part.contentType, part.contentTypeParams
 		if err != nil {
-			return textBody, htmlBody, attachments, embeddedFiles, textBodies, htmlBodies, err
+			return textBody, htmlBody, attachments, embeddedFiles, textBodies, htmlBodies, alternativeBodies, digest, externalBodies, err
 		}
 
 		switch contentType {
 		case contentTypeTextPlain:
 			ppContent, err := ioutil.ReadAll(part.tee)
 			if err != nil {
-				return textBody, htmlBody, attachments, embeddedFiles, textBodies, htmlBodies, err
+				return textBody, htmlBody, attachments, embeddedFiles, textBodies, htmlBodies, alternativeBodies, digest, externalBodies, err
 			}
 			textBody += strings.TrimSuffix(string(ppContent[:]), "\n")
 			b, err := part.newBody()
 			if err != nil {
-				return textBody, htmlBody, attachments, embeddedFiles, textBodies, htmlBodies, err
+				return textBody, htmlBody, attachments, embeddedFiles, textBodies, htmlBodies, alternativeBodies, digest, externalBodies, err
 			}
 			textBodies = append(textBodies, &TextBody{
 				Body: *b,
@@ -176,13 +251,13 @@ func parseMultipartRelated(msg io.Reader, boundary string) (textBody, htmlBody s
 		case contentTypeTextHtml:
 			ppContent, err := ioutil.ReadAll(part.tee)
 			if err != nil {
-				return textBody, htmlBody, attachments, embeddedFiles, textBodies, htmlBodies, err
+				return textBody, htmlBody, attachments, embeddedFiles, textBodies, htmlBodies, alternativeBodies, digest, externalBodies, err
 			}
 
 			htmlBody += strings.TrimSuffix(string(ppContent[:]), "\n")
 			b, err := part.newBody()
 			if err != nil {
-				return textBody, htmlBody, attachments, embeddedFiles, textBodies, htmlBodies, err
+				return textBody, htmlBody, attachments, embeddedFiles, textBodies, htmlBodies, alternativeBodies, digest, externalBodies, err
 			}
 			htmlBodies = append(htmlBodies, &HTMLBody{
 				Body: *b,
@@ -190,13 +265,25 @@ func parseMultipartRelated(msg io.Reader, boundary string) (textBody, htmlBody s
 		case contentTypeTextCalendar:
 			ef, err := decodeEmbeddedFile(part)
 			if err != nil {
-				return textBody, htmlBody, attachments, embeddedFiles, textBodies, htmlBodies, err
+				return textBody, htmlBody, attachments, embeddedFiles, textBodies, htmlBodies, alternativeBodies, digest, externalBodies, err
 			}
 			embeddedFiles = append(embeddedFiles, ef)
+		case contentTypeMessageExternalBody:
+			eb, err := parseExternalBody(part, params)
+			if err != nil {
+				return textBody, htmlBody, attachments, embeddedFiles, textBodies, htmlBodies, alternativeBodies, digest, externalBodies, err
+			}
+			externalBodies = append(externalBodies, eb)
+		case contentTypeTextVCard, contentTypeTextXVCard, contentTypeTextDirectory:
+			at, err := decodeAttachment(part)
+			if err != nil {
+				return textBody, htmlBody, attachments, embeddedFiles, textBodies, htmlBodies, alternativeBodies, digest, externalBodies, err
+			}
+			attachments = append(attachments, at)
 		case contentTypeMultipartAlternative:
-			tb, hb, af, ef, tbs, hbs, err := parseMultipartAlternative(part, params["boundary"])
+			tb, hb, af, ef, tbs, hbs, abs, msgs, ebs, err := parseMultipartAlternative(part, params["boundary"])
 			if err != nil {
-				return textBody, htmlBody, attachments, embeddedFiles, textBodies, htmlBodies, err
+				return textBody, htmlBody, attachments, embeddedFiles, textBodies, htmlBodies, alternativeBodies, digest, externalBodies, err
 			}
 			htmlBody += hb
 			textBody += tb
@@ -204,24 +291,27 @@ func parseMultipartRelated(msg io.Reader, boundary string) (textBody, htmlBody s
 			embeddedFiles = append(embeddedFiles, ef...)
 			textBodies = append(textBodies, tbs...)
 			htmlBodies = append(htmlBodies, hbs...)
+			alternativeBodies = append(alternativeBodies, abs...)
+			digest = append(digest, msgs...)
+			externalBodies = append(externalBodies, ebs...)
 		default:
 			if isEmbeddedFile(part) {
 				ef, err := decodeEmbeddedFile(part)
 				if err != nil {
-					return textBody, htmlBody, attachments, embeddedFiles, textBodies, htmlBodies, err
+					return textBody, htmlBody, attachments, embeddedFiles, textBodies, htmlBodies, alternativeBodies, digest, externalBodies, err
 				}
 
 				embeddedFiles = append(embeddedFiles, ef)
 			} else {
-				return textBody, htmlBody, attachments, embeddedFiles, textBodies, htmlBodies, fmt.Errorf("Can't process multipart/related inner mime type: %s", contentType)
+				return textBody, htmlBody, attachments, embeddedFiles, textBodies, htmlBodies, alternativeBodies, digest, externalBodies, fmt.Errorf("Can't process multipart/related inner mime type: %s", contentType)
 			}
 		}
 	}
 
-	return textBody, htmlBody, attachments, embeddedFiles, textBodies, htmlBodies, err
+	return textBody, htmlBody, attachments, embeddedFiles, textBodies, htmlBodies, alternativeBodies, digest, externalBodies, err
 }
 
-func parseMultipartAlternative(msg io.Reader, boundary string) (textBody, htmlBody string, attachments []Attachment, embeddedFiles []EmbeddedFile, textBodies []*TextBody, htmlBodies []*HTMLBody, err error) {
+func parseMultipartAlternative(msg io.Reader, boundary string) (textBody, htmlBody string, attachments []Attachment, embeddedFiles []EmbeddedFile, textBodies []*TextBody, htmlBodies []*HTMLBody, alternativeBodies []*AlternativeBody, digest []*Email, externalBodies []ExternalBody, err error) {
 	pmr := multipart.NewReader(msg, boundary)
 	for {
 		part, err := NextPart(pmr)
@@ -229,24 +319,24 @@ func parseMultipartAlternative(msg io.Reader, boundary string) (textBody, htmlBo
 		if err == io.EOF {
 			break
 		} else if err != nil {
-			return textBody, htmlBody, attachments, embeddedFiles, textBodies, htmlBodies, err
+			return textBody, htmlBody, attachments, embeddedFiles, textBodies, htmlBodies, alternativeBodies, digest, externalBodies, err
 		}
 
 		contentType, params := part.contentType, part.contentTypeParams
 		if err != nil {
-			return textBody, htmlBody, attachments, embeddedFiles, textBodies, htmlBodies, err
+			return textBody, htmlBody, attachments, embeddedFiles, textBodies, htmlBodies, alternativeBodies, digest, externalBodies, err
 		}
 
 		switch contentType {
 		case contentTypeTextPlain:
 			ppContent, err := ioutil.ReadAll(part.tee)
 			if err != nil {
-				return textBody, htmlBody, attachments, embeddedFiles, textBodies, htmlBodies, err
+				return textBody, htmlBody, attachments, embeddedFiles, textBodies, htmlBodies, alternativeBodies, digest, externalBodies, err
 			}
 			textBody += strings.TrimSuffix(string(ppContent[:]), "\n")
 			b, err := part.newBody()
 			if err != nil {
-				return textBody, htmlBody, attachments, embeddedFiles, textBodies, htmlBodies, err
+				return textBody, htmlBody, attachments, embeddedFiles, textBodies, htmlBodies, alternativeBodies, digest, externalBodies, err
 			}
 			textBodies = append(textBodies, &TextBody{
 				Body: *b,
@@ -254,12 +344,12 @@ func parseMultipartAlternative(msg io.Reader, boundary string) (textBody, htmlBo
 		case contentTypeTextHtml:
 			ppContent, err := ioutil.ReadAll(part.tee)
 			if err != nil {
-				return textBody, htmlBody, attachments, embeddedFiles, textBodies, htmlBodies, err
+				return textBody, htmlBody, attachments, embeddedFiles, textBodies, htmlBodies, alternativeBodies, digest, externalBodies, err
 			}
 			htmlBody += strings.TrimSuffix(string(ppContent[:]), "\n")
 			b, err := part.newBody()
 			if err != nil {
-				return textBody, htmlBody, attachments, embeddedFiles, textBodies, htmlBodies, err
+				return textBody, htmlBody, attachments, embeddedFiles, textBodies, htmlBodies, alternativeBodies, digest, externalBodies, err
 			}
 			htmlBodies = append(htmlBodies, &HTMLBody{
 				Body: *b,
@@ -267,13 +357,25 @@ func parseMultipartAlternative(msg io.Reader, boundary string) (textBody, htmlBo
 		case contentTypeTextCalendar:
 			ef, err := decodeEmbeddedFile(part)
 			if err != nil {
-				return textBody, htmlBody, attachments, embeddedFiles, textBodies, htmlBodies, err
+				return textBody, htmlBody, attachments, embeddedFiles, textBodies, htmlBodies, alternativeBodies, digest, externalBodies, err
 			}
 			embeddedFiles = append(embeddedFiles, ef)
+		case contentTypeMessageExternalBody:
+			eb, err := parseExternalBody(part, params)
+			if err != nil {
+				return textBody, htmlBody, attachments, embeddedFiles, textBodies, htmlBodies, alternativeBodies, digest, externalBodies, err
+			}
+			externalBodies = append(externalBodies, eb)
+		case contentTypeTextVCard, contentTypeTextXVCard, contentTypeTextDirectory:
+			at, err := decodeAttachment(part)
+			if err != nil {
+				return textBody, htmlBody, attachments, embeddedFiles, textBodies, htmlBodies, alternativeBodies, digest, externalBodies, err
+			}
+			attachments = append(attachments, at)
 		case contentTypeMultipartRelated:
-			tb, hb, af, ef, tbs, hbs, err := parseMultipartRelated(part, params["boundary"])
+			tb, hb, af, ef, tbs, hbs, abs, msgs, ebs, err := parseMultipartRelated(part, params["boundary"])
 			if err != nil {
-				return textBody, htmlBody, attachments, embeddedFiles, textBodies, htmlBodies, err
+				return textBody, htmlBody, attachments, embeddedFiles, textBodies, htmlBodies, alternativeBodies, digest, externalBodies, err
 			}
 			htmlBody += hb
 			textBody += tb
@@ -281,10 +383,13 @@ func parseMultipartAlternative(msg io.Reader, boundary string) (textBody, htmlBo
 			embeddedFiles = append(embeddedFiles, ef...)
 			textBodies = append(textBodies, tbs...)
 			htmlBodies = append(htmlBodies, hbs...)
+			alternativeBodies = append(alternativeBodies, abs...)
+			digest = append(digest, msgs...)
+			externalBodies = append(externalBodies, ebs...)
 		case contentTypeMultipartMixed:
-			tb, hb, at, ef, tbs, hbs, err := parseMultipartMixed(part, params["boundary"], 1)
+			tb, hb, at, ef, tbs, hbs, abs, msgs, ebs, err := parseMultipartMixed(part, params["boundary"], 1)
 			if err != nil {
-				return textBody, htmlBody, attachments, embeddedFiles, textBodies, htmlBodies, err
+				return textBody, htmlBody, attachments, embeddedFiles, textBodies, htmlBodies, alternativeBodies, digest, externalBodies, err
 			}
 			htmlBody += hb
 			textBody += tb
@@ -292,29 +397,42 @@ func parseMultipartAlternative(msg io.Reader, boundary string) (textBody, htmlBo
 			embeddedFiles = append(embeddedFiles, ef...)
 			textBodies = append(textBodies, tbs...)
 			htmlBodies = append(htmlBodies, hbs...)
+			alternativeBodies = append(alternativeBodies, abs...)
+			digest = append(digest, msgs...)
+			externalBodies = append(externalBodies, ebs...)
 		default:
 			if strings.HasPrefix(contentType, contentTypeTextExtension) {
+				if _, err := ioutil.ReadAll(part.tee); err != nil {
+					return textBody, htmlBody, attachments, embeddedFiles, textBodies, htmlBodies, alternativeBodies, digest, externalBodies, err
+				}
+				b, err := part.newBody()
+				if err != nil {
+					return textBody, htmlBody, attachments, embeddedFiles, textBodies, htmlBodies, alternativeBodies, digest, externalBodies, err
+				}
+				alternativeBodies = append(alternativeBodies, &AlternativeBody{
+					Body: *b,
+				})
 				continue
 			}
 			if isEmbeddedFile(part) {
 				ef, err := decodeEmbeddedFile(part)
 				if err != nil {
-					return textBody, htmlBody, attachments, embeddedFiles, textBodies, htmlBodies, err
+					return textBody, htmlBody, attachments, embeddedFiles, textBodies, htmlBodies, alternativeBodies, digest, externalBodies, err
 				}
 
 				embeddedFiles = append(embeddedFiles, ef)
 			} else {
-				return textBody, htmlBody, attachments, embeddedFiles, textBodies, htmlBodies, fmt.Errorf("Can't process multipart/alternative inner mime type: %s", contentType)
+				return textBody, htmlBody, attachments, embeddedFiles, textBodies, htmlBodies, alternativeBodies, digest, externalBodies, fmt.Errorf("Can't process multipart/alternative inner mime type: %s", contentType)
 			}
 		}
 	}
 
-	return textBody, htmlBody, attachments, embeddedFiles, textBodies, htmlBodies, err
+	return textBody, htmlBody, attachments, embeddedFiles, textBodies, htmlBodies, alternativeBodies, digest, externalBodies, err
 }
 
-func parseMultipartMixed(msg io.Reader, boundary string, depth int) (textBody, htmlBody string, attachments []Attachment, embeddedFiles []EmbeddedFile, textBodies []*TextBody, htmlBodies []*HTMLBody, err error) {
+func parseMultipartMixed(msg io.Reader, boundary string, depth int) (textBody, htmlBody string, attachments []Attachment, embeddedFiles []EmbeddedFile, textBodies []*TextBody, htmlBodies []*HTMLBody, alternativeBodies []*AlternativeBody, digest []*Email, externalBodies []ExternalBody, err error) {
 	if depth > maxDepthOfMultipartMixed {
-		return textBody, htmlBody, attachments, embeddedFiles, textBodies, htmlBodies, fmt.Errorf("nested multiple/mixed above max depth")
+		return textBody, htmlBody, attachments, embeddedFiles, textBodies, htmlBodies, alternativeBodies, digest, externalBodies, fmt.Errorf("nested multiple/mixed above max depth")
 	}
 	mr := multipart.NewReader(msg, boundary)
 	for {
@@ -322,24 +440,32 @@ func parseMultipartMixed(msg io.Reader, boundary string, depth int) (textBody, h
 		if err == io.EOF {
 			break
 		} else if err != nil {
-			return textBody, htmlBody, attachments, embeddedFiles, textBodies, htmlBodies, err
+			return textBody, htmlBody, attachments, embeddedFiles, textBodies, htmlBodies, alternativeBodies, digest, externalBodies, err
+		}
+		if isAppleFile(part) {
+			at, err := decodeAppleFileAttachment(part)
+			if err != nil {
+				return textBody, htmlBody, attachments, embeddedFiles, textBodies, htmlBodies, alternativeBodies, digest, externalBodies, err
+			}
+			attachments = append(attachments, at)
+			continue
 		}
 		if isAttachment(part) {
 			at, err := decodeAttachment(part)
 			if err != nil {
-				return textBody, htmlBody, attachments, embeddedFiles, textBodies, htmlBodies, err
+				return textBody, htmlBody, attachments, embeddedFiles, textBodies, htmlBodies, alternativeBodies, digest, externalBodies, err
 			}
 			attachments = append(attachments, at)
 			continue
 		}
 		contentType, params := part.contentType, part.contentTypeParams
 		if err != nil {
-			return textBody, htmlBody, attachments, embeddedFiles, textBodies, htmlBodies, err
+			return textBody, htmlBody, attachments, embeddedFiles, textBodies, htmlBodies, alternativeBodies, digest, externalBodies, err
 		}
 		if contentType == contentTypeMultipartAlternative {
-			tb, hb, ats, efs, tbs, hbs, err := parseMultipartAlternative(part, params["boundary"])
+			tb, hb, ats, efs, tbs, hbs, abs, msgs, ebs, err := parseMultipartAlternative(part, params["boundary"])
 			if err != nil {
-				return textBody, htmlBody, attachments, embeddedFiles, textBodies, htmlBodies, err
+				return textBody, htmlBody, attachments, embeddedFiles, textBodies, htmlBodies, alternativeBodies, digest, externalBodies, err
 			}
 			textBody += tb
 			htmlBody += hb
@@ -347,10 +473,13 @@ func parseMultipartMixed(msg io.Reader, boundary string, depth int) (textBody, h
 			embeddedFiles = append(embeddedFiles, efs...)
 			textBodies = append(textBodies, tbs...)
 			htmlBodies = append(htmlBodies, hbs...)
+			alternativeBodies = append(alternativeBodies, abs...)
+			digest = append(digest, msgs...)
+			externalBodies = append(externalBodies, ebs...)
 		} else if contentType == contentTypeMultipartRelated {
-			tb, hb, ats, efs, tbs, hbs, err := parseMultipartRelated(part, params["boundary"])
+			tb, hb, ats, efs, tbs, hbs, abs, msgs, ebs, err := parseMultipartRelated(part, params["boundary"])
 			if err != nil {
-				return textBody, htmlBody, attachments, embeddedFiles, textBodies, htmlBodies, err
+				return textBody, htmlBody, attachments, embeddedFiles, textBodies, htmlBodies, alternativeBodies, digest, externalBodies, err
 			}
 			textBody += tb
 			htmlBody += hb
@@ -358,26 +487,45 @@ func parseMultipartMixed(msg io.Reader, boundary string, depth int) (textBody, h
 			embeddedFiles = append(embeddedFiles, efs...)
 			textBodies = append(textBodies, tbs...)
 			htmlBodies = append(htmlBodies, hbs...)
+			alternativeBodies = append(alternativeBodies, abs...)
+			digest = append(digest, msgs...)
+			externalBodies = append(externalBodies, ebs...)
 		} else if contentType == contentTypeMultipartMixed {
-			tb, hb, ats, efs, tbs, hbs, err := parseMultipartMixed(part, params["boundary"], depth+1)
+			tb, hb, ats, efs, tbs, hbs, abs, msgs, ebs, err := parseMultipartMixed(part, params["boundary"], depth+1)
 			if err != nil {
-				return textBody, htmlBody, attachments, embeddedFiles, textBodies, htmlBodies, err
+				return textBody, htmlBody, attachments, embeddedFiles, textBodies, htmlBodies, alternativeBodies, digest, externalBodies, err
 			}
+			digest = append(digest, msgs...)
+			externalBodies = append(externalBodies, ebs...)
 			textBody += tb
 			hb += hb
 			attachments = append(attachments, ats...)
 			embeddedFiles = append(embeddedFiles, efs...)
 			textBodies = append(textBodies, tbs...)
 			htmlBodies = append(htmlBodies, hbs...)
+			alternativeBodies = append(alternativeBodies, abs...)
+		} else if contentType == contentTypeMultipartDigest {
+			msgs, ats, err := parseMultipartDigest(part, params["boundary"])
+			if err != nil {
+				return textBody, htmlBody, attachments, embeddedFiles, textBodies, htmlBodies, alternativeBodies, digest, externalBodies, err
+			}
+			digest = append(digest, msgs...)
+			attachments = append(attachments, ats...)
+		} else if contentType == contentTypeMessageExternalBody {
+			eb, err := parseExternalBody(part, params)
+			if err != nil {
+				return textBody, htmlBody, attachments, embeddedFiles, textBodies, htmlBodies, alternativeBodies, digest, externalBodies, err
+			}
+			externalBodies = append(externalBodies, eb)
 		} else if contentType == contentTypeTextPlain {
 			ppContent, err := ioutil.ReadAll(part.tee)
 			if err != nil {
-				return textBody, htmlBody, attachments, embeddedFiles, textBodies, htmlBodies, err
+				return textBody, htmlBody, attachments, embeddedFiles, textBodies, htmlBodies, alternativeBodies, digest, externalBodies, err
 			}
 			textBody += strings.TrimSuffix(string(ppContent[:]), "\n")
 			b, err := part.newBody()
 			if err != nil {
-				return textBody, htmlBody, attachments, embeddedFiles, textBodies, htmlBodies, err
+				return textBody, htmlBody, attachments, embeddedFiles, textBodies, htmlBodies, alternativeBodies, digest, externalBodies, err
 			}
 			textBodies = append(textBodies, &TextBody{
 				Body: *b,
@@ -385,12 +533,12 @@ func parseMultipartMixed(msg io.Reader, boundary string, depth int) (textBody, h
 		} else if contentType == contentTypeTextHtml {
 			ppContent, err := ioutil.ReadAll(part.tee)
 			if err != nil {
-				return textBody, htmlBody, attachments, embeddedFiles, textBodies, htmlBodies, err
+				return textBody, htmlBody, attachments, embeddedFiles, textBodies, htmlBodies, alternativeBodies, digest, externalBodies, err
 			}
 			htmlBody += strings.TrimSuffix(string(ppContent[:]), "\n")
 			b, err := part.newBody()
 			if err != nil {
-				return textBody, htmlBody, attachments, embeddedFiles, textBodies, htmlBodies, err
+				return textBody, htmlBody, attachments, embeddedFiles, textBodies, htmlBodies, alternativeBodies, digest, externalBodies, err
 			}
 			htmlBodies = append(htmlBodies, &HTMLBody{
 				Body: *b,
@@ -398,13 +546,19 @@ func parseMultipartMixed(msg io.Reader, boundary string, depth int) (textBody, h
 		} else if contentType == contentTypeTextCalendar {
 			ef, err := decodeEmbeddedFile(part)
 			if err != nil {
-				return textBody, htmlBody, attachments, embeddedFiles, textBodies, htmlBodies, err
+				return textBody, htmlBody, attachments, embeddedFiles, textBodies, htmlBodies, alternativeBodies, digest, externalBodies, err
 			}
 			embeddedFiles = append(embeddedFiles, ef)
+		} else if isVCard(contentType) {
+			at, err := decodeAttachment(part)
+			if err != nil {
+				return textBody, htmlBody, attachments, embeddedFiles, textBodies, htmlBodies, alternativeBodies, digest, externalBodies, err
+			}
+			attachments = append(attachments, at)
 		} else if contentType == contentTypeApplicationOctetStream {
 			at, err := decodeAttachment(part)
 			if err != nil {
-				return textBody, htmlBody, attachments, embeddedFiles, textBodies, htmlBodies, err
+				return textBody, htmlBody, attachments, embeddedFiles, textBodies, htmlBodies, alternativeBodies, digest, externalBodies, err
 			}
 			if at.Filename == "" {
 				if name, ok := params["name"]; ok {
@@ -413,11 +567,11 @@ func parseMultipartMixed(msg io.Reader, boundary string, depth int) (textBody, h
 			}
 			attachments = append(attachments, at)
 		} else {
-			return textBody, htmlBody, attachments, embeddedFiles, textBodies, htmlBodies, fmt.Errorf("Unknown multipart/mixed nested mime type: %s", contentType)
+			return textBody, htmlBody, attachments, embeddedFiles, textBodies, htmlBodies, alternativeBodies, digest, externalBodies, fmt.Errorf("Unknown multipart/mixed nested mime type: %s", contentType)
 		}
 	}
 
-	return textBody, htmlBody, attachments, embeddedFiles, textBodies, htmlBodies, err
+	return textBody, htmlBody, attachments, embeddedFiles, textBodies, htmlBodies, alternativeBodies, digest, externalBodies, err
 }
 
 func decodeMimeSentence(s string) string {
@@ -498,6 +652,15 @@ func decodeAttachment(part *Part) (at Attachment, err error) {
 	return
 }
 
+// contentTypeByFilename guesses the content type of decoded files from their extension
+func contentTypeByFilename(filename string) string {
+	if t := mime.TypeByExtension(filepath.Ext(filename)); t != "" {
+		return strings.Split(t, ";")[0]
+	}
+
+	return contentTypeApplicationOctetStream
+}
+
 func decodeContent(content io.Reader, encoding string) (io.Reader, error) {
 	switch strings.ToLower(encoding) {
 	case "quoted-printable":
@@ -507,7 +670,7 @@ func decodeContent(content io.Reader, encoding string) (io.Reader, error) {
 		if err != nil {
 			return nil, err
 		}
-		return out, nil
+		return bytes.NewReader(out.Bytes()), nil
 	case "base64":
 		decoded := base64.NewDecoder(base64.StdEncoding, content)
 		b, err := ioutil.ReadAll(decoded)
@@ -609,6 +772,8 @@ type Attachment struct {
 	Filename    string
 	ContentType string
 	Data        io.Reader
+	// AppleFile holds the resource fork and Finder metadata of Macintosh files, Data is their data fork
+	AppleFile *AppleFileInfo
 }
 
 // EmbeddedFile with content id, content type and data (as a io.Reader)
@@ -622,6 +787,9 @@ type EmbeddedFile struct {
 type Email struct {
 	Header mail.Header
 
+	// RawHeaders keeps every header field in its original order, including duplicates and folding
+	RawHeaders []HeaderField
+
 	Subject    string
 	Sender     *mail.Address
 	From       []*mail.Address
@@ -647,12 +815,30 @@ type Email struct {
 
 	HTMLBody string
 	TextBody string
+	// RTFBody holds the decompressed rich text body of Outlook messages
+	RTFBody string
 
 	Attachments   []Attachment
 	EmbeddedFiles []EmbeddedFile
 
+	// Digest holds the messages of a multipart/digest body
+	Digest []*Email
+	// ExternalBodies describe the message/external-body parts, whose content is stored elsewhere
+	ExternalBodies []ExternalBody
+	// Calendar is the iCalendar object of the first text/calendar part, e.g. a meeting invitation
+	Calendar *Calendar
+	// Contacts holds the vCards of the text/vcard parts and .vcf attachments
+	Contacts []*Contact
+
 	HTMLBodies []*HTMLBody
 	TextBodies []*TextBody
+	// AlternativeBodies holds the text/x-* alternatives of the bodies, e.g. AMP for Email (text/x-amp-html)
+	AlternativeBodies []*AlternativeBody
+
+	// MAPIProperties holds the message properties of Outlook messages and decoded TNEF attachments
+	MAPIProperties map[uint16]MAPIProperty
+
+	source *sourceMessage
 }
 
 type Body struct {
@@ -669,6 +855,12 @@ type TextBody struct {
 	Body
 }
 
+// AlternativeBody is an alternative of the text and HTML bodies in a vendor specific text/x-* format,
+// e.g. AMP for Email (text/x-amp-html)
+type AlternativeBody struct {
+	Body
+}
+
 type Part struct {
 	*multipart.Part
 	contentType              string
@@ -648,6 +648,104 @@ So, "Hello".`,
 	}
 }
 
+func TestParseAlternativeBodies(t *testing.T) {
+	var testData = map[int]struct {
+		mailData     string
+		contentTypes []string
+		contents     []string
+		htmlBody     string
+	}{
+		1: {
+			mailData:     ampAlternativeExample,
+			contentTypes: []string{"text/x-amp-html"},
+			contents:     []string{"<!doctype html><html ⚡4email><body>Hello AMP</body></html>"},
+			htmlBody:     "<p>Hello HTML</p>",
+		},
+		2: {
+			mailData: `From: a@example.com
+To: b@example.com
+Subject: Watch
+MIME-Version: 1.0
+Content-Type: multipart/mixed; boundary="m1"
+
+--m1
+Content-Type: multipart/alternative; boundary="a1"
+
+--a1
+Content-Type: text/plain
+
+Hello
+--a1
+Content-Type: text/x-watch-html; charset=utf-8
+Content-Transfer-Encoding: quoted-printable
+
+<b>Hello=20watch</b>
+--a1--
+--m1--
+`,
+			contentTypes: []string{"text/x-watch-html"},
+			contents:     []string{"<b>Hello watch</b>"},
+		},
+	}
+
+	for index, td := range testData {
+		e, err := Parse(strings.NewReader(td.mailData))
+		if err != nil {
+			t.Errorf("[Test Case %v] Unexpected error: %v", index, err)
+			continue
+		}
+
+		if e.HTMLBody != td.htmlBody {
+			t.Errorf("[Test Case %v] Wrong html body. Expected: %q, Got: %q", index, td.htmlBody, e.HTMLBody)
+		}
+
+		if len(e.AlternativeBodies) != len(td.contentTypes) {
+			t.Errorf("[Test Case %v] Wrong number of alternative bodies. Expected: %v, Got: %v", index, len(td.contentTypes), len(e.AlternativeBodies))
+			continue
+		}
+		for i, ab := range e.AlternativeBodies {
+			if ab.ContentType != td.contentTypes[i] {
+				t.Errorf("[Test Case %v] Wrong content type. Expected: %q, Got: %q", index, td.contentTypes[i], ab.ContentType)
+			}
+			content, err := ioutil.ReadAll(ab.Data)
+			if err != nil {
+				t.Errorf("[Test Case %v] Unexpected error: %v", index, err)
+			}
+			if string(content) != td.contents[i] {
+				t.Errorf("[Test Case %v] Wrong content. Expected: %q, Got: %q", index, td.contents[i], content)
+			}
+		}
+	}
+}
+
+func TestWriteAlternativeBodies(t *testing.T) {
+	e, err := Parse(strings.NewReader(ampAlternativeExample))
+	if err != nil {
+		t.Fatal(err)
+	}
+	e.Subject = "Changed"
+
+	buf := new(strings.Builder)
+	if _, err := e.WriteTo(buf); err != nil {
+		t.Fatal(err)
+	}
+
+	rewritten, err := Parse(strings.NewReader(buf.String()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(rewritten.AlternativeBodies) != 1 || rewritten.AlternativeBodies[0].ContentType != "text/x-amp-html" {
+		t.Fatalf("AMP alternative not written: %+v", rewritten.AlternativeBodies)
+	}
+	content, _ := ioutil.ReadAll(rewritten.AlternativeBodies[0].Data)
+	if string(content) != "<!doctype html><html ⚡4email><body>Hello AMP</body></html>" {
+		t.Errorf("Wrong AMP content: %q", content)
+	}
+	if rewritten.TextBody != "Hello text" || rewritten.HTMLBody != "<p>Hello HTML</p>" {
+		t.Errorf("Wrong bodies: %q %q", rewritten.TextBody, rewritten.HTMLBody)
+	}
+}
+
 func parseDate(in string) time.Time {
 	out, err := time.Parse(time.RFC1123Z, in)
 	if err != nil {
@@ -1083,3 +1181,24 @@ PGRpdiBkaXI9Imx0ciI+PGRpdj5UaGlzIGlzIGEgcmVjZWlwdC48L2Rpdj48ZGl2Pjxicj48L2Rp
 dj48ZGl2Pjxicj48YnI+PC9kaXY+PC9kaXY+
 ------=_Part_746216_364383494.1698130589208--
 `
+
+var ampAlternativeExample = `From: a@example.com
+To: b@example.com
+Subject: AMP
+MIME-Version: 1.0
+Content-Type: multipart/alternative; boundary="a1"
+
+--a1
+Content-Type: text/plain; charset=utf-8
+
+Hello text
+--a1
+Content-Type: text/x-amp-html; charset=utf-8
+
+<!doctype html><html ⚡4email><body>Hello AMP</body></html>
+--a1
+Content-Type: text/html; charset=utf-8
+
+<p>Hello HTML</p>
+--a1--
+`
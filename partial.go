@@ -0,0 +1,133 @@
+package parsemail
+
+import (
+	"bytes"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+const contentTypeMessagePartial = "message/partial"
+
+// PartialReassembler collects message/partial fragments (RFC 2046 section 5.2.2) and rebuilds
+// the original message once all of its fragments arrived
+type PartialReassembler struct {
+	messages map[string]*partialMessage
+}
+
+type partialMessage struct {
+	total     int
+	fragments map[int]*Email
+}
+
+// NewPartialReassembler returns a reassembler without any pending fragments
+func NewPartialReassembler() *PartialReassembler {
+	return &PartialReassembler{messages: map[string]*partialMessage{}}
+}
+
+// Add stores a message/partial fragment. When it completes its message, the reassembled message is parsed
+// and returned, otherwise the result is nil. Repeated fragments are ignored.
+func (r *PartialReassembler) Add(email *Email) (*Email, error) {
+	mediaType, params, err := parseContentType(email.ContentType)
+	if err != nil {
+		return nil, err
+	}
+	if mediaType != contentTypeMessagePartial {
+		return nil, fmt.Errorf("not a message/partial fragment: %s", mediaType)
+	}
+
+	id := params["id"]
+	number, err := strconv.Atoi(params["number"])
+	if id == "" || err != nil || number < 1 {
+		return nil, fmt.Errorf("message/partial fragment without valid id and number")
+	}
+
+	m := r.messages[id]
+	if m == nil {
+		m = &partialMessage{fragments: map[int]*Email{}}
+		r.messages[id] = m
+	}
+	if total, err := strconv.Atoi(params["total"]); err == nil && total > 0 {
+		m.total = total
+	}
+	if _, ok := m.fragments[number]; !ok {
+		m.fragments[number] = email
+	}
+
+	if m.total == 0 || len(m.fragments) < m.total {
+		return nil, nil
+	}
+	for i := 1; i <= m.total; i++ {
+		if m.fragments[i] == nil {
+			return nil, nil
+		}
+	}
+
+	delete(r.messages, id)
+
+	return m.reassemble()
+}
+
+// Pending returns the ids of the messages which are still missing fragments
+func (r *PartialReassembler) Pending() (ids []string) {
+	for id := range r.messages {
+		ids = append(ids, id)
+	}
+
+	return
+}
+
+// reassemble merges the headers as RFC 2046 section 5.2.2 requires: the enclosing header of the first
+// fragment without its content, subject, id and encryption fields, followed by exactly those fields of the
+// enclosed header. The enclosing headers of the following fragments are ignored.
+func (m *partialMessage) reassemble() (*Email, error) {
+	first := m.fragments[1]
+	if len(first.RawHeaders) == 0 {
+		return nil, fmt.Errorf("message/partial fragment without raw headers")
+	}
+
+	out := new(bytes.Buffer)
+	for _, f := range first.RawHeaders {
+		if !isPartialEnclosedField(f.Name) {
+			out.WriteString(strings.TrimRight(f.Raw(), "\r\n") + "\r\n")
+		}
+	}
+
+	body, err := readAndReset(&first.Content)
+	if err != nil {
+		return nil, err
+	}
+	enclosed, bodyOffset := parseRawHeaders(body)
+	for _, f := range enclosed {
+		if isPartialEnclosedField(f.Name) {
+			out.WriteString(strings.TrimRight(f.Raw(), "\r\n") + "\r\n")
+		}
+	}
+	out.WriteString("\r\n")
+	out.Write(body[bodyOffset:])
+
+	for i := 2; i <= m.total; i++ {
+		data, err := readAndReset(&m.fragments[i].Content)
+		if err != nil {
+			return nil, err
+		}
+		out.Write(data)
+	}
+
+	email, err := Parse(out)
+	if err != nil {
+		return nil, err
+	}
+
+	return &email, nil
+}
+
+func isPartialEnclosedField(name string) bool {
+	name = strings.ToLower(name)
+	switch name {
+	case "subject", "message-id", "encrypted", "mime-version":
+		return true
+	}
+
+	return strings.HasPrefix(name, "content-")
+}
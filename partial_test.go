@@ -0,0 +1,98 @@
+package parsemail
+
+import (
+	"strings"
+	"testing"
+)
+
+// the fragmented message example of RFC 2046 section 5.2.2.2
+var partialExamples = []string{
+	`X-Weird-Header-1: Foo
+From: Bill@host.com
+To: joe@otherhost.com
+Date: Fri, 26 Mar 1993 12:59:38 -0500 (EST)
+Subject: Audio mail (part 1 of 2)
+Message-ID: <id1@host.com>
+MIME-Version: 1.0
+Content-type: message/partial; id="ABC@host.com";
+     number=1; total=2
+
+X-Weird-Header-1: Bar
+X-Weird-Header-2: Hello
+Message-ID: <anotherid@foo.com>
+Subject: Audio mail
+MIME-Version: 1.0
+Content-type: text/plain
+
+first half, `,
+	`From: Bill@host.com
+To: joe@otherhost.com
+Date: Fri, 26 Mar 1993 12:59:38 -0500 (EST)
+Subject: Audio mail (part 2 of 2)
+MIME-Version: 1.0
+Message-ID: <id2@host.com>
+Content-type: message/partial;
+     id="ABC@host.com"; number=2; total=2
+
+second half`,
+}
+
+func TestPartialReassembler(t *testing.T) {
+	var testData = map[int]struct {
+		order []int
+	}{
+		1: {order: []int{0, 1}},
+		2: {order: []int{1, 0}},
+		3: {order: []int{1, 1, 0}},
+	}
+
+	for index, td := range testData {
+		r := NewPartialReassembler()
+
+		var result *Email
+		for i, n := range td.order {
+			e, err := Parse(strings.NewReader(partialExamples[n]))
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			result, err = r.Add(&e)
+			if err != nil {
+				t.Errorf("[Test Case %v] %v", index, err)
+			}
+			if i < len(td.order)-1 && result != nil {
+				t.Errorf("[Test Case %v] Message reassembled before all fragments arrived", index)
+			}
+		}
+
+		if result == nil {
+			t.Errorf("[Test Case %v] Message wasn't reassembled", index)
+			continue
+		}
+
+		if result.Subject != "Audio mail" || result.MessageID != "anotherid@foo.com" {
+			t.Errorf("[Test Case %v] Wrong enclosed fields: %s, %s", index, result.Subject, result.MessageID)
+		}
+		if result.From[0].Address != "Bill@host.com" || result.To[0].Address != "joe@otherhost.com" {
+			t.Errorf("[Test Case %v] Wrong enclosing fields: %v, %v", index, result.From, result.To)
+		}
+		if got := result.Header["X-Weird-Header-1"]; len(got) != 1 || got[0] != "Foo" {
+			t.Errorf("[Test Case %v] Wrong X-Weird-Header-1: %v", index, got)
+		}
+		if got := result.Header.Get("X-Weird-Header-2"); got != "" {
+			t.Errorf("[Test Case %v] Enclosed X-Weird-Header-2 should be dropped: %v", index, got)
+		}
+		if result.TextBody != "first half, second half" {
+			t.Errorf("[Test Case %v] Wrong body: %q", index, result.TextBody)
+		}
+		if len(r.Pending()) != 0 {
+			t.Errorf("[Test Case %v] Reassembled message still pending", index)
+		}
+	}
+
+	r := NewPartialReassembler()
+	e, _ := Parse(strings.NewReader(rfc5322exampleA11))
+	if _, err := r.Add(&e); err == nil {
+		t.Errorf("Expected error for a message which isn't a fragment")
+	}
+}
@@ -0,0 +1,79 @@
+package parsemail
+
+import (
+	"bytes"
+	"strings"
+)
+
+// HeaderField is a single header field exactly as it appeared in the message header block
+type HeaderField struct {
+	// Name of the field with its original casing
+	Name string
+	// RawValue holds everything after the colon up to the terminating line break, including folding
+	RawValue string
+	// DecodedValue is the unfolded, trimmed and RFC 2047 decoded value
+	DecodedValue string
+	// Offset of the first byte of the field from the start of the message
+	Offset int64
+}
+
+// Raw returns the field as it appeared in the message, without the terminating line break
+func (f HeaderField) Raw() string {
+	return f.Name + ":" + f.RawValue
+}
+
+// parseRawHeaders scans the header block of data and returns its fields in their original order
+// together with the offset at which the body starts.
+func parseRawHeaders(data []byte) (fields []HeaderField, bodyOffset int64) {
+	pos := 0
+
+	for pos < len(data) {
+		end := bytes.IndexByte(data[pos:], '\n')
+		next := len(data)
+		if end >= 0 {
+			next = pos + end + 1
+		}
+		line := data[pos:next]
+		content := bytes.TrimRight(line, "\r\n")
+
+		if len(content) == 0 {
+			return finishRawHeaders(fields), int64(next)
+		}
+
+		if content[0] == ' ' || content[0] == '\t' {
+			if len(fields) > 0 {
+				fields[len(fields)-1].RawValue += string(line)
+			}
+		} else if colon := bytes.IndexByte(content, ':'); colon > 0 {
+			fields = append(fields, HeaderField{
+				Name:     string(content[:colon]),
+				RawValue: string(line[colon+1:]),
+				Offset:   int64(pos),
+			})
+		}
+
+		pos = next
+	}
+
+	return finishRawHeaders(fields), int64(len(data))
+}
+
+func finishRawHeaders(fields []HeaderField) []HeaderField {
+	for i := range fields {
+		fields[i].RawValue = trimLineBreak(fields[i].RawValue)
+		fields[i].DecodedValue = decodeMimeSentence(unfoldHeaderValue(fields[i].RawValue))
+	}
+
+	return fields
+}
+
+func trimLineBreak(s string) string {
+	return strings.TrimSuffix(strings.TrimSuffix(s, "\n"), "\r")
+}
+
+func unfoldHeaderValue(s string) string {
+	s = strings.Replace(s, "\r\n", "", -1)
+	s = strings.Replace(s, "\n", "", -1)
+
+	return strings.TrimSpace(s)
+}
@@ -0,0 +1,53 @@
+package parsemail
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestParseRawHeaders(t *testing.T) {
+	var testData = map[int]struct {
+		mailData string
+		fields   []HeaderField
+	}{
+		1: {
+			mailData: "Received: from x.y.test\r\n  by example.net\r\nReceived: from node.example\r\nSubject: =?UTF-8?Q?Peter_Pahol=C3=ADk?=\r\n\r\nbody\r\n",
+			fields: []HeaderField{
+				{Name: "Received", RawValue: " from x.y.test\r\n  by example.net", DecodedValue: "from x.y.test  by example.net", Offset: 0},
+				{Name: "Received", RawValue: " from node.example", DecodedValue: "from node.example", Offset: 43},
+				{Name: "Subject", RawValue: " =?UTF-8?Q?Peter_Pahol=C3=ADk?=", DecodedValue: "Peter Paholík", Offset: 72},
+			},
+		},
+		2: {
+			mailData: "X-Empty:\nx-lower-case:value\n\nbody",
+			fields: []HeaderField{
+				{Name: "X-Empty", RawValue: "", DecodedValue: "", Offset: 0},
+				{Name: "x-lower-case", RawValue: "value", DecodedValue: "value", Offset: 9},
+			},
+		},
+	}
+
+	for index, td := range testData {
+		e, err := Parse(strings.NewReader(td.mailData))
+		if err != nil {
+			t.Error(err)
+			continue
+		}
+
+		if len(e.RawHeaders) != len(td.fields) {
+			t.Errorf("[Test Case %v] Wrong number of raw headers. Expected: %v, Got: %v", index, len(td.fields), len(e.RawHeaders))
+			continue
+		}
+
+		for i, f := range td.fields {
+			if e.RawHeaders[i] != f {
+				t.Errorf("[Test Case %v] Wrong raw header %v. Expected: %#v, Got: %#v", index, i, f, e.RawHeaders[i])
+			}
+
+			raw := td.mailData[f.Offset : f.Offset+int64(len(f.Raw()))]
+			if raw != f.Raw() {
+				t.Errorf("[Test Case %v] Raw header %v does not match source. Expected: %q, Got: %q", index, i, raw, f.Raw())
+			}
+		}
+	}
+}
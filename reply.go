@@ -0,0 +1,330 @@
+package parsemail
+
+import (
+	"bytes"
+	"fmt"
+	"html"
+	"net/mail"
+	"regexp"
+	"strings"
+	"time"
+)
+
+var replySubjectPrefix = regexp.MustCompile(`(?i)^\s*re\s*(\[\d+\])?\s*:`)
+var forwardSubjectPrefix = regexp.MustCompile(`(?i)^\s*(fwd?)\s*(\[\d+\])?\s*:`)
+
+var htmlBodyStart = regexp.MustCompile(`(?is)^.*?<body(?:\s[^>]*)?>`)
+var htmlBodyEnd = regexp.MustCompile(`(?is)</body\s*>.*$`)
+var htmlDocumentWrapper = regexp.MustCompile(`(?is)<!doctype[^>]*>|<head(?:\s[^>]*)?>.*?</head\s*>|</?(?:html|head|body)(?:\s[^>]*)?>`)
+
+// ReplyOptions configure the reply composed by BuildReply
+type ReplyOptions struct {
+	// From is the address the reply is sent from
+	From string
+	// Addresses are our own addresses, they are never used as recipients. The From address is included implicitly.
+	Addresses []string
+	// ReplyAll also addresses all the recipients of the original email
+	ReplyAll bool
+	// Text and HTML are placed above the quoted original
+	Text string
+	HTML string
+}
+
+// ForwardOptions configure the forward composed by BuildForward
+type ForwardOptions struct {
+	// From is the address the email is forwarded from
+	From string
+	// To are the recipients of the forwarded email
+	To []string
+	// Text and HTML are placed above the forwarded original
+	Text string
+	HTML string
+}
+
+// BuildReply starts composing a reply to email. Recipients, Subject, In-Reply-To and References are set and
+// the original bodies are quoted; the returned builder can be used to adjust the reply further.
+func BuildReply(email Email, opts ReplyOptions) *MessageBuilder {
+	b := NewMessage().From(opts.From)
+
+	own := ownAddresses(b.email.From, opts.Addresses)
+
+	to := email.ReplyTo
+	if len(to) == 0 {
+		to = email.From
+	}
+	if len(excludeAddresses(to, own)) == 0 {
+		// replying to our own message, address the original recipients instead
+		to = email.To
+	}
+	to = excludeAddresses(to, own)
+	b.email.To = to
+
+	if opts.ReplyAll {
+		seen := addressSet(to)
+		for _, a := range excludeAddresses(append(append([]*mail.Address{}, email.To...), email.Cc...), own) {
+			if !seen[strings.ToLower(a.Address)] {
+				seen[strings.ToLower(a.Address)] = true
+				b.email.Cc = append(b.email.Cc, a)
+			}
+		}
+	}
+
+	b.Subject(prefixSubject(email.Subject, "Re: ", replySubjectPrefix))
+
+	if email.MessageID != "" {
+		b.InReplyTo(email.MessageID)
+	}
+	b.References(replyReferences(email)...)
+
+	text, quoted, err := originalBodies(email)
+	if err != nil {
+		b.err = err
+		return b
+	}
+
+	attribution := quoteAttribution(email)
+	b.Text(joinParagraphs(opts.Text, attribution+"\n"+quoteText(text)))
+
+	if email.HTMLBody != "" || opts.HTML != "" {
+		if quoted == "" {
+			quoted = TextToHTML(text)
+		}
+		b.HTML(replyHTML(opts) + "<div>" + html.EscapeString(attribution) + "</div>\n" +
+			`<blockquote type="cite">` + quoted + "</blockquote>")
+	}
+
+	return b
+}
+
+// BuildForward starts composing a forward of email. The Subject and References are set, the original bodies are
+// included below a forwarded message header and its attachments and embedded files are carried over.
+func BuildForward(email Email, opts ForwardOptions) *MessageBuilder {
+	b := NewMessage().From(opts.From).To(opts.To...)
+
+	b.Subject(prefixSubject(email.Subject, "Fwd: ", forwardSubjectPrefix))
+	b.References(replyReferences(email)...)
+
+	text, original, err := originalBodies(email)
+	if err != nil {
+		b.err = err
+		return b
+	}
+
+	summary := forwardSummary(email)
+	b.Text(joinParagraphs(opts.Text, strings.Join(summary, "\n")+"\n\n"+text))
+
+	if email.HTMLBody != "" || opts.HTML != "" {
+		if original == "" {
+			original = TextToHTML(text)
+		}
+
+		escaped := make([]string, len(summary))
+		for i, line := range summary {
+			escaped[i] = html.EscapeString(line)
+		}
+		b.HTML(replyHTML(ReplyOptions{Text: opts.Text, HTML: opts.HTML}) +
+			"<div>" + strings.Join(escaped, "<br>\n") + "</div>\n<br>\n" + original)
+	}
+
+	for i := range email.Attachments {
+		data, err := readAndReset(&email.Attachments[i].Data)
+		if err != nil {
+			b.err = err
+			return b
+		}
+		b.Attach(email.Attachments[i].Filename, email.Attachments[i].ContentType, bytes.NewReader(data))
+	}
+
+	for i := range email.EmbeddedFiles {
+		data, err := readAndReset(&email.EmbeddedFiles[i].Data)
+		if err != nil {
+			b.err = err
+			return b
+		}
+		b.Embed(email.EmbeddedFiles[i].CID, email.EmbeddedFiles[i].ContentType, bytes.NewReader(data))
+	}
+
+	return b
+}
+
+// prefixSubject adds prefix to subject unless it already starts with a matching one
+func prefixSubject(subject, prefix string, existing *regexp.Regexp) string {
+	if existing.MatchString(subject) {
+		return subject
+	}
+
+	return prefix + strings.TrimSpace(subject)
+}
+
+// replyReferences returns the References of a reply as described in RFC 5322 section 3.6.4
+func replyReferences(email Email) []string {
+	var refs []string
+	if len(email.References) > 0 {
+		refs = append(refs, email.References...)
+	} else if len(email.InReplyTo) == 1 {
+		refs = append(refs, email.InReplyTo...)
+	}
+
+	if email.MessageID != "" {
+		refs = append(refs, email.MessageID)
+	}
+
+	return refs
+}
+
+func ownAddresses(from []*mail.Address, addresses []string) map[string]bool {
+	own := addressSet(from)
+	for _, a := range addresses {
+		if parsed, err := mail.ParseAddress(a); err == nil {
+			own[strings.ToLower(parsed.Address)] = true
+		} else {
+			own[strings.ToLower(strings.TrimSpace(a))] = true
+		}
+	}
+
+	return own
+}
+
+func addressSet(al []*mail.Address) map[string]bool {
+	set := map[string]bool{}
+	for _, a := range al {
+		set[strings.ToLower(a.Address)] = true
+	}
+
+	return set
+}
+
+func excludeAddresses(al []*mail.Address, excluded map[string]bool) (result []*mail.Address) {
+	for _, a := range al {
+		if !excluded[strings.ToLower(a.Address)] {
+			result = append(result, a)
+		}
+	}
+
+	return
+}
+
+func quoteAttribution(email Email) string {
+	author := "unknown sender"
+	if len(email.From) > 0 {
+		author = formatAddressListForDisplay(email.From[:1])
+	}
+
+	if email.Date.IsZero() {
+		return author + " wrote:"
+	}
+
+	return fmt.Sprintf("On %s, %s wrote:", email.Date.Format("Mon, 2 Jan 2006 at 15:04"), author)
+}
+
+// originalBodies returns the text and HTML bodies of email decoded from their transfer encoding and charset, the
+// HTML is reduced to the content of its body element so it can be nested in a reply or forward
+func originalBodies(email Email) (text, htmlBody string, err error) {
+	var texts []string
+	for _, tb := range email.TextBodies {
+		data, err := readAndReset(&tb.Data)
+		if err != nil {
+			return "", "", err
+		}
+		s, _ := decodeCharset(data, tb.Params["charset"])
+		texts = append(texts, strings.TrimSuffix(strings.Replace(s, "\r\n", "\n", -1), "\n"))
+	}
+	if len(email.TextBodies) == 0 {
+		texts = append(texts, email.TextBody)
+	}
+
+	var htmls []string
+	for _, hb := range email.HTMLBodies {
+		data, err := readAndReset(&hb.Data)
+		if err != nil {
+			return "", "", err
+		}
+		s, _ := decodeCharset(data, hb.Params["charset"])
+		htmls = append(htmls, htmlBodyContent(s))
+	}
+	if len(email.HTMLBodies) == 0 && email.HTMLBody != "" {
+		htmls = append(htmls, htmlBodyContent(email.HTMLBody))
+	}
+
+	return joinParagraphs(texts...), strings.Join(htmls, "\n"), nil
+}
+
+// htmlBodyContent strips the document structure of an HTML document, leaving the content of its body element
+func htmlBodyContent(s string) string {
+	if loc := htmlBodyStart.FindStringIndex(s); loc != nil {
+		s = s[loc[1]:]
+		if loc := htmlBodyEnd.FindStringIndex(s); loc != nil {
+			s = s[:loc[0]]
+		}
+	}
+
+	return strings.TrimSpace(htmlDocumentWrapper.ReplaceAllString(s, ""))
+}
+
+// quoteText prefixes every line of text with a quote marker, nesting already quoted lines
+func quoteText(text string) string {
+	lines := strings.Split(strings.Replace(text, "\r\n", "\n", -1), "\n")
+	for i, line := range lines {
+		if strings.HasPrefix(line, ">") {
+			lines[i] = ">" + line
+		} else {
+			lines[i] = "> " + line
+		}
+	}
+
+	return strings.Join(lines, "\n")
+}
+
+func forwardSummary(email Email) []string {
+	summary := []string{"---------- Forwarded message ----------"}
+	if len(email.From) > 0 {
+		summary = append(summary, "From: "+formatAddressListForDisplay(email.From))
+	}
+	if !email.Date.IsZero() {
+		summary = append(summary, "Date: "+email.Date.Format(time.RFC1123Z))
+	}
+	summary = append(summary, "Subject: "+email.Subject)
+	if len(email.To) > 0 {
+		summary = append(summary, "To: "+formatAddressListForDisplay(email.To))
+	}
+	if len(email.Cc) > 0 {
+		summary = append(summary, "Cc: "+formatAddressListForDisplay(email.Cc))
+	}
+
+	return summary
+}
+
+func formatAddressListForDisplay(al []*mail.Address) string {
+	var result []string
+	for _, a := range al {
+		if a.Name != "" {
+			result = append(result, a.Name+" <"+a.Address+">")
+		} else {
+			result = append(result, a.Address)
+		}
+	}
+
+	return strings.Join(result, ", ")
+}
+
+func replyHTML(opts ReplyOptions) string {
+	if opts.HTML != "" {
+		return opts.HTML + "\n"
+	}
+	if opts.Text != "" {
+		return TextToHTML(opts.Text) + "\n"
+	}
+
+	return ""
+}
+
+func joinParagraphs(paragraphs ...string) string {
+	var result []string
+	for _, p := range paragraphs {
+		if p != "" {
+			result = append(result, p)
+		}
+	}
+
+	return strings.Join(result, "\n\n")
+}
@@ -0,0 +1,225 @@
+package parsemail
+
+import (
+	"net/mail"
+	"strings"
+	"testing"
+)
+
+func TestBuildReply(t *testing.T) {
+	var testData = map[int]struct {
+		mailData   string
+		opts       ReplyOptions
+		subject    string
+		to         []mail.Address
+		cc         []mail.Address
+		inReplyTo  []string
+		references []string
+		textBody   string
+	}{
+		1: {
+			mailData: rfc5322exampleA11,
+			opts: ReplyOptions{
+				From: "Mary Smith <mary@example.net>",
+				Text: "Hi John.",
+			},
+			subject:    "Re: Saying Hello",
+			to:         []mail.Address{{Name: "John Doe", Address: "jdoe@machine.example"}},
+			inReplyTo:  []string{"1234@local.machine.example"},
+			references: []string{"1234@local.machine.example"},
+			textBody:   "Hi John.\n\nOn Fri, 21 Nov 1997 at 09:55, John Doe <jdoe@machine.example> wrote:\n> This is a message just to say hello.\n> So, \"Hello\".",
+		},
+		2: {
+			mailData: rfc5322exampleA2a,
+			opts: ReplyOptions{
+				From: "jdoe@machine.example",
+			},
+			subject:    "Re: Saying Hello",
+			to:         []mail.Address{{Name: "Mary Smith: Personal Account", Address: "smith@home.example"}},
+			inReplyTo:  []string{"3456@example.net"},
+			references: []string{"1234@local.machine.example", "3456@example.net"},
+			textBody:   "On Fri, 21 Nov 1997 at 10:01, Mary Smith <mary@example.net> wrote:\n> This is a reply to your hello.",
+		},
+		3: {
+			mailData: rfc5322exampleA12,
+			opts: ReplyOptions{
+				From:      "Mary Smith <mary@x.test>",
+				Addresses: []string{"one@y.test"},
+				ReplyAll:  true,
+			},
+			subject: "Re: ",
+			to:      []mail.Address{{Name: "Joe Q. Public", Address: "john.q.public@example.com"}},
+			cc: []mail.Address{
+				{Address: "jdoe@example.org"},
+				{Address: "boss@nil.test"},
+				{Name: "Giant; \"Big\" Box", Address: "sysservices@example.net"},
+			},
+			inReplyTo:  []string{"5678.21-Nov-1997@example.com"},
+			references: []string{"5678.21-Nov-1997@example.com"},
+			textBody:   "On Tue, 1 Jul 2003 at 10:52, Joe Q. Public <john.q.public@example.com> wrote:\n> Hi everyone.",
+		},
+		4: {
+			mailData: rfc5322exampleA11,
+			opts: ReplyOptions{
+				From: "jdoe@machine.example",
+			},
+			subject:    "Re: Saying Hello",
+			to:         []mail.Address{{Name: "Mary Smith", Address: "mary@example.net"}},
+			inReplyTo:  []string{"1234@local.machine.example"},
+			references: []string{"1234@local.machine.example"},
+			textBody:   "On Fri, 21 Nov 1997 at 09:55, John Doe <jdoe@machine.example> wrote:\n> This is a message just to say hello.\n> So, \"Hello\".",
+		},
+	}
+
+	for index, td := range testData {
+		e, err := Parse(strings.NewReader(td.mailData))
+		if err != nil {
+			t.Error(err)
+			continue
+		}
+
+		r, err := BuildReply(e, td.opts).Build()
+		if err != nil {
+			t.Errorf("[Test Case %v] %v", index, err)
+			continue
+		}
+
+		if r.Subject != td.subject {
+			t.Errorf("[Test Case %v] Wrong subject. Expected: %s, Got: %s", index, td.subject, r.Subject)
+		}
+
+		if d := dereferenceAddressList(r.To); !assertAddressListEq(td.to, d) {
+			t.Errorf("[Test Case %v] Wrong to. Expected: %s, Got: %s", index, td.to, d)
+		}
+
+		if d := dereferenceAddressList(r.Cc); !assertAddressListEq(td.cc, d) {
+			t.Errorf("[Test Case %v] Wrong cc. Expected: %s, Got: %s", index, td.cc, d)
+		}
+
+		if !assertSliceEq(td.inReplyTo, r.InReplyTo) {
+			t.Errorf("[Test Case %v] Wrong in reply to. Expected: %s, Got: %s", index, td.inReplyTo, r.InReplyTo)
+		}
+
+		if !assertSliceEq(td.references, r.References) {
+			t.Errorf("[Test Case %v] Wrong references. Expected: %s, Got: %s", index, td.references, r.References)
+		}
+
+		if r.TextBody != td.textBody {
+			t.Errorf("[Test Case %v] Wrong text body. Expected: %q, Got: %q", index, td.textBody, r.TextBody)
+		}
+	}
+}
+
+func TestBuildForward(t *testing.T) {
+	e, err := Parse(strings.NewReader(data1))
+	if err != nil {
+		t.Fatal(err)
+	}
+	e.Subject = "Fwd: report"
+
+	f, err := BuildForward(e, ForwardOptions{
+		From: "dusan@kasan.sk",
+		To:   []string{"boss@nil.test"},
+		Text: "See below.",
+	}).Build()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if f.Subject != "Fwd: report" {
+		t.Errorf("Wrong subject. Got: %s", f.Subject)
+	}
+
+	if len(f.InReplyTo) != 0 || !assertSliceEq(f.References, []string{e.MessageID}) {
+		t.Errorf("Wrong threading headers. Got: %v %v", f.InReplyTo, f.References)
+	}
+
+	if !strings.HasPrefix(f.TextBody, "See below.\n\n---------- Forwarded message ----------\nFrom: Peter Paholík <peter.paholik@gmail.com>\n") {
+		t.Errorf("Wrong text body. Got: %q", f.TextBody)
+	}
+
+	if !strings.Contains(f.HTMLBody, `<div dir="ltr"><br></div>`) {
+		t.Errorf("Original html body not forwarded. Got: %q", f.HTMLBody)
+	}
+
+	if len(f.Attachments) != len(e.Attachments) || f.Attachments[0].Filename != e.Attachments[0].Filename {
+		t.Errorf("Attachments not forwarded. Got: %v", f.Attachments)
+	}
+}
+
+func TestBuildReplyDecodesOriginal(t *testing.T) {
+	e, err := Parse(strings.NewReader(latin1AlternativeMail))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	r, err := BuildReply(e, ReplyOptions{From: "mary@example.net"}).Build()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if expected := "On Fri, 21 Nov 1997 at 09:55, John Doe <jdoe@machine.example> wrote:\n> Un café au lait, s'il vous plaît.\n> À bientôt"; r.TextBody != expected {
+		t.Errorf("Wrong text body. Expected: %q, Got: %q", expected, r.TextBody)
+	}
+
+	if expected := `<blockquote type="cite"><p>Un café au lait, s'il vous plaît.</p></blockquote>`; !strings.HasSuffix(r.HTMLBody, expected) {
+		t.Errorf("Wrong html body. Expected suffix: %q, Got: %q", expected, r.HTMLBody)
+	}
+
+	f, err := BuildForward(e, ForwardOptions{From: "mary@example.net", To: []string{"boss@nil.test"}}).Build()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !strings.HasSuffix(f.TextBody, "\n\nUn café au lait, s'il vous plaît.\nÀ bientôt") {
+		t.Errorf("Wrong forwarded text body. Got: %q", f.TextBody)
+	}
+
+	if !strings.HasSuffix(f.HTMLBody, "<br>\n<p>Un café au lait, s'il vous plaît.</p>") || strings.Contains(f.HTMLBody, "<title>") {
+		t.Errorf("Wrong forwarded html body. Got: %q", f.HTMLBody)
+	}
+}
+
+func TestPrefixSubject(t *testing.T) {
+	var testData = map[int]struct {
+		subject  string
+		expected string
+	}{
+		1: {"Hello", "Re: Hello"},
+		2: {"Re: Hello", "Re: Hello"},
+		3: {"RE: Hello", "RE: Hello"},
+		4: {"Re[2]: Hello", "Re[2]: Hello"},
+		5: {"Fwd: Hello", "Re: Fwd: Hello"},
+		6: {"Reply needed", "Re: Reply needed"},
+	}
+
+	for index, td := range testData {
+		if s := prefixSubject(td.subject, "Re: ", replySubjectPrefix); s != td.expected {
+			t.Errorf("[Test Case %v] Wrong subject. Expected: %s, Got: %s", index, td.expected, s)
+		}
+	}
+}
+
+var latin1AlternativeMail = `From: John Doe <jdoe@machine.example>
+To: Mary Smith <mary@example.net>
+Subject: =?iso-8859-1?q?Caf=E9?=
+Date: Fri, 21 Nov 1997 09:55:06 -0600
+Message-ID: <1234@local.machine.example>
+MIME-Version: 1.0
+Content-Type: multipart/alternative; boundary="b1"
+
+--b1
+Content-Type: text/plain; charset=iso-8859-1
+Content-Transfer-Encoding: quoted-printable
+
+Un caf=E9 au lait, s'il vous pla=
+=EEt.
+=C0 bient=F4t
+--b1
+Content-Type: text/html; charset=iso-8859-1
+Content-Transfer-Encoding: base64
+
+PGh0bWw+PGhlYWQ+PHRpdGxlPkNhZuk8L3RpdGxlPjwvaGVhZD48Ym9keSBiZ2NvbG9yPSJ3aGl0
+ZSI+PHA+VW4gY2Fm6SBhdSBsYWl0LCBzJ2lsIHZvdXMgcGxh7nQuPC9wPjwvYm9keT48L2h0bWw+
+--b1--
+`
@@ -0,0 +1,271 @@
+package parsemail
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+)
+
+// De-encapsulation of HTML and plain text bodies stored in RTF (MS-OXRTFEX)
+
+// rtfSkippedDestinations are destinations whose content never belongs to the body
+var rtfSkippedDestinations = map[string]bool{
+	"fonttbl":    true,
+	"colortbl":   true,
+	"stylesheet": true,
+	"info":       true,
+	"pict":       true,
+	"object":     true,
+	"header":     true,
+	"footer":     true,
+	"listtable":  true,
+	"filetbl":    true,
+	"rsidtbl":    true,
+	"generator":  true,
+}
+
+var rtfSymbols = map[string]string{
+	"par":       "\r\n",
+	"line":      "\r\n",
+	"tab":       "\t",
+	"emdash":    "—",
+	"endash":    "–",
+	"emspace":   " ",
+	"enspace":   " ",
+	"bullet":    "•",
+	"lquote":    "‘",
+	"rquote":    "’",
+	"ldblquote": "“",
+	"rdblquote": "”",
+}
+
+// DecodeEncapsulatedRTF extracts the original body from RTF generated by Outlook from an HTML (\fromhtml1)
+// or plain text (\fromtext) body. The content type of the extracted body is returned along with it,
+// RTF which doesn't encapsulate another format results in an error.
+func DecodeEncapsulatedRTF(rtf []byte) (body string, contentType string, err error) {
+	d := &rtfDecoder{data: rtf, state: rtfState{uc: 1}, charset: "windows-1252"}
+	d.decode()
+
+	switch {
+	case d.fromHTML:
+		return d.out.String(), contentTypeTextHtml, nil
+	case d.fromText:
+		return d.out.String(), contentTypeTextPlain, nil
+	}
+
+	return "", "", fmt.Errorf("rtf doesn't encapsulate html or text")
+}
+
+// setRTFBodies fills the bodies missing from email with the ones encapsulated in its RTF body
+func setRTFBodies(email *Email) {
+	if email.RTFBody == "" {
+		return
+	}
+
+	body, contentType, err := DecodeEncapsulatedRTF([]byte(email.RTFBody))
+	if err != nil {
+		return
+	}
+
+	switch {
+	case contentType == contentTypeTextHtml && email.HTMLBody == "":
+		email.HTMLBody = body
+	case contentType == contentTypeTextPlain && email.TextBody == "":
+		email.TextBody = body
+	}
+}
+
+type rtfState struct {
+	// skip is set in destinations which don't belong to the body
+	skip bool
+	// htmlrtf is set in parts only present in the RTF rendering of an HTML body
+	htmlrtf bool
+	// htmltag is set in groups holding original HTML
+	htmltag bool
+	// uc is the number of fallback characters following \u
+	uc int
+}
+
+type rtfDecoder struct {
+	data  []byte
+	pos   int
+	state rtfState
+	stack []rtfState
+	out   strings.Builder
+	bytes []byte
+	// charset of the \'hh bytes, set by \ansicpg
+	charset  string
+	unicode  int
+	fromHTML bool
+	fromText bool
+	// groupStart is set until the first token of a group, which decides its destination
+	groupStart bool
+	ignorable  bool
+}
+
+func (d *rtfDecoder) decode() {
+	for d.pos < len(d.data) {
+		c := d.data[d.pos]
+		d.pos++
+
+		switch c {
+		case '{':
+			d.flush()
+			d.stack = append(d.stack, d.state)
+			d.groupStart, d.ignorable = true, false
+		case '}':
+			d.flush()
+			if len(d.stack) > 0 {
+				d.state = d.stack[len(d.stack)-1]
+				d.stack = d.stack[:len(d.stack)-1]
+			}
+			d.groupStart, d.ignorable = false, false
+		case '\\':
+			d.controlWord()
+		case '\r', '\n':
+		default:
+			d.groupStart = false
+			d.flush()
+			d.text(string(c))
+		}
+	}
+	d.flush()
+}
+
+func (d *rtfDecoder) controlWord() {
+	if d.pos >= len(d.data) {
+		return
+	}
+
+	c := d.data[d.pos]
+	d.pos++
+
+	if !isRTFLetter(c) {
+		switch c {
+		case '\'':
+			if d.pos+2 <= len(d.data) {
+				if b, err := strconv.ParseUint(string(d.data[d.pos:d.pos+2]), 16, 8); err == nil {
+					d.groupStart = false
+					d.pos += 2
+					if d.unicode > 0 {
+						d.unicode--
+					} else if d.emitting() {
+						d.bytes = append(d.bytes, byte(b))
+					}
+					return
+				}
+			}
+		case '*':
+			d.ignorable = true
+			return
+		case '\\', '{', '}':
+			d.groupStart = false
+			d.flush()
+			d.text(string(c))
+		case '~':
+			d.flush()
+			d.text(" ")
+		case '_':
+			d.flush()
+			d.text("‑")
+		case '\r', '\n':
+			d.flush()
+			d.text("\r\n")
+		}
+		d.groupStart = false
+		return
+	}
+
+	start := d.pos - 1
+	for d.pos < len(d.data) && isRTFLetter(d.data[d.pos]) {
+		d.pos++
+	}
+	word := string(d.data[start:d.pos])
+
+	paramStart := d.pos
+	if d.pos < len(d.data) && d.data[d.pos] == '-' {
+		d.pos++
+	}
+	for d.pos < len(d.data) && d.data[d.pos] >= '0' && d.data[d.pos] <= '9' {
+		d.pos++
+	}
+	param, err := strconv.Atoi(string(d.data[paramStart:d.pos]))
+	hasParam := err == nil
+	if !hasParam {
+		d.pos = paramStart
+	}
+	if d.pos < len(d.data) && d.data[d.pos] == ' ' {
+		d.pos++
+	}
+
+	if d.groupStart {
+		d.groupStart = false
+		switch {
+		case word == "htmltag" && d.ignorable:
+			d.state.htmltag = true
+		case d.ignorable || rtfSkippedDestinations[word]:
+			d.state.skip = true
+		}
+	}
+
+	switch word {
+	case "fromhtml":
+		d.fromHTML = !hasParam || param == 1
+	case "fromtext":
+		d.fromText = true
+	case "htmlrtf":
+		d.flush()
+		d.state.htmlrtf = !hasParam || param != 0
+	case "ansicpg":
+		if charset := codePageCharset(param); charset != "" {
+			d.flush()
+			d.charset = charset
+		}
+	case "uc":
+		d.state.uc = param
+	case "u":
+		d.flush()
+		d.unicode = 0
+		if param < 0 {
+			param += 0x10000
+		}
+		d.text(string(rune(param)))
+		d.unicode = d.state.uc
+	default:
+		if s, ok := rtfSymbols[word]; ok {
+			d.flush()
+			d.text(s)
+		}
+	}
+}
+
+// emitting reports whether content at the current position belongs to the body
+func (d *rtfDecoder) emitting() bool {
+	return !d.state.skip && (d.state.htmltag || !d.state.htmlrtf)
+}
+
+func (d *rtfDecoder) text(s string) {
+	if d.unicode > 0 && utf8.RuneCountInString(s) == 1 {
+		d.unicode--
+		return
+	}
+
+	if d.emitting() {
+		d.out.WriteString(s)
+	}
+}
+
+// flush writes the pending \'hh bytes decoded from the code page set by \ansicpg, Windows-1252 by default
+// and for the code pages which aren't supported
+func (d *rtfDecoder) flush() {
+	if len(d.bytes) > 0 {
+		s, _ := decodeCharset(d.bytes, d.charset)
+		d.out.WriteString(s)
+		d.bytes = d.bytes[:0]
+	}
+}
+
+func isRTFLetter(c byte) bool {
+	return c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z'
+}
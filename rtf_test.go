@@ -0,0 +1,146 @@
+package parsemail
+
+import (
+	"encoding/binary"
+	"runtime"
+	"testing"
+)
+
+func TestDecompressRTF(t *testing.T) {
+	var testData = map[int]struct {
+		data     []byte
+		expected string
+		err      bool
+	}{
+		1: {data: compressedRTFExample, expected: "{\\rtf1\\ansi\\ansicpg1252\\pard hello world}\r\n"},
+		2: {data: append(append([]byte{0x14, 0, 0, 0, 0x08, 0, 0, 0}, []byte("MELA")...), append([]byte{0, 0, 0, 0}, []byte("{\\rtf1}\n")...)...), expected: "{\\rtf1}\n"},
+		3: {data: []byte{0x2d, 0, 0, 0}, err: true},
+		4: {data: withRawSize(compressedRTFExample, 0xFFFFFFF0), expected: "{\\rtf1\\ansi\\ansicpg1252\\pard hello world}\r\n"},
+	}
+
+	for index, td := range testData {
+		got, err := DecompressRTF(td.data)
+		if td.err {
+			if err == nil {
+				t.Errorf("[Test Case %v] Expected error", index)
+			}
+			continue
+		}
+
+		if err != nil {
+			t.Errorf("[Test Case %v] %v", index, err)
+		} else if string(got) != td.expected {
+			t.Errorf("[Test Case %v] Wrong output. Expected: %q, Got: %q", index, td.expected, got)
+		}
+	}
+}
+
+func TestDecompressRTFHugeRawSize(t *testing.T) {
+	var before, after runtime.MemStats
+	runtime.ReadMemStats(&before)
+	for i := 0; i < 10; i++ {
+		if _, err := DecompressRTF(withRawSize(compressedRTFExample, 0xFFFFFFF0)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	runtime.ReadMemStats(&after)
+
+	if allocated := after.TotalAlloc - before.TotalAlloc; allocated > 1<<20 {
+		t.Errorf("Output buffer sized from the header, allocated %v bytes", allocated)
+	}
+}
+
+// withRawSize returns a copy of the compressed rtf with the RawSize header field replaced
+func withRawSize(data []byte, rawSize uint32) []byte {
+	data = append([]byte{}, data...)
+	binary.LittleEndian.PutUint32(data[4:], rawSize)
+
+	return data
+}
+
+func TestDecodeEncapsulatedRTF(t *testing.T) {
+	var testData = map[int]struct {
+		rtf         string
+		body        string
+		contentType string
+		err         bool
+	}{
+		1: {
+			rtf: `{\rtf1\ansi\ansicpg1252\fromhtml1 \deff0{\fonttbl {\f0\fswiss Arial;}{\f1\fmodern Courier New;}}
+{\colortbl\red0\green0\blue0;\red0\green0\blue255;}
+\uc1\pard\plain\deftab360 \f0\fs20 {\*\htmltag19 <html>}
+{\*\htmltag34 <head>}
+{\*\htmltag161 <title>}
+Test
+{\*\htmltag169 </title>}
+{\*\htmltag2 \par }
+{\*\htmltag41 </head>}
+{\*\htmltag50 <body>}\htmlrtf \lang1033 \htmlrtf0
+{\*\htmltag64 <p>}\htmlrtf {\htmlrtf0
+{\*\htmltag84 <b>}\htmlrtf {\b \htmlrtf0 bold\htmlrtf }\htmlrtf0
+{\*\htmltag92 </b>} caf\'e9 \u8364?
+{\*\htmltag72 </p>}\htmlrtf \par}\htmlrtf0
+{\*\htmltag58 </body>}
+{\*\htmltag27 </html>}}`,
+			body:        "<html><head><title>Test</title>\r\n</head><body><p><b>bold</b> café €</p></body></html>",
+			contentType: "text/html",
+		},
+		2: {
+			rtf:         `{\rtf1\ansi\fromtext \fbidis \deff0{\fonttbl{\f0\fswiss Arial;}}\pard\plain\f0\fs20 Hello\par second line\tab end\par }`,
+			body:        "Hello\r\nsecond line\tend\r\n",
+			contentType: "text/plain",
+		},
+		3: {
+			rtf: `{\rtf1\ansi\deff0 {\fonttbl {\f0 Times;}}\f0 plain rtf\par}`,
+			err: true,
+		},
+		4: {
+			rtf:         `{\rtf1\ansi\ansicpg1251\fromtext \deff0{\fonttbl{\f0\fswiss\fcharset204 Arial;}}\pard\plain\f0 \'cf\'f0\'e8\'e2\'e5\'f2, \'ec\'e8\'f0\par }`,
+			body:        "Привет, мир\r\n",
+			contentType: "text/plain",
+		},
+		5: {
+			rtf:         `{\rtf1\ansi\ansicpg1250\fromtext \pard\plain \'8elu\'9dou\'e8k\'fd k\'f9\'f2\par }`,
+			body:        "Žluťoučký kůň\r\n",
+			contentType: "text/plain",
+		},
+		6: {
+			rtf:         `{\rtf1\ansi\ansicpg932\fromtext \pard\plain caf\'e9\par }`,
+			body:        "café\r\n",
+			contentType: "text/plain",
+		},
+	}
+
+	for index, td := range testData {
+		body, contentType, err := DecodeEncapsulatedRTF([]byte(td.rtf))
+		if td.err {
+			if err == nil {
+				t.Errorf("[Test Case %v] Expected error", index)
+			}
+			continue
+		}
+
+		if err != nil {
+			t.Errorf("[Test Case %v] %v", index, err)
+			continue
+		}
+		if body != td.body {
+			t.Errorf("[Test Case %v] Wrong body. Expected: %q, Got: %q", index, td.body, body)
+		}
+		if contentType != td.contentType {
+			t.Errorf("[Test Case %v] Wrong content type. Expected: %s, Got: %s", index, td.contentType, contentType)
+		}
+	}
+}
+
+func TestSetRTFBodies(t *testing.T) {
+	email := Email{RTFBody: `{\rtf1\ansi\fromhtml1 {\*\htmltag64 <p>}Hi{\*\htmltag72 </p>}}`, TextBody: "Hi"}
+	setRTFBodies(&email)
+
+	if email.HTMLBody != "<p>Hi</p>" {
+		t.Errorf("Wrong html body: %q", email.HTMLBody)
+	}
+	if email.TextBody != "Hi" {
+		t.Errorf("Text body shouldn't change: %q", email.TextBody)
+	}
+}
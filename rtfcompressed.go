@@ -0,0 +1,98 @@
+package parsemail
+
+import (
+	"encoding/binary"
+	"fmt"
+	"hash/crc32"
+)
+
+// Compressed RTF format (MS-OXRTFCP) used by PR_RTF_COMPRESSED properties
+
+const (
+	rtfCompressedHeaderSize = 16
+	rtfCompressed           = 0x75465A4C // "LZFu"
+	rtfUncompressed         = 0x414C454D // "MELA"
+	rtfDictionarySize       = 4096
+)
+
+const rtfPrebuffer = "{\\rtf1\\ansi\\mac\\deff0\\deftab720{\\fonttbl;}{\\f0\\fnil \\froman \\fswiss \\fmodern \\fscript \\fdecor MS Sans SerifSymbolArialTimes New RomanCourier{\\colortbl\\red0\\green0\\blue0\r\n\\par \\pard\\plain\\f0\\fs20\\b\\i\\u\\tab\\tx"
+
+// DecompressRTF decompresses the content of a PR_RTF_COMPRESSED property
+func DecompressRTF(data []byte) ([]byte, error) {
+	if len(data) < rtfCompressedHeaderSize {
+		return nil, fmt.Errorf("compressed rtf too short")
+	}
+
+	compSize := int(binary.LittleEndian.Uint32(data[0:]))
+	rawSize := int(binary.LittleEndian.Uint32(data[4:]))
+	compType := binary.LittleEndian.Uint32(data[8:])
+	crc := binary.LittleEndian.Uint32(data[12:])
+
+	end := compSize + 4
+	if end > len(data) || end < rtfCompressedHeaderSize {
+		end = len(data)
+	}
+	content := data[rtfCompressedHeaderSize:end]
+
+	switch compType {
+	case rtfUncompressed:
+		if rawSize < len(content) {
+			content = content[:rawSize]
+		}
+		return content, nil
+	case rtfCompressed:
+	default:
+		return nil, fmt.Errorf("unknown compressed rtf type: %x", compType)
+	}
+
+	// the checksum is a CRC-32 without the initial and final inversion
+	if ^crc32.Update(0xFFFFFFFF, crc32.IEEETable, content) != crc {
+		return nil, fmt.Errorf("compressed rtf checksum mismatch")
+	}
+
+	var dict [rtfDictionarySize]byte
+	copy(dict[:], rtfPrebuffer)
+	write := len(rtfPrebuffer)
+
+	// rawSize comes from the untrusted header, the buffer is only presized up to the largest possible output
+	// of the content, every control byte expands to at most 8 references of 17 bytes
+	capacity := rawSize
+	if limit := len(content) * 17; capacity > limit {
+		capacity = limit
+	}
+	out := make([]byte, 0, capacity)
+	for pos := 0; pos < len(content); {
+		control := content[pos]
+		pos++
+
+		for bit := uint(0); bit < 8 && pos < len(content); bit++ {
+			if control&(1<<bit) == 0 {
+				out = append(out, content[pos])
+				dict[write] = content[pos]
+				write = (write + 1) % rtfDictionarySize
+				pos++
+				continue
+			}
+
+			if pos+1 >= len(content) {
+				return nil, fmt.Errorf("truncated compressed rtf")
+			}
+			ref := int(content[pos])<<8 | int(content[pos+1])
+			pos += 2
+
+			offset, length := ref>>4, ref&0xF+2
+			if offset == write {
+				return out, nil
+			}
+
+			for i := 0; i < length; i++ {
+				c := dict[(offset+i)%rtfDictionarySize]
+				out = append(out, c)
+				dict[write] = c
+				write = (write + 1) % rtfDictionarySize
+			}
+		}
+	}
+
+	return out, nil
+}
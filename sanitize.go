@@ -0,0 +1,416 @@
+package parsemail
+
+import (
+	"html"
+	"regexp"
+	"strings"
+)
+
+// Sanitization of HTML bodies for display in web pages
+
+// SanitizeOptions configure SanitizeHTML
+type SanitizeOptions struct {
+	// AllowRemoteImages keeps the images loaded from remote servers, which are blocked by default
+	// as they reveal when and where the email is read
+	AllowRemoteImages bool
+	// AllowStyleSheets keeps style elements with their CSS sanitized. They are removed by default
+	// as their rules apply to the whole page the email is rendered in.
+	AllowStyleSheets bool
+}
+
+// SanitizeReport lists what SanitizeHTML removed
+type SanitizeReport struct {
+	// BlockedImages are the URLs of the remote images which were blocked
+	BlockedImages []string
+	// RemovedElements are the names of the dangerous elements which were removed, like scripts and forms
+	RemovedElements []string
+	// RemovedAttributes are the names of the attributes which were removed for being dangerous,
+	// like event handlers and links to scripts
+	RemovedAttributes []string
+}
+
+// sanitizeAllowedElements are kept along with their allowed attributes, other elements are replaced by their content
+var sanitizeAllowedElements = map[string]bool{
+	"a": true, "abbr": true, "address": true, "article": true, "aside": true, "b": true, "bdi": true, "bdo": true,
+	"big": true, "blockquote": true, "br": true, "caption": true, "center": true, "cite": true, "code": true,
+	"col": true, "colgroup": true, "dd": true, "del": true, "details": true, "dfn": true, "div": true, "dl": true,
+	"dt": true, "em": true, "figcaption": true, "figure": true, "font": true, "footer": true, "h1": true, "h2": true,
+	"h3": true, "h4": true, "h5": true, "h6": true, "header": true, "hr": true, "i": true, "img": true, "ins": true,
+	"kbd": true, "li": true, "main": true, "mark": true, "nav": true, "ol": true, "p": true, "pre": true, "q": true,
+	"s": true, "samp": true, "section": true, "small": true, "span": true, "strike": true, "strong": true,
+	"sub": true, "summary": true, "sup": true, "table": true, "tbody": true, "td": true, "tfoot": true, "th": true,
+	"thead": true, "time": true, "tr": true, "tt": true, "u": true, "ul": true, "var": true, "wbr": true,
+}
+
+// sanitizeRemovedElements are removed along with their content
+var sanitizeRemovedElements = map[string]bool{
+	"script": true, "style": true, "head": true, "title": true, "template": true, "iframe": true, "frame": true,
+	"frameset": true, "object": true, "embed": true, "applet": true, "noscript": true, "svg": true, "math": true,
+	"meta": true, "link": true, "base": true, "input": true, "button": true, "select": true, "textarea": true,
+	"option": true, "audio": true, "video": true, "canvas": true, "xmp": true, "noembed": true, "noframes": true,
+}
+
+// sanitizeAllowedAttributes are kept on all the allowed elements
+var sanitizeAllowedAttributes = map[string]bool{
+	"align": true, "alt": true, "bgcolor": true, "border": true, "cellpadding": true, "cellspacing": true,
+	"class": true, "color": true, "cols": true, "colspan": true, "dir": true, "face": true, "height": true,
+	"hspace": true, "lang": true, "rows": true, "rowspan": true, "size": true, "span": true, "start": true,
+	"title": true, "type": true, "valign": true, "vspace": true, "width": true, "datetime": true,
+}
+
+var sanitizeLinkSchemes = []string{"http:", "https:", "mailto:", "tel:"}
+
+var sanitizeDataImage = regexp.MustCompile(`(?i)^data:image/(png|gif|jpe?g|webp|bmp);base64,[a-z0-9+/=\s]*$`)
+
+var sanitizeCSSURL = regexp.MustCompile(`(?i)url\(\s*(?:"([^"]*)"|'([^']*)'|([^)]*))\s*\)`)
+
+// sanitizeCSSImageFunction are the CSS functions which load the images or other resources given as plain strings,
+// like url() does
+var sanitizeCSSImageFunction = regexp.MustCompile(`(?i)(?:-webkit-)?(?:image-set|image|cross-fade|src)\(`)
+
+var sanitizeCSSString = regexp.MustCompile(`"([^"]*)"|'([^']*)'`)
+
+// sanitizeCSSForbidden are found in CSS which runs scripts, loads other resources or escapes the email's area
+var sanitizeCSSForbidden = regexp.MustCompile(`(?i)expression\s*\(|javascript:|vbscript:|behavior\s*:|-moz-binding|@import|position\s*:\s*(fixed|absolute|sticky)|\\`)
+
+// SanitizeHTML makes an HTML body safe to be rendered in a web page. Scripts, event handlers, forms, frames and
+// dangerous CSS are removed, links are limited to http, https, mailto and tel URLs and remote images are blocked
+// unless opts allow them. Inline images referenced as cid: URLs are kept.
+//
+// The body is parsed by a lenient parser rather than by the full HTML5 algorithm, so misnested tags may end up
+// nested differently than a browser would nest them, and the content of unterminated comments and of
+// CDATA sections, which are bogus comments in HTML, is dropped. The result is safe regardless, as it is
+// written out from the parsed tree with all text and attribute values escaped.
+func SanitizeHTML(body string, opts SanitizeOptions) (string, SanitizeReport) {
+	s := &sanitizer{opts: opts, seen: map[string]bool{}}
+
+	var out strings.Builder
+	s.writeChildren(&out, parseHTML(body))
+
+	return out.String(), s.report
+}
+
+type sanitizer struct {
+	opts   SanitizeOptions
+	report SanitizeReport
+	seen   map[string]bool
+}
+
+func (s *sanitizer) writeChildren(out *strings.Builder, n *htmlNode) {
+	for _, c := range n.children {
+		s.write(out, c)
+	}
+}
+
+func (s *sanitizer) write(out *strings.Builder, n *htmlNode) {
+	switch n.typ {
+	case htmlTextNode:
+		out.WriteString(html.EscapeString(n.data))
+		return
+	case htmlElementNode:
+	default:
+		return
+	}
+
+	switch {
+	case n.name == "style" && s.opts.AllowStyleSheets:
+		var css strings.Builder
+		for _, c := range n.children {
+			css.WriteString(c.data)
+		}
+		out.WriteString("<style>" + s.sanitizeStyleSheet(css.String()) + "</style>")
+		return
+	case sanitizeRemovedElements[n.name]:
+		s.removedElement(n.name)
+		return
+	case !sanitizeAllowedElements[n.name]:
+		if n.name == "form" {
+			s.removedElement(n.name)
+		}
+		s.writeChildren(out, n)
+		return
+	}
+
+	out.WriteString("<" + n.name)
+	for _, a := range s.sanitizeAttributes(n) {
+		out.WriteString(" " + a.name + `="` + html.EscapeString(a.value) + `"`)
+	}
+	out.WriteString(">")
+
+	if htmlVoidElements[n.name] {
+		return
+	}
+
+	s.writeChildren(out, n)
+	out.WriteString("</" + n.name + ">")
+}
+
+func (s *sanitizer) sanitizeAttributes(n *htmlNode) (attrs []htmlAttribute) {
+	for _, a := range n.attrs {
+		switch {
+		case strings.HasPrefix(a.name, "on"):
+			s.removedAttribute(a.name)
+		case a.name == "style":
+			if style := s.sanitizeDeclarations(a.value); style != "" {
+				attrs = append(attrs, htmlAttribute{a.name, style})
+			}
+		case a.name == "href" && n.name == "a":
+			if isSafeLink(a.value) {
+				attrs = append(attrs, a, htmlAttribute{"rel", "noopener noreferrer"})
+			} else {
+				s.removedAttribute(a.name)
+			}
+		case a.name == "target" && n.name == "a":
+			attrs = append(attrs, htmlAttribute{a.name, "_blank"})
+		case a.name == "src" && n.name == "img", a.name == "background":
+			if src, ok := s.sanitizeImageURL(a.value); ok {
+				attrs = append(attrs, htmlAttribute{a.name, src})
+			}
+		case sanitizeAllowedAttributes[a.name]:
+			attrs = append(attrs, a)
+		}
+	}
+
+	return
+}
+
+// sanitizeImageURL keeps cid: and data: images and remote images when they are allowed
+func (s *sanitizer) sanitizeImageURL(url string) (string, bool) {
+	url = strings.TrimSpace(url)
+	scheme := urlScheme(url)
+
+	switch {
+	case scheme == "cid:":
+		return url, true
+	case scheme == "data:":
+		return url, sanitizeDataImage.MatchString(url)
+	case scheme == "http:" || scheme == "https:" || strings.HasPrefix(url, "//"):
+		if s.opts.AllowRemoteImages {
+			return url, true
+		}
+		s.blockedImage(url)
+	}
+
+	return "", false
+}
+
+// sanitizeDeclarations filters the declarations of a style attribute or rule
+func (s *sanitizer) sanitizeDeclarations(style string) string {
+	var kept []string
+	for _, d := range splitCSS(removeCSSComments(style), ';') {
+		d = strings.TrimSpace(d)
+		if sanitizeCSSForbidden.MatchString(d) {
+			s.removedAttribute("style")
+			continue
+		}
+		if d == "" || !strings.Contains(d, ":") {
+			continue
+		}
+
+		var urls []string
+		for _, m := range sanitizeCSSURL.FindAllStringSubmatch(d, -1) {
+			urls = append(urls, m[1]+m[2]+m[3])
+		}
+		for _, loc := range sanitizeCSSImageFunction.FindAllStringIndex(d, -1) {
+			args := d[loc[1]:closingParenthesis(d, loc[1])]
+			for _, m := range sanitizeCSSString.FindAllStringSubmatch(args, -1) {
+				urls = append(urls, m[1]+m[2])
+			}
+		}
+
+		safe := true
+		for _, url := range urls {
+			if _, ok := s.sanitizeImageURL(url); !ok {
+				safe = false
+			}
+		}
+		if safe {
+			kept = append(kept, d)
+		}
+	}
+
+	return strings.Join(kept, "; ")
+}
+
+// sanitizeStyleSheet filters the declarations of every rule of a style sheet, dropping at-rules other than media queries
+func (s *sanitizer) sanitizeStyleSheet(css string) string {
+	css = removeCSSComments(css)
+
+	var out strings.Builder
+	for {
+		open := strings.IndexByte(css, '{')
+		if open < 0 {
+			s.removedStatements(css)
+			break
+		}
+		end := matchingBrace(css, open)
+
+		// statements like @import end with a semicolon before the selector of the next rule
+		selector := css[:open]
+		if i := strings.LastIndexByte(selector, ';'); i >= 0 {
+			s.removedStatements(selector[:i])
+			selector = selector[i+1:]
+		}
+		selector = strings.TrimSpace(selector)
+
+		switch {
+		case strings.HasPrefix(selector, "@media"):
+			out.WriteString(selector + " {\n" + s.sanitizeStyleSheet(css[open+1:end]) + "}\n")
+		case strings.HasPrefix(selector, "@") || strings.ContainsAny(selector, "<\\"):
+		default:
+			out.WriteString(selector + " { " + s.sanitizeDeclarations(css[open+1:end]) + " }\n")
+		}
+
+		if end >= len(css) {
+			break
+		}
+		css = css[end+1:]
+	}
+
+	return strings.Replace(out.String(), "</", `<\/`, -1)
+}
+
+// removedStatements reports the dangerous statements like @import, which are never kept
+func (s *sanitizer) removedStatements(css string) {
+	if sanitizeCSSForbidden.MatchString(css) {
+		s.removedAttribute("style")
+	}
+}
+
+func (s *sanitizer) blockedImage(url string) {
+	if !s.seen["image "+url] {
+		s.seen["image "+url] = true
+		s.report.BlockedImages = append(s.report.BlockedImages, url)
+	}
+}
+
+func (s *sanitizer) removedElement(name string) {
+	if !s.seen["element "+name] {
+		s.seen["element "+name] = true
+		s.report.RemovedElements = append(s.report.RemovedElements, name)
+	}
+}
+
+func (s *sanitizer) removedAttribute(name string) {
+	if !s.seen["attribute "+name] {
+		s.seen["attribute "+name] = true
+		s.report.RemovedAttributes = append(s.report.RemovedAttributes, name)
+	}
+}
+
+// isSafeLink accepts links to http, https, mailto and tel URLs and to fragments
+func isSafeLink(url string) bool {
+	url = strings.TrimSpace(url)
+	if strings.HasPrefix(url, "#") {
+		return true
+	}
+
+	return containsString(sanitizeLinkSchemes, urlScheme(url))
+}
+
+// urlScheme returns the lowercased scheme of url including the colon, ignoring the control characters
+// and white space browsers ignore in schemes, like "java\tscript:"
+func urlScheme(url string) string {
+	var scheme strings.Builder
+	for i := 0; i < len(url); i++ {
+		c := url[i]
+		switch {
+		case c <= ' ':
+			continue
+		case c == ':':
+			return strings.ToLower(scheme.String()) + ":"
+		case isHTMLLetter(c) || c >= '0' && c <= '9' || c == '+' || c == '-' || c == '.':
+			scheme.WriteByte(c)
+		default:
+			return ""
+		}
+	}
+
+	return ""
+}
+
+func removeCSSComments(css string) string {
+	for {
+		start := strings.Index(css, "/*")
+		if start < 0 {
+			return css
+		}
+		end := strings.Index(css[start+2:], "*/")
+		if end < 0 {
+			return css[:start]
+		}
+		css = css[:start] + css[start+2+end+2:]
+	}
+}
+
+// splitCSS splits css on sep outside of quotes and parentheses
+func splitCSS(css string, sep byte) (parts []string) {
+	depth := 0
+	var quote byte
+	start := 0
+	for i := 0; i < len(css); i++ {
+		c := css[i]
+		switch {
+		case quote != 0:
+			if c == quote {
+				quote = 0
+			}
+		case c == '"' || c == '\'':
+			quote = c
+		case c == '(':
+			depth++
+		case c == ')' && depth > 0:
+			depth--
+		case c == sep && depth == 0:
+			parts = append(parts, css[start:i])
+			start = i + 1
+		}
+	}
+
+	return append(parts, css[start:])
+}
+
+// closingParenthesis returns the index of the parenthesis closing the function whose arguments start at start
+// outside of quotes, or the length of css
+func closingParenthesis(css string, start int) int {
+	depth := 0
+	var quote byte
+	for i := start; i < len(css); i++ {
+		c := css[i]
+		switch {
+		case quote != 0:
+			if c == quote {
+				quote = 0
+			}
+		case c == '"' || c == '\'':
+			quote = c
+		case c == '(':
+			depth++
+		case c == ')':
+			if depth == 0 {
+				return i
+			}
+			depth--
+		}
+	}
+
+	return len(css)
+}
+
+// matchingBrace returns the index of the brace closing the one at open, or the length of css
+func matchingBrace(css string, open int) int {
+	depth := 0
+	for i := open; i < len(css); i++ {
+		switch css[i] {
+		case '{':
+			depth++
+		case '}':
+			depth--
+			if depth == 0 {
+				return i
+			}
+		}
+	}
+
+	return len(css)
+}
@@ -0,0 +1,140 @@
+package parsemail
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestSanitizeHTML(t *testing.T) {
+	var testData = map[int]struct {
+		html   string
+		opts   SanitizeOptions
+		clean  string
+		report SanitizeReport
+	}{
+		1: {
+			html:  `<html><head><title>T</title><script>alert(1)</script></head><body><p onclick="alert(1)" class="x">Hi &amp; <b>bye</b></p></body></html>`,
+			clean: `<p class="x">Hi &amp; <b>bye</b></p>`,
+			report: SanitizeReport{
+				RemovedElements:   []string{"head"},
+				RemovedAttributes: []string{"onclick"},
+			},
+		},
+		2: {
+			html: `<a href="https://example.com/?a=1&amp;b=2" target="_self">ok</a> <a href=" java&#9;script:alert(1)">bad</a>` +
+				`<a href="mailto:a@example.com">mail</a>`,
+			clean: `<a href="https://example.com/?a=1&amp;b=2" rel="noopener noreferrer" target="_blank">ok</a> <a>bad</a>` +
+				`<a href="mailto:a@example.com" rel="noopener noreferrer">mail</a>`,
+			report: SanitizeReport{RemovedAttributes: []string{"href"}},
+		},
+		3: {
+			html: `<img src="cid:logo@example.com" alt="Logo"><img src="https://tracker.example.com/open.gif" width="1">` +
+				`<img src="data:image/png;base64,iVBORw0KGgo="><img src="data:text/html;base64,PHNjcmlwdD4=">` +
+				`<table background="http://example.com/bg.png"><tr><td>x</td></tr></table>`,
+			clean: `<img src="cid:logo@example.com" alt="Logo"><img width="1">` +
+				`<img src="data:image/png;base64,iVBORw0KGgo="><img>` +
+				`<table><tr><td>x</td></tr></table>`,
+			report: SanitizeReport{
+				BlockedImages: []string{"https://tracker.example.com/open.gif", "http://example.com/bg.png"},
+			},
+		},
+		4: {
+			html:  `<img src="https://example.com/a.png">`,
+			opts:  SanitizeOptions{AllowRemoteImages: true},
+			clean: `<img src="https://example.com/a.png">`,
+		},
+		5: {
+			html: `<div style="color: red; background: url('https://example.com/bg.png'); width: expression(alert(1)); ` +
+				`position: fixed; background-image: url(cid:bg@example.com)">x</div>`,
+			clean: `<div style="color: red; background-image: url(cid:bg@example.com)">x</div>`,
+			report: SanitizeReport{
+				BlockedImages:     []string{"https://example.com/bg.png"},
+				RemovedAttributes: []string{"style"},
+			},
+		},
+		6: {
+			html: `<form action="https://evil.example.com/"><p>Password:</p><input name="p"><button>Send</button></form>` +
+				`<iframe src="https://example.com/"></iframe><custom-tag>text</custom-tag><!-- comment -->`,
+			clean:  `<p>Password:</p>text`,
+			report: SanitizeReport{RemovedElements: []string{"form", "input", "button", "iframe"}},
+		},
+		7: {
+			html: `<style>@import url(https://example.com/a.css); p { color: blue; behavior: url(x.htc) } ` +
+				`@media (max-width: 600px) { td { width: 100%; background: url(http://example.com/m.png) } } ` +
+				`@font-face { font-family: x; src: url(https://example.com/x.woff) }</style><p>x</p>`,
+			opts:  SanitizeOptions{AllowStyleSheets: true},
+			clean: "<style>p { color: blue }\n@media (max-width: 600px) {\ntd { width: 100% }\n}\n</style><p>x</p>",
+			report: SanitizeReport{
+				BlockedImages:     []string{"http://example.com/m.png"},
+				RemovedAttributes: []string{"style"},
+			},
+		},
+		8: {
+			html:   `<style>p { color: red }</style><p>x</p>`,
+			clean:  `<p>x</p>`,
+			report: SanitizeReport{RemovedElements: []string{"style"}},
+		},
+		9: {
+			html: `<div style="color: red; background-image: image-set(&quot;https://example.com/a.png&quot; 1x, 'cid:a@example.com' 2x); ` +
+				`background: -webkit-image-set('http://example.com/b.png' 1x); ` +
+				`list-style-image: image(ltr &quot;https://example.com/c.png&quot;); ` +
+				`background-image: cross-fade('https://example.com/d.png', url(cid:e@example.com), 50%); ` +
+				`background-image: image-set('cid:f@example.com' 1x)">x</div>`,
+			clean: `<div style="color: red; background-image: image-set(&#39;cid:f@example.com&#39; 1x)">x</div>`,
+			report: SanitizeReport{
+				BlockedImages: []string{"https://example.com/a.png", "http://example.com/b.png", "https://example.com/c.png", "https://example.com/d.png"},
+			},
+		},
+		10: {
+			html:  `<style>@import "https://example.com/a.css"; p { color: blue }</style><p style="@import 'https://example.com/b.css'">x</p>`,
+			opts:  SanitizeOptions{AllowStyleSheets: true},
+			clean: "<style>p { color: blue }\n</style><p>x</p>",
+			report: SanitizeReport{
+				RemovedAttributes: []string{"style"},
+			},
+		},
+		11: {
+			html:   `<style>p { color: blue } @import 'https://example.com/a.css';</style>`,
+			opts:   SanitizeOptions{AllowStyleSheets: true},
+			clean:  "<style>p { color: blue }\n</style>",
+			report: SanitizeReport{RemovedAttributes: []string{"style"}},
+		},
+		12: {
+			html:  `<b><i>x</b>y</i>z<p><div>a</p>b</div></br>`,
+			clean: `<b><i>x</i></b>yz<p></p><div>ab</div>`,
+		},
+		13: {
+			html: `<img src=https://example.com/a.png alt=a&amp;b><a href=javascript:alert(1) title=t>x</a>` +
+				`<a href=http://example.com/?a=1&b=2>y</a><img src=x onerror=alert(1)//>`,
+			clean: `<img alt="a&amp;b"><a title="t">x</a>` +
+				`<a href="http://example.com/?a=1&amp;b=2" rel="noopener noreferrer">y</a><img>`,
+			report: SanitizeReport{
+				BlockedImages:     []string{"https://example.com/a.png"},
+				RemovedAttributes: []string{"href", "onerror"},
+			},
+		},
+		14: {
+			html:  `a<!-->b<!--->c<!-- <script>alert(1)</script> -->d<!--[if mso]><img src="https://example.com/t.gif"><![endif]-->e<!-- f`,
+			clean: `abcde`,
+		},
+		15: {
+			html:  `<![CDATA[<script>alert(1)</script>]]>x<p title="a>b">y</p><scr<script>ipt>alert(1)</script>`,
+			clean: `alert(1)]]&gt;x<p title="a&gt;b">y</p>ipt&gt;alert(1)`,
+		},
+		16: {
+			html:   `<div style="color: red; background-image: src(&quot;http://example.com/a.png&quot;); list-style-image: SRC('cid:b@example.com')">x</div>`,
+			clean:  `<div style="color: red; list-style-image: SRC(&#39;cid:b@example.com&#39;)">x</div>`,
+			report: SanitizeReport{BlockedImages: []string{"http://example.com/a.png"}},
+		},
+	}
+
+	for index, td := range testData {
+		clean, report := SanitizeHTML(td.html, td.opts)
+		if clean != td.clean {
+			t.Errorf("[Test Case %v] Wrong html.\nExpected: %q\nGot:      %q", index, td.clean, clean)
+		}
+		if !reflect.DeepEqual(report, td.report) {
+			t.Errorf("[Test Case %v] Wrong report.\nExpected: %+v\nGot:      %+v", index, td.report, report)
+		}
+	}
+}
@@ -0,0 +1,312 @@
+package parsemail
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"reflect"
+	"strconv"
+	"strings"
+)
+
+const maxDepthOfSourceParts = 16
+
+// sourceMessage keeps the original bytes of a parsed message together with the location of every
+// MIME part that WriteTo would generate for the unmodified email, so untouched parts can be copied
+// over byte-for-byte instead of being regenerated. The parts are matched by the fingerprints of the
+// generated nodes, which identify data readers by their address, so no data is read or encoded at parse time.
+type sourceMessage struct {
+	raw    []byte
+	root   *sourcePart
+	header string
+	// state fingerprints the fields of the parsed email, see Email.fingerprintState
+	state string
+	// textBody and htmlBody are the still encoded bodies returned by Parse
+	textBody string
+	htmlBody string
+	parts    map[string]*sourcePart
+}
+
+// sourcePart is a MIME part of the original message, start and end enclose its header and body
+// without the line break belonging to the following boundary delimiter
+type sourcePart struct {
+	start     int
+	bodyStart int
+	end       int
+	fields    []HeaderField
+	mediaType string
+	children  []*sourcePart
+}
+
+func newSourceMessage(raw []byte, email *Email) *sourceMessage {
+	tree, err := email.buildMIMETree()
+	if err != nil {
+		return nil
+	}
+
+	src := &sourceMessage{
+		raw:      raw,
+		root:     parseSourcePart(raw, 0, len(raw), 0, contentTypeTextPlain),
+		header:   fingerprintHeader(email.messageHeader()),
+		state:    email.fingerprintState(),
+		textBody: email.TextBody,
+		htmlBody: email.HTMLBody,
+		parts:    map[string]*sourcePart{},
+	}
+	src.align(tree, src.root)
+
+	return src
+}
+
+// align records the source part for n and all of its descendants as long as their structure matches,
+// the children of multiparts whose subtype differs are still recorded
+func (src *sourceMessage) align(n *mimeNode, sp *sourcePart) bool {
+	if (n.children == nil) != (sp.children == nil) {
+		return false
+	}
+
+	if n.children != nil {
+		if len(n.children) != len(sp.children) {
+			return false
+		}
+
+		aligned := true
+		for i := range n.children {
+			if !src.align(n.children[i], sp.children[i]) {
+				aligned = false
+			}
+		}
+		if !aligned {
+			return false
+		}
+	}
+
+	if n.mediaType() != sp.mediaType {
+		return false
+	}
+
+	src.parts[n.fingerprint()] = sp
+
+	return true
+}
+
+// lookup returns the source part n was generated from, if n is unmodified
+func (src *sourceMessage) lookup(n *mimeNode) *sourcePart {
+	if src == nil {
+		return nil
+	}
+
+	return src.parts[n.fingerprint()]
+}
+
+// contentFields returns the header fields describing the content of the source part
+func (sp *sourcePart) contentFields() (fields []HeaderField) {
+	for _, f := range sp.fields {
+		switch strings.ToLower(f.Name) {
+		case "content-type", "content-transfer-encoding":
+			fields = append(fields, f)
+		}
+	}
+
+	return
+}
+
+// parseSourcePart parses the part in raw[start:end], defaultType is the media type of parts without a Content-Type
+func parseSourcePart(raw []byte, start, end, depth int, defaultType string) *sourcePart {
+	fields, bodyOffset := parseRawHeaders(raw[start:end])
+	sp := &sourcePart{
+		start:     start,
+		bodyStart: start + int(bodyOffset),
+		end:       end,
+		fields:    fields,
+	}
+
+	contentType := ""
+	for _, f := range fields {
+		if strings.EqualFold(f.Name, "Content-Type") {
+			contentType = unfoldHeaderValue(f.RawValue)
+		}
+	}
+
+	if contentType == "" {
+		contentType = defaultType
+	}
+
+	mediaType, params, err := parseContentType(contentType)
+	if err != nil {
+		return sp
+	}
+	sp.mediaType = mediaType
+
+	if strings.HasPrefix(mediaType, "multipart/") && params["boundary"] != "" && depth < maxDepthOfSourceParts {
+		childType := contentTypeTextPlain
+		if mediaType == contentTypeMultipartDigest {
+			childType = contentTypeMessageRFC822
+		}
+
+		sp.children = []*sourcePart{}
+		for _, span := range splitMultipartBody(raw, sp.bodyStart, end, params["boundary"]) {
+			sp.children = append(sp.children, parseSourcePart(raw, span[0], span[1], depth+1, childType))
+		}
+	}
+
+	return sp
+}
+
+// splitMultipartBody returns the spans of the parts enclosed by the boundary delimiters in raw[from:to]
+func splitMultipartBody(raw []byte, from, to int, boundary string) (spans [][2]int) {
+	delimiter := []byte("--" + boundary)
+	partStart := -1
+
+	for pos := from; pos < to; {
+		i := bytes.Index(raw[pos:to], delimiter)
+		if i < 0 {
+			return
+		}
+		pos += i
+		if pos > from && raw[pos-1] != '\n' {
+			pos += len(delimiter)
+			continue
+		}
+
+		next := to
+		if i := bytes.IndexByte(raw[pos:to], '\n'); i >= 0 {
+			next = pos + i + 1
+		}
+
+		rest := bytes.TrimRight(raw[pos+len(delimiter):next], " \t\r\n")
+		if len(rest) == 0 || string(rest) == "--" {
+			if partStart >= 0 {
+				end := pos
+				if end > partStart && raw[end-1] == '\n' {
+					end--
+				}
+				if end > partStart && raw[end-1] == '\r' {
+					end--
+				}
+				spans = append(spans, [2]int{partStart, end})
+			}
+
+			if len(rest) != 0 {
+				return
+			}
+			partStart = next
+		}
+
+		pos = next
+	}
+
+	return
+}
+
+func (n *mimeNode) mediaType() string {
+	for _, f := range n.header {
+		if f.name == "Content-Type" {
+			mediaType, _, _ := parseContentType(f.value)
+			return mediaType
+		}
+	}
+
+	return contentTypeTextPlain
+}
+
+// fingerprint identifies the content of the node regardless of the generated multipart boundaries,
+// the data of leaves is identified by their key
+func (n *mimeNode) fingerprint() string {
+	if n.sum != "" {
+		return n.sum
+	}
+
+	h := sha256.New()
+	for _, f := range n.header {
+		if n.children != nil && f.name == "Content-Type" {
+			io.WriteString(h, n.mediaType()+"\n")
+			continue
+		}
+		io.WriteString(h, f.name+": "+f.value+"\n")
+	}
+	io.WriteString(h, strconv.Itoa(len(n.key))+":"+n.key+"\n")
+	h.Write(n.body)
+	for _, child := range n.children {
+		io.WriteString(h, child.fingerprint()+"\n")
+	}
+	n.sum = hex.EncodeToString(h.Sum(nil))
+
+	return n.sum
+}
+
+func fingerprintHeader(header []headerEntry) string {
+	h := sha256.New()
+	for _, f := range header {
+		io.WriteString(h, f.name+": "+f.value+"\n")
+	}
+
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+// isUnmodified reports whether the email was returned by Parse and none of the fields WriteTo reads changed since
+func (e *Email) isUnmodified() bool {
+	return e.source != nil && e.fingerprintState() == e.source.state
+}
+
+// fingerprintState identifies the fields WriteTo generates the message from. Data readers are identified by
+// their address rather than by their content, so taking the fingerprint doesn't consume them.
+// textBodyRebuilt records that TextBody was rebuilt from the decoded TextBodies, WriteTo then keeps generating
+// the text part from TextBodies and their charset rather than writing TextBody as edited UTF-8 text
+func (e *Email) textBodyRebuilt() {
+	if e.source != nil {
+		e.source.textBody = e.TextBody
+	}
+}
+
+func (e *Email) fingerprintState() string {
+	h := sha256.New()
+	for _, f := range e.messageHeader() {
+		io.WriteString(h, f.name+": "+f.value+"\n")
+	}
+
+	writeString := func(s string) {
+		io.WriteString(h, strconv.Itoa(len(s))+":"+s+"\n")
+	}
+	writeString(e.ContentType)
+	writeString(e.TextBody)
+	writeString(e.HTMLBody)
+	writeString(readerIdentity(e.Content))
+
+	for _, b := range e.TextBodies {
+		fmt.Fprintf(h, "text %q %v %s\n", b.ContentType, b.Params, readerIdentity(b.Data))
+	}
+	for _, b := range e.HTMLBodies {
+		fmt.Fprintf(h, "html %q %v %s\n", b.ContentType, b.Params, readerIdentity(b.Data))
+	}
+	for _, b := range e.AlternativeBodies {
+		fmt.Fprintf(h, "alternative %q %v %s\n", b.ContentType, b.Params, readerIdentity(b.Data))
+	}
+	for _, ef := range e.EmbeddedFiles {
+		fmt.Fprintf(h, "embedded %q %q %s\n", ef.CID, ef.ContentType, readerIdentity(ef.Data))
+	}
+	for _, at := range e.Attachments {
+		fmt.Fprintf(h, "attachment %q %q %s\n", at.Filename, at.ContentType, readerIdentity(at.Data))
+	}
+	for _, eb := range e.ExternalBodies {
+		fmt.Fprintf(h, "external %v\n", eb)
+	}
+	for _, m := range e.Digest {
+		fmt.Fprintf(h, "digest %p %v\n", m, m.isUnmodified())
+	}
+
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+// readerIdentity identifies r by its type and address
+func readerIdentity(r io.Reader) string {
+	v := reflect.ValueOf(r)
+	switch v.Kind() {
+	case reflect.Ptr, reflect.Map, reflect.Slice, reflect.Chan, reflect.Func, reflect.UnsafePointer:
+		return fmt.Sprintf("%T %x", r, v.Pointer())
+	}
+
+	return fmt.Sprintf("%T", r)
+}
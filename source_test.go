@@ -0,0 +1,198 @@
+package parsemail
+
+import (
+	"bytes"
+	"io/ioutil"
+	"strings"
+	"testing"
+)
+
+func TestWriteToPreservesSource(t *testing.T) {
+	var testData = map[int]struct {
+		mailData  string
+		modify    func(*Email)
+		preserved []string
+		changed   []string
+	}{
+		1: {
+			mailData:  rfc5322exampleA4,
+			preserved: []string{rfc5322exampleA4},
+		},
+		2: {
+			mailData:  multipartSignedExample,
+			preserved: []string{multipartSignedExample},
+		},
+		3: {
+			mailData: multipartSignedExample,
+			modify: func(e *Email) {
+				e.Subject = "Changed"
+			},
+			preserved: []string{multipartSignedExample[strings.Index(multipartSignedExample, "\n\n")+2:]},
+			changed:   []string{"Subject: Changed\r\n"},
+		},
+		4: {
+			mailData: data1,
+			modify: func(e *Email) {
+				e.HTMLBody = "<p>changed</p>"
+			},
+			preserved: []string{"Content-Type: application/json;\n\tname=\"=?UTF-8?Q?Peter_Paholi=CC=81k_1?=\n\t=?UTF-8?Q?_4_2017_2017=2D04=2D07=2Ejson?=\""},
+			changed:   []string{"<p>changed</p>"},
+		},
+		5: {
+			mailData: multipartSignedExample,
+			modify: func(e *Email) {
+				e.Attachments = nil
+			},
+			preserved: []string{"Content-Type: multipart/alternative; \n\tboundary=\"----=_Part_35927_1100954179.1698130587742\"\n\n------=_Part_35927_1100954179.1698130587742\n"},
+			changed:   []string{"X-SES-Outgoing: 2023.10.24-23.251.234.52\r\nContent-Type: multipart/alternative;"},
+		},
+		6: {
+			mailData:  mixedTextAttachmentTextExample,
+			preserved: []string{mixedTextAttachmentTextExample},
+		},
+		7: {
+			mailData: mixedTextAndHTMLExample,
+			modify: func(e *Email) {
+				e.Subject = "Changed"
+			},
+			preserved: []string{"content-type: text/plain; charset=us-ascii\n\nhello", "content-type: text/html\n\n<p>hello</p>"},
+			changed:   []string{"Content-Type: multipart/alternative;"},
+		},
+	}
+
+	for index, td := range testData {
+		e, err := Parse(strings.NewReader(td.mailData))
+		if err != nil {
+			t.Error(err)
+			continue
+		}
+
+		if td.modify != nil {
+			td.modify(&e)
+		}
+
+		buf := new(bytes.Buffer)
+		if _, err := e.WriteTo(buf); err != nil {
+			t.Errorf("[Test Case %v] %v", index, err)
+			continue
+		}
+
+		for _, p := range td.preserved {
+			if !strings.Contains(buf.String(), p) {
+				t.Errorf("[Test Case %v] Source not preserved. Expected to contain: %q, Got: %q", index, p, buf.String())
+			}
+		}
+
+		for _, c := range td.changed {
+			if !strings.Contains(buf.String(), c) {
+				t.Errorf("[Test Case %v] Change not written. Expected to contain: %q, Got: %q", index, c, buf.String())
+			}
+		}
+
+		if _, err := Parse(bytes.NewReader(buf.Bytes())); err != nil {
+			t.Errorf("[Test Case %v] Can't parse written email: %v", index, err)
+		}
+	}
+}
+
+func TestSplitMultipartBody(t *testing.T) {
+	raw := []byte("preamble\r\n--b\r\nA: 1\r\n\r\nfirst\r\n--b  \r\n\r\nsecond\r\n--b--\r\nepilogue")
+	spans := splitMultipartBody(raw, 0, len(raw), "b")
+
+	expected := []string{"A: 1\r\n\r\nfirst", "\r\nsecond"}
+	if len(spans) != len(expected) {
+		t.Fatalf("Wrong number of parts. Expected: %v, Got: %v", len(expected), len(spans))
+	}
+
+	for i, span := range spans {
+		if string(raw[span[0]:span[1]]) != expected[i] {
+			t.Errorf("Wrong part %v. Expected: %q, Got: %q", i, expected[i], raw[span[0]:span[1]])
+		}
+	}
+}
+
+var mixedTextAttachmentTextExample = `From: a@example.com
+To: b@example.com
+Subject: Text around an attachment
+MIME-Version: 1.0
+Content-Type: multipart/mixed; boundary="b1"
+
+--b1
+Content-Type: text/plain
+
+hello
+--b1
+Content-Type: application/octet-stream
+Content-Disposition: attachment; filename="a.bin"
+Content-Transfer-Encoding: base64
+
+AAEC
+--b1
+Content-Type: text/plain
+
+footer
+--b1--
+`
+
+var mixedTextAndHTMLExample = `From: a@example.com
+To: b@example.com
+Subject: Text and HTML in mixed
+MIME-Version: 1.0
+Content-Type: multipart/mixed; boundary="b1"
+
+--b1
+content-type: text/plain; charset=us-ascii
+
+hello
+--b1
+content-type: text/html
+
+<p>hello</p>
+--b1--
+`
+
+func TestWriteToDoesNotReadCopiedParts(t *testing.T) {
+	e, err := Parse(strings.NewReader(mixedTextAttachmentExample))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	data := e.Attachments[0].Data
+	e.Subject = "Changed"
+
+	for i := 0; i < 2; i++ {
+		buf := new(bytes.Buffer)
+		if _, err := e.WriteTo(buf); err != nil {
+			t.Fatal(err)
+		}
+		if !strings.Contains(buf.String(), "Content-Disposition: attachment; filename=\"a.bin\"\nContent-Transfer-Encoding: base64\n\nAAEC") {
+			t.Errorf("Attachment not copied over from the source: %q", buf.String())
+		}
+	}
+
+	if e.Attachments[0].Data != data {
+		t.Errorf("Attachment reader replaced")
+	}
+	if b, _ := ioutil.ReadAll(data); string(b) != "\x00\x01\x02" {
+		t.Errorf("Attachment reader consumed, remaining: %q", b)
+	}
+}
+
+var mixedTextAttachmentExample = `From: a@example.com
+To: b@example.com
+Subject: Text and an attachment
+MIME-Version: 1.0
+Content-Type: multipart/mixed; boundary="b1"
+
+--b1
+Content-Type: text/plain
+
+hello
+--b1
+Content-Type: application/octet-stream
+Content-Disposition: attachment; filename="a.bin"
+Content-Transfer-Encoding: base64
+
+AAEC
+--b1--
+`
@@ -0,0 +1,152 @@
+package parsemail
+
+import (
+	"html"
+	"regexp"
+	"strings"
+)
+
+// HTML rendering of plain text bodies for display
+
+var textLinkPattern = regexp.MustCompile(`(?i)\b(?:(?:https?|ftp)://|www\.)[^\s<>"]+|\bmailto:[^\s<>"]+|[a-z0-9._%+\-]+@[a-z0-9\-]+(?:\.[a-z0-9\-]+)*\.[a-z]{2,}`)
+
+const textQuoteStart = `<blockquote type="cite">`
+const textQuoteEnd = "</blockquote>"
+
+// TextToHTML renders plain text as HTML: the text is escaped, URLs and email addresses become links, line breaks
+// are kept and lines quoted with '>' are placed in nested blockquotes
+func TextToHTML(text string) string {
+	var paragraphs []FlowedParagraph
+	for _, line := range strings.Split(strings.Replace(text, "\r\n", "\n", -1), "\n") {
+		depth, rest := textQuoteDepth(line)
+		paragraphs = append(paragraphs, FlowedParagraph{QuoteDepth: depth, Text: rest})
+	}
+
+	return paragraphsToHTML(paragraphs)
+}
+
+// FlowedTextToHTML renders format=flowed text as HTML like TextToHTML, with every paragraph on a single line
+// and the quote depth taken from the flowed quote marks
+func FlowedTextToHTML(text string, delSp bool) string {
+	return paragraphsToHTML(ParseFlowed(text, delSp))
+}
+
+// TextBodyToHTML renders the text bodies of email as HTML, format=flowed bodies are rendered with FlowedTextToHTML
+func TextBodyToHTML(email Email) (string, error) {
+	if len(email.TextBodies) == 0 {
+		return TextToHTML(email.TextBody), nil
+	}
+
+	var parts []string
+	for _, tb := range email.TextBodies {
+		data, err := readAndReset(&tb.Data)
+		if err != nil {
+			return "", err
+		}
+
+		text := strings.TrimSuffix(strings.Replace(string(data), "\r\n", "\n", -1), "\n")
+		if isFlowed(tb.Params) {
+			parts = append(parts, FlowedTextToHTML(text, strings.EqualFold(tb.Params["delsp"], "yes")))
+		} else {
+			parts = append(parts, TextToHTML(text))
+		}
+	}
+
+	return strings.Join(parts, "\n"), nil
+}
+
+// textQuoteDepth counts the quote marks of a plain text line, which may be separated by spaces as in "> > text"
+func textQuoteDepth(line string) (int, string) {
+	depth := 0
+	rest := line
+	for {
+		trimmed := strings.TrimLeft(rest, " ")
+		if !strings.HasPrefix(trimmed, ">") || (depth == 0 && trimmed != rest) {
+			break
+		}
+		depth++
+		rest = trimmed[1:]
+	}
+	if depth > 0 {
+		rest = strings.TrimPrefix(rest, " ")
+	}
+
+	return depth, rest
+}
+
+func paragraphsToHTML(paragraphs []FlowedParagraph) string {
+	var out strings.Builder
+	out.WriteString("<div>")
+
+	depth := 0
+	first := true
+	for _, p := range paragraphs {
+		if p.QuoteDepth != depth {
+			for ; depth < p.QuoteDepth; depth++ {
+				out.WriteString(textQuoteStart)
+			}
+			for ; depth > p.QuoteDepth; depth-- {
+				out.WriteString(textQuoteEnd)
+			}
+			out.WriteString("\n")
+		} else if !first {
+			out.WriteString("<br>\n")
+		}
+		first = false
+
+		out.WriteString(linkifyText(p.Text))
+	}
+	for ; depth > 0; depth-- {
+		out.WriteString(textQuoteEnd)
+	}
+
+	out.WriteString("</div>")
+
+	return out.String()
+}
+
+// linkifyText escapes text, turning URLs and email addresses into links
+func linkifyText(text string) string {
+	var out strings.Builder
+	last := 0
+	for _, m := range textLinkPattern.FindAllStringIndex(text, -1) {
+		start, end := m[0], trimLinkEnd(text, m[0], m[1])
+
+		link := text[start:end]
+		href := link
+		lower := strings.ToLower(link)
+		switch {
+		case strings.HasPrefix(lower, "www."):
+			href = "http://" + link
+		case !strings.Contains(lower, ":") && strings.Contains(link, "@"):
+			href = "mailto:" + link
+		}
+
+		out.WriteString(html.EscapeString(text[last:start]))
+		out.WriteString(`<a href="` + html.EscapeString(href) + `">` + html.EscapeString(link) + "</a>")
+		last = end
+	}
+	out.WriteString(html.EscapeString(text[last:]))
+
+	return out.String()
+}
+
+// trimLinkEnd excludes the punctuation following a link in a sentence, keeping the closing parentheses
+// which belong to the link
+func trimLinkEnd(text string, start, end int) int {
+	for end > start {
+		switch c := text[end-1]; c {
+		case '.', ',', ';', ':', '!', '?', '\'', '"':
+			end--
+			continue
+		case ')':
+			if strings.Count(text[start:end], "(") < strings.Count(text[start:end], ")") {
+				end--
+				continue
+			}
+		}
+		break
+	}
+
+	return end
+}
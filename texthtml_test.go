@@ -0,0 +1,82 @@
+package parsemail
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestTextToHTML(t *testing.T) {
+	var testData = map[int]struct {
+		text string
+		html string
+	}{
+		1: {
+			text: "Hello <World> & friends,\r\nsee https://example.com/a?b=1&c=2.",
+			html: `<div>Hello &lt;World&gt; &amp; friends,<br>` + "\n" +
+				`see <a href="https://example.com/a?b=1&amp;c=2">https://example.com/a?b=1&amp;c=2</a>.</div>`,
+		},
+		2: {
+			text: "Mail info@example.com or visit www.example.com (https://en.wikipedia.org/wiki/Go_(programming_language)).",
+			html: `<div>Mail <a href="mailto:info@example.com">info@example.com</a> or visit ` +
+				`<a href="http://www.example.com">www.example.com</a> ` +
+				`(<a href="https://en.wikipedia.org/wiki/Go_(programming_language)">https://en.wikipedia.org/wiki/Go_(programming_language)</a>).</div>`,
+		},
+		3: {
+			text: "Reply\n> Quoted\n> > Deeper\n>> Also deeper\n> Back\n\nEnd",
+			html: "<div>Reply" + `<blockquote type="cite">` + "\nQuoted" + `<blockquote type="cite">` + "\nDeeper<br>\nAlso deeper" +
+				"</blockquote>\nBack</blockquote>\n<br>\nEnd</div>",
+		},
+		4: {
+			text: "  indented > not a quote",
+			html: "<div>  indented &gt; not a quote</div>",
+		},
+	}
+
+	for index, td := range testData {
+		html := TextToHTML(td.text)
+		if html != td.html {
+			t.Errorf("[Test Case %v] Wrong html.\nExpected: %q\nGot:      %q", index, td.html, html)
+		}
+	}
+}
+
+func TestFlowedTextToHTML(t *testing.T) {
+	text := "A paragraph \r\nwrapped.\r\n> Quoted \r\n> paragraph\r\n>> Deeper\r\n"
+	expected := "<div>A paragraph wrapped." + `<blockquote type="cite">` + "\nQuoted paragraph" + `<blockquote type="cite">` +
+		"\nDeeper</blockquote></blockquote></div>"
+
+	if html := FlowedTextToHTML(text, false); html != expected {
+		t.Errorf("Wrong html.\nExpected: %q\nGot:      %q", expected, html)
+	}
+}
+
+func TestTextBodyToHTML(t *testing.T) {
+	mailData := "From: a@example.com\r\n" +
+		"To: b@example.com\r\n" +
+		"Subject: Flowed\r\n" +
+		"MIME-Version: 1.0\r\n" +
+		"Content-Type: text/plain; charset=utf-8; format=flowed\r\n" +
+		"Content-Transfer-Encoding: quoted-printable\r\n" +
+		"\r\n" +
+		"Caf=C3=A9 at =\r\n" +
+		"https://example.com=20\r\n" +
+		"tomorrow?\r\n" +
+		"> Sure=20\r\n" +
+		"> thing\r\n"
+
+	e, err := Parse(strings.NewReader(mailData))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	html, err := TextBodyToHTML(e)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expected := `<div>Café at <a href="https://example.com">https://example.com</a> tomorrow?` +
+		`<blockquote type="cite">` + "\nSure thing</blockquote></div>"
+	if html != expected {
+		t.Errorf("Wrong html.\nExpected: %q\nGot:      %q", expected, html)
+	}
+}
@@ -0,0 +1,313 @@
+// Package threading groups parsed emails into conversation trees using the JWZ threading algorithm
+// (https://www.jwz.org/doc/threading.html).
+package threading
+
+import (
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/DusanKasan/parsemail"
+)
+
+var subjectPrefix = regexp.MustCompile(`(?i)^\s*(re|fwd?)\s*(\[\d+\])?\s*:\s*`)
+
+// Container is a node of a conversation tree. Email is nil for messages that are referenced by
+// other messages but were not part of the input, or for containers grouping messages by subject.
+type Container struct {
+	MessageID string
+	Email     *parsemail.Email
+	Parent    *Container
+	Children  []*Container
+}
+
+// Thread builds conversation trees out of emails and returns their roots.
+//
+// Messages are linked through their References and In-Reply-To headers, missing parents are kept as
+// empty containers where they join several messages, and roots that still share a subject are grouped
+// together. Roots and children are ordered by date.
+func Thread(emails []*parsemail.Email) []*Container {
+	containers := map[string]*Container{}
+
+	get := func(id string) *Container {
+		c, ok := containers[id]
+		if !ok {
+			c = &Container{MessageID: id}
+			containers[id] = c
+		}
+		return c
+	}
+
+	var order []*Container
+	for i, email := range emails {
+		id := email.MessageID
+		if c, ok := containers[id]; id == "" || (ok && c.Email != nil) {
+			// missing or duplicate message id, thread the message on its own identity
+			id = fmt.Sprintf("<parsemail-threading-%d>", i)
+		}
+
+		c := get(id)
+		c.Email = email
+		order = append(order, c)
+
+		var parent *Container
+		for _, ref := range references(email) {
+			rc := get(ref)
+			if parent != nil && rc.Parent == nil && !rc.reaches(parent) {
+				parent.adopt(rc)
+			}
+			parent = rc
+		}
+
+		if parent != nil && c.reaches(parent) {
+			parent = nil
+		}
+		if c.Parent != nil {
+			c.Parent.remove(c)
+		}
+		if parent != nil {
+			parent.adopt(c)
+		}
+	}
+
+	var tops []*Container
+	seen := map[*Container]bool{}
+	for _, c := range order {
+		top := c
+		for top.Parent != nil {
+			top = top.Parent
+		}
+		if !seen[top] {
+			seen[top] = true
+			tops = append(tops, top)
+		}
+	}
+
+	root := &Container{}
+	for _, top := range tops {
+		root.adopt(top)
+	}
+
+	root.prune(true)
+	root.groupBySubject()
+	root.sortByDate()
+
+	for _, c := range root.Children {
+		c.Parent = nil
+	}
+
+	return root.Children
+}
+
+// Walk calls fn for c and all of its descendants in depth first order
+func (c *Container) Walk(fn func(c *Container, depth int)) {
+	c.walk(fn, 0)
+}
+
+func (c *Container) walk(fn func(c *Container, depth int), depth int) {
+	fn(c, depth)
+	for _, child := range c.Children {
+		child.walk(fn, depth+1)
+	}
+}
+
+// Emails returns all the emails in the tree rooted at c in depth first order
+func (c *Container) Emails() (emails []*parsemail.Email) {
+	c.Walk(func(c *Container, depth int) {
+		if c.Email != nil {
+			emails = append(emails, c.Email)
+		}
+	})
+
+	return
+}
+
+// references returns the ids of the ancestors of email, the direct parent being the last one
+func references(email *parsemail.Email) []string {
+	if len(email.References) > 0 {
+		return email.References
+	}
+
+	if len(email.InReplyTo) > 0 {
+		return email.InReplyTo[:1]
+	}
+
+	return nil
+}
+
+// reaches reports whether other is c or one of its descendants
+func (c *Container) reaches(other *Container) bool {
+	if c == other {
+		return true
+	}
+
+	for _, child := range c.Children {
+		if child.reaches(other) {
+			return true
+		}
+	}
+
+	return false
+}
+
+func (c *Container) adopt(child *Container) {
+	child.Parent = c
+	c.Children = append(c.Children, child)
+}
+
+func (c *Container) remove(child *Container) {
+	for i, cc := range c.Children {
+		if cc == child {
+			c.Children = append(c.Children[:i], c.Children[i+1:]...)
+			break
+		}
+	}
+	child.Parent = nil
+}
+
+// prune removes empty containers without children and promotes the children of other empty containers,
+// except for empty roots holding several children which keep them grouped
+func (c *Container) prune(root bool) {
+	var children []*Container
+	for _, child := range c.Children {
+		child.prune(false)
+
+		if child.Email != nil {
+			children = append(children, child)
+			continue
+		}
+
+		if len(child.Children) == 0 {
+			continue
+		}
+
+		if root && len(child.Children) > 1 {
+			children = append(children, child)
+			continue
+		}
+
+		for _, grandchild := range child.Children {
+			grandchild.Parent = c
+			children = append(children, grandchild)
+		}
+	}
+
+	c.Children = children
+}
+
+// groupBySubject merges the children of c that share a base subject
+func (c *Container) groupBySubject() {
+	subjects := map[string]*Container{}
+
+	for _, child := range c.Children {
+		subject, _ := child.subject()
+		if subject == "" {
+			continue
+		}
+
+		old, ok := subjects[subject]
+		if !ok || (child.Email == nil && old.Email != nil) || (old.isReply() && !child.isReply() && child.Email != nil) {
+			subjects[subject] = child
+		}
+	}
+
+	var children []*Container
+	for _, child := range c.Children {
+		if child.Parent != c {
+			// already merged into another container
+			continue
+		}
+
+		subject, _ := child.subject()
+		target, ok := subjects[subject]
+		if subject == "" || !ok || target == child {
+			children = append(children, child)
+			continue
+		}
+
+		switch {
+		case target.Email == nil && child.Email == nil:
+			for _, grandchild := range child.Children {
+				target.adopt(grandchild)
+			}
+		case target.Email == nil:
+			target.adopt(child)
+		case !target.isReply() && child.isReply():
+			target.adopt(child)
+		default:
+			group := &Container{Parent: c}
+			group.adopt(target)
+			group.adopt(child)
+			subjects[subject] = group
+			children = replace(children, target, group)
+		}
+	}
+
+	c.Children = children
+}
+
+func replace(containers []*Container, old, new *Container) []*Container {
+	for i, c := range containers {
+		if c == old {
+			containers[i] = new
+			return containers
+		}
+	}
+
+	return append(containers, new)
+}
+
+// subject returns the base subject of the container (or of its first child if empty) and whether it was a reply
+func (c *Container) subject() (string, bool) {
+	if c.Email != nil {
+		return baseSubject(c.Email.Subject)
+	}
+
+	if len(c.Children) > 0 && c.Children[0].Email != nil {
+		return baseSubject(c.Children[0].Email.Subject)
+	}
+
+	return "", false
+}
+
+func (c *Container) isReply() bool {
+	_, reply := c.subject()
+	return reply
+}
+
+// baseSubject strips reply and forward prefixes from subject
+func baseSubject(subject string) (string, bool) {
+	stripped := false
+	for subjectPrefix.MatchString(subject) {
+		subject = subjectPrefix.ReplaceAllString(subject, "")
+		stripped = true
+	}
+
+	return strings.ToLower(strings.TrimSpace(subject)), stripped
+}
+
+func (c *Container) sortByDate() {
+	for _, child := range c.Children {
+		child.sortByDate()
+	}
+
+	sort.SliceStable(c.Children, func(i, j int) bool {
+		return c.Children[i].date().Before(c.Children[j].date())
+	})
+}
+
+func (c *Container) date() (t time.Time) {
+	if c.Email != nil {
+		return c.Email.Date
+	}
+
+	for _, child := range c.Children {
+		if d := child.date(); !d.IsZero() && (t.IsZero() || d.Before(t)) {
+			t = d
+		}
+	}
+
+	return
+}
@@ -0,0 +1,117 @@
+package threading
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/DusanKasan/parsemail"
+)
+
+func newEmail(id, subject string, day int, references ...string) *parsemail.Email {
+	return &parsemail.Email{
+		MessageID:  id,
+		Subject:    subject,
+		Date:       time.Date(2020, 1, day, 0, 0, 0, 0, time.UTC),
+		References: references,
+	}
+}
+
+// render prints the trees as indented message ids (or subjects for messages without one),
+// empty containers are shown as "-"
+func render(roots []*Container) string {
+	var lines []string
+	for _, r := range roots {
+		r.Walk(func(c *Container, depth int) {
+			id := "-"
+			if c.Email != nil {
+				id = c.Email.MessageID
+				if id == "" {
+					id = c.Email.Subject
+				}
+			}
+			lines = append(lines, strings.Repeat("  ", depth)+id)
+		})
+	}
+
+	return strings.Join(lines, "\n")
+}
+
+func TestThread(t *testing.T) {
+	var testData = map[int]struct {
+		emails   []*parsemail.Email
+		expected string
+	}{
+		1: {
+			emails: []*parsemail.Email{
+				newEmail("c", "Re: Hello", 3, "a", "b"),
+				newEmail("a", "Hello", 1),
+				newEmail("b", "Re: Hello", 2, "a"),
+				newEmail("x", "Other", 4),
+			},
+			expected: "a\n  b\n    c\nx",
+		},
+		2: {
+			// missing parent with a single child is dropped
+			emails: []*parsemail.Email{
+				newEmail("b", "Re: Lost", 2, "a"),
+			},
+			expected: "b",
+		},
+		3: {
+			// missing parent joining two replies is kept
+			emails: []*parsemail.Email{
+				newEmail("b", "Re: Lost", 2, "a"),
+				newEmail("c", "Re: Lost", 3, "a"),
+			},
+			expected: "-\n  b\n  c",
+		},
+		4: {
+			// grouping by subject without references
+			emails: []*parsemail.Email{
+				newEmail("b", "Re: Meeting", 2),
+				newEmail("a", "Meeting", 1),
+				newEmail("c", "Fwd: Meeting", 3),
+			},
+			expected: "a\n  b\n  c",
+		},
+		5: {
+			// two messages with the same subject that aren't replies are grouped under an empty container
+			emails: []*parsemail.Email{
+				newEmail("a", "Daily report", 1),
+				newEmail("b", "Daily report", 2),
+			},
+			expected: "-\n  a\n  b",
+		},
+		6: {
+			// the reference closing a loop is ignored
+			emails: []*parsemail.Email{
+				newEmail("a", "Loop", 1, "b"),
+				newEmail("b", "Re: Loop", 2, "a"),
+			},
+			expected: "b\n  a",
+		},
+		7: {
+			// duplicate and missing message ids
+			emails: []*parsemail.Email{
+				newEmail("a", "First", 1),
+				newEmail("a", "Second", 2),
+				newEmail("", "Third", 3),
+			},
+			expected: "a\na\nThird",
+		},
+	}
+
+	for index, td := range testData {
+		roots := Thread(td.emails)
+		if got := render(roots); got != td.expected {
+			t.Errorf("[Test Case %v] Wrong threads. Expected:\n%s\nGot:\n%s", index, td.expected, got)
+		}
+
+		for _, r := range roots {
+			if r.Parent != nil {
+				t.Errorf("[Test Case %v] Root has a parent", index)
+			}
+		}
+	}
+}
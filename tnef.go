@@ -0,0 +1,348 @@
+package parsemail
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"io/ioutil"
+	"strings"
+)
+
+// Transport Neutral Encapsulation Format (MS-OXTNEF), sent by Exchange as winmail.dat attachments
+
+const (
+	tnefSignature     = 0x223E9F78
+	tnefLevelMessage  = 1
+	tnefLevelAttach   = 2
+	tnefHeaderSize    = 6
+	tnefAttrSize      = 9
+	tnefChecksumSize  = 2
+	tnefMaxNesting    = 8
+	tnefMimeType      = "application/ms-tnef"
+	tnefFilename      = "winmail.dat"
+	tnefGUIDSize      = 16
+	tnefNamedPropKind = 0x8000
+)
+
+// TNEF attribute ids, including their type in the high word
+const (
+	tnefAttSubject     = 0x00018004
+	tnefAttBody        = 0x0002800C
+	tnefAttAttachData  = 0x0006800F
+	tnefAttAttachTitle = 0x00018010
+	tnefAttAttachRend  = 0x00069002
+	tnefAttMsgProps    = 0x00069003
+	tnefAttAttachment  = 0x00069005
+)
+
+// tnefMessage is the content of a TNEF stream
+type tnefMessage struct {
+	subject     string
+	body        string
+	props       mapiProperties
+	attachments []*tnefAttachment
+}
+
+type tnefAttachment struct {
+	title string
+	data  []byte
+	props mapiProperties
+}
+
+func isTNEF(a Attachment) bool {
+	return strings.EqualFold(a.ContentType, tnefMimeType) || strings.EqualFold(a.Filename, tnefFilename)
+}
+
+// decodeTNEFAttachments replaces the winmail.dat attachments of email with the attachments they contain
+// and fills the bodies and MAPI properties missing from email
+func decodeTNEFAttachments(email *Email) error {
+	var attachments []Attachment
+
+	for _, a := range email.Attachments {
+		if !isTNEF(a) {
+			attachments = append(attachments, a)
+			continue
+		}
+
+		data, err := ioutil.ReadAll(a.Data)
+		if err != nil {
+			return err
+		}
+
+		msg, err := decodeTNEF(data)
+		if err != nil {
+			// keep attachments which aren't valid TNEF untouched
+			a.Data = bytes.NewReader(data)
+			attachments = append(attachments, a)
+			continue
+		}
+
+		if err := msg.apply(email, &attachments, 0); err != nil {
+			return err
+		}
+	}
+
+	email.Attachments = attachments
+
+	return nil
+}
+
+// apply copies the bodies and properties of the TNEF message into email and appends its attachments
+func (msg *tnefMessage) apply(email *Email, attachments *[]Attachment, depth int) error {
+	if email.MAPIProperties == nil {
+		email.MAPIProperties = map[uint16]MAPIProperty{}
+	}
+	for id, p := range msg.props {
+		email.MAPIProperties[id] = p
+	}
+
+	if email.TextBody == "" {
+		email.TextBody = msg.props.string(mapiBody)
+		if email.TextBody == "" {
+			email.TextBody = msg.body
+		}
+	}
+	if email.HTMLBody == "" {
+		email.HTMLBody = msg.props.string(mapiHTML)
+	}
+	if compressed := msg.props.bytes(mapiRTFCompressed); len(compressed) > 0 && email.RTFBody == "" {
+		if rtf, err := DecompressRTF(compressed); err == nil {
+			email.RTFBody = string(rtf)
+		}
+	}
+	setRTFBodies(email)
+
+	for _, ta := range msg.attachments {
+		filename := ta.props.string(mapiAttachLongFilename, mapiAttachFilename, mapiDisplayName)
+		if filename == "" {
+			filename = ta.title
+		}
+		contentType := ta.props.string(mapiAttachMimeTag)
+		data := ta.data
+
+		if ta.props.int(mapiAttachMethod) == mapiAttachMethodEmbeddedMsg {
+			if depth >= tnefMaxNesting {
+				continue
+			}
+
+			// embedded messages are TNEF streams prefixed with the IID of the object
+			obj := ta.props.bytes(mapiAttachDataBin)
+			if len(obj) < tnefGUIDSize {
+				continue
+			}
+			embedded, err := decodeTNEF(obj[tnefGUIDSize:])
+			if err != nil {
+				continue
+			}
+
+			inner := Email{}
+			setMAPIHeaderFields(&inner, embedded.props)
+			if inner.Subject == "" {
+				inner.Subject = embedded.subject
+			}
+			var innerAttachments []Attachment
+			if err := embedded.apply(&inner, &innerAttachments, depth+1); err != nil {
+				return err
+			}
+			inner.Attachments = innerAttachments
+
+			buf := new(bytes.Buffer)
+			if _, err := inner.WriteTo(buf); err != nil {
+				return err
+			}
+
+			if filename == "" {
+				filename = inner.Subject
+			}
+			if !strings.HasSuffix(strings.ToLower(filename), ".eml") {
+				filename += ".eml"
+			}
+			contentType, data = contentTypeMessageRFC822, buf.Bytes()
+		}
+
+		if contentType == "" {
+			contentType = contentTypeApplicationOctetStream
+		}
+
+		if cid := strings.Trim(ta.props.string(mapiAttachContentID), "<>"); cid != "" && strings.Contains(email.HTMLBody, "cid:"+cid) {
+			email.EmbeddedFiles = append(email.EmbeddedFiles, EmbeddedFile{
+				CID:         cid,
+				ContentType: contentType,
+				Data:        bytes.NewReader(data),
+			})
+			continue
+		}
+
+		*attachments = append(*attachments, Attachment{
+			Filename:    filename,
+			ContentType: contentType,
+			Data:        bytes.NewReader(data),
+		})
+	}
+
+	return nil
+}
+
+// decodeTNEF reads the attributes of a TNEF stream
+func decodeTNEF(data []byte) (*tnefMessage, error) {
+	if len(data) < tnefHeaderSize || binary.LittleEndian.Uint32(data) != tnefSignature {
+		return nil, fmt.Errorf("not a tnef stream")
+	}
+
+	msg := &tnefMessage{props: mapiProperties{}}
+	var attachment *tnefAttachment
+
+	for pos := tnefHeaderSize; pos < len(data); {
+		if pos+tnefAttrSize > len(data) {
+			return nil, fmt.Errorf("tnef attribute truncated")
+		}
+
+		level := data[pos]
+		id := binary.LittleEndian.Uint32(data[pos+1:])
+		size := int(binary.LittleEndian.Uint32(data[pos+5:]))
+		start := pos + tnefAttrSize
+		if size < 0 || start+size+tnefChecksumSize > len(data) {
+			return nil, fmt.Errorf("tnef attribute truncated")
+		}
+		value := data[start : start+size]
+		pos = start + size + tnefChecksumSize
+
+		if level == tnefLevelAttach && id == tnefAttAttachRend {
+			attachment = &tnefAttachment{props: mapiProperties{}}
+			msg.attachments = append(msg.attachments, attachment)
+			continue
+		}
+
+		if level == tnefLevelMessage {
+			switch id {
+			case tnefAttSubject:
+				msg.subject = decodeString8(value)
+			case tnefAttBody:
+				msg.body = decodeString8(value)
+			case tnefAttMsgProps:
+				if err := readTNEFProperties(value, msg.props); err != nil {
+					return nil, err
+				}
+			}
+			continue
+		}
+
+		if attachment == nil {
+			continue
+		}
+
+		switch id {
+		case tnefAttAttachTitle:
+			attachment.title = decodeString8(value)
+		case tnefAttAttachData:
+			attachment.data = value
+		case tnefAttAttachment:
+			if err := readTNEFProperties(value, attachment.props); err != nil {
+				return nil, err
+			}
+			if data := attachment.props.bytes(mapiAttachDataBin); data != nil && attachment.data == nil &&
+				attachment.props[mapiAttachDataBin].Type == MAPITypeBinary {
+				attachment.data = data
+			}
+		}
+	}
+
+	return msg, nil
+}
+
+// readTNEFProperties decodes an encoded MAPI property list into props, multi-valued
+// and named properties are skipped
+func readTNEFProperties(b []byte, props mapiProperties) error {
+	r := &tnefReader{b: b}
+
+	count := r.uint32()
+	for i := uint32(0); i < count && r.err == nil; i++ {
+		tag := r.uint32()
+		typ, id := uint16(tag), uint16(tag>>16)
+
+		if id >= tnefNamedPropKind {
+			r.skip(tnefGUIDSize)
+			if r.uint32() == 0 {
+				r.skip(4)
+			} else {
+				r.skip(int(r.uint32()))
+				r.align()
+			}
+		}
+
+		values := uint32(1)
+		if typ&mapiMultiValuedFlag != 0 {
+			values = r.uint32()
+		}
+
+		for v := uint32(0); v < values && r.err == nil; v++ {
+			var value []byte
+
+			switch typ &^ mapiMultiValuedFlag {
+			case MAPITypeInt16, MAPITypeInt32, MAPITypeBoolean, mapiTypeFloat, mapiTypeError:
+				value = r.bytes(4)
+			case MAPITypeInt64, MAPITypeSysTime, mapiTypeDouble, mapiTypeCurrency, mapiTypeAppTime:
+				value = r.bytes(8)
+			case mapiTypeCLSID:
+				value = r.bytes(16)
+			case MAPITypeString8, MAPITypeUnicode, MAPITypeBinary, MAPITypeObject:
+				if typ&mapiMultiValuedFlag == 0 {
+					// single variable size values are still prefixed with a value count
+					r.uint32()
+				}
+				value = r.bytes(int(r.uint32()))
+				r.align()
+			default:
+				return fmt.Errorf("unknown tnef property type: %x", typ)
+			}
+
+			if typ&mapiMultiValuedFlag == 0 && id < tnefNamedPropKind {
+				props[id] = MAPIProperty{ID: id, Type: typ, Value: value}
+			}
+		}
+	}
+
+	return r.err
+}
+
+// tnefReader reads little endian values, remembering the first error
+type tnefReader struct {
+	b   []byte
+	pos int
+	err error
+}
+
+func (r *tnefReader) bytes(n int) []byte {
+	if r.err != nil {
+		return nil
+	}
+	if n < 0 || r.pos+n > len(r.b) {
+		r.err = fmt.Errorf("tnef property list truncated")
+		return nil
+	}
+
+	b := r.b[r.pos : r.pos+n]
+	r.pos += n
+
+	return b
+}
+
+func (r *tnefReader) uint32() uint32 {
+	b := r.bytes(4)
+	if b == nil {
+		return 0
+	}
+
+	return binary.LittleEndian.Uint32(b)
+}
+
+func (r *tnefReader) skip(n int) {
+	r.bytes(n)
+}
+
+// align skips the padding of variable size values to a multiple of 4 bytes
+func (r *tnefReader) align() {
+	if rem := r.pos % 4; rem != 0 {
+		r.skip(4 - rem)
+	}
+}
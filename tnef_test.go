@@ -0,0 +1,167 @@
+package parsemail
+
+import (
+	"bytes"
+	"encoding/binary"
+	"io/ioutil"
+	"testing"
+	"unicode/utf16"
+)
+
+func tnefAttribute(level byte, id uint32, value []byte) []byte {
+	b := []byte{level, 0, 0, 0, 0, 0, 0, 0, 0}
+	binary.LittleEndian.PutUint32(b[1:], id)
+	binary.LittleEndian.PutUint32(b[5:], uint32(len(value)))
+
+	var checksum uint16
+	for _, c := range value {
+		checksum += uint16(c)
+	}
+
+	return append(append(b, value...), byte(checksum), byte(checksum>>8))
+}
+
+func tnefStream(attributes ...[]byte) []byte {
+	b := []byte{0, 0, 0, 0, 0x01, 0x00}
+	binary.LittleEndian.PutUint32(b, tnefSignature)
+
+	return append(b, bytes.Join(attributes, nil)...)
+}
+
+// tnefPropertyList encodes props, string values are given as Go strings and encoded as UTF-16
+func tnefPropertyList(props ...MAPIProperty) []byte {
+	b := make([]byte, 4)
+	binary.LittleEndian.PutUint32(b, uint32(len(props)))
+
+	put := func(v uint32) {
+		b = append(b, byte(v), byte(v>>8), byte(v>>16), byte(v>>24))
+	}
+
+	for _, p := range props {
+		put(uint32(p.ID)<<16 | uint32(p.Type))
+
+		switch p.Type {
+		case MAPITypeInt32:
+			b = append(b, p.Value[:4]...)
+		case MAPITypeUnicode, MAPITypeBinary, MAPITypeObject:
+			value := p.Value
+			if p.Type == MAPITypeUnicode {
+				value = nil
+				for _, u := range utf16.Encode([]rune(string(p.Value) + "\x00")) {
+					value = append(value, byte(u), byte(u>>8))
+				}
+			}
+			put(1)
+			put(uint32(len(value)))
+			b = append(b, value...)
+			for len(b)%4 != 0 {
+				b = append(b, 0)
+			}
+		}
+	}
+
+	return b
+}
+
+func TestParseWithOptionsTNEF(t *testing.T) {
+	embedded := tnefStream(
+		tnefAttribute(tnefLevelMessage, tnefAttMsgProps, tnefPropertyList(
+			MAPIProperty{ID: mapiSubject, Type: MAPITypeUnicode, Value: []byte("Forwarded meeting notes")},
+			MAPIProperty{ID: mapiSenderName, Type: MAPITypeUnicode, Value: []byte("Dave")},
+			MAPIProperty{ID: mapiSenderSMTPAddress, Type: MAPITypeUnicode, Value: []byte("dave@example.com")},
+			MAPIProperty{ID: mapiBody, Type: MAPITypeUnicode, Value: []byte("Notes")},
+		)),
+	)
+
+	winmail := tnefStream(
+		tnefAttribute(tnefLevelMessage, tnefAttSubject, []byte("Quarterly report\x00")),
+		tnefAttribute(tnefLevelMessage, tnefAttMsgProps, tnefPropertyList(
+			MAPIProperty{ID: mapiHTML, Type: MAPITypeBinary, Value: []byte(`<p>See the <b>report</b></p><img src="cid:chart">`)},
+			MAPIProperty{ID: mapiRTFCompressed, Type: MAPITypeBinary, Value: compressedRTFExample},
+			MAPIProperty{ID: mapiMessageClass, Type: MAPITypeUnicode, Value: []byte("IPM.Note")},
+		)),
+		tnefAttribute(tnefLevelAttach, tnefAttAttachRend, make([]byte, 14)),
+		tnefAttribute(tnefLevelAttach, tnefAttAttachTitle, []byte("REPORT~1.PDF\x00")),
+		tnefAttribute(tnefLevelAttach, tnefAttAttachData, []byte("%PDF-1.4 report")),
+		tnefAttribute(tnefLevelAttach, tnefAttAttachment, tnefPropertyList(
+			MAPIProperty{ID: mapiAttachLongFilename, Type: MAPITypeUnicode, Value: []byte("Quarterly report.pdf")},
+			MAPIProperty{ID: mapiAttachMimeTag, Type: MAPITypeUnicode, Value: []byte("application/pdf")},
+		)),
+		tnefAttribute(tnefLevelAttach, tnefAttAttachRend, make([]byte, 14)),
+		tnefAttribute(tnefLevelAttach, tnefAttAttachData, []byte("png data")),
+		tnefAttribute(tnefLevelAttach, tnefAttAttachment, tnefPropertyList(
+			MAPIProperty{ID: mapiAttachContentID, Type: MAPITypeUnicode, Value: []byte("chart")},
+			MAPIProperty{ID: mapiAttachMimeTag, Type: MAPITypeUnicode, Value: []byte("image/png")},
+		)),
+		tnefAttribute(tnefLevelAttach, tnefAttAttachRend, make([]byte, 14)),
+		tnefAttribute(tnefLevelAttach, tnefAttAttachment, tnefPropertyList(
+			MAPIProperty{ID: mapiAttachMethod, Type: MAPITypeInt32, Value: []byte{mapiAttachMethodEmbeddedMsg, 0, 0, 0}},
+			MAPIProperty{ID: mapiAttachDataBin, Type: MAPITypeObject, Value: append(make([]byte, tnefGUIDSize), embedded...)},
+		)),
+	)
+
+	buf := new(bytes.Buffer)
+	_, err := NewMessage().
+		From("alice@example.com").
+		Subject("Quarterly report").
+		Text("See the report").
+		Attach("notes.txt", "text/plain", bytes.NewReader([]byte("notes"))).
+		Attach("winmail.dat", "application/ms-tnef", bytes.NewReader(winmail)).
+		WriteTo(buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	plain, err := Parse(bytes.NewReader(buf.Bytes()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(plain.Attachments) != 2 || plain.Attachments[1].Filename != "winmail.dat" {
+		t.Errorf("Parse without options shouldn't decode TNEF")
+	}
+
+	email, err := ParseWithOptions(bytes.NewReader(buf.Bytes()), ParseOptions{DecodeTNEF: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if email.TextBody != "See the report" {
+		t.Errorf("Wrong text body: %q", email.TextBody)
+	}
+	if email.HTMLBody != `<p>See the <b>report</b></p><img src="cid:chart">` {
+		t.Errorf("Wrong html body: %q", email.HTMLBody)
+	}
+	if email.RTFBody != "{\\rtf1\\ansi\\ansicpg1252\\pard hello world}\r\n" {
+		t.Errorf("Wrong rtf body: %q", email.RTFBody)
+	}
+	if p := email.MAPIProperties[mapiMessageClass]; p.String() != "IPM.Note" {
+		t.Errorf("Wrong message class property: %q", p.String())
+	}
+
+	var testData = map[int]struct {
+		filename    string
+		contentType string
+		contains    string
+	}{
+		1: {"notes.txt", "text/plain", "notes"},
+		2: {"Quarterly report.pdf", "application/pdf", "%PDF-1.4 report"},
+		3: {"Forwarded meeting notes.eml", "message/rfc822", "Subject: Forwarded meeting notes"},
+	}
+
+	if len(email.Attachments) != len(testData) {
+		t.Fatalf("Wrong number of attachments. Expected: %d, Got: %d", len(testData), len(email.Attachments))
+	}
+
+	for index, td := range testData {
+		a := email.Attachments[index-1]
+		data, _ := ioutil.ReadAll(a.Data)
+
+		if a.Filename != td.filename || a.ContentType != td.contentType || !bytes.Contains(data, []byte(td.contains)) {
+			t.Errorf("[Test Case %v] Wrong attachment %s (%s): %q", index, a.Filename, a.ContentType, data)
+		}
+	}
+
+	if len(email.EmbeddedFiles) != 1 || email.EmbeddedFiles[0].CID != "chart" {
+		t.Errorf("Wrong embedded files: %v", email.EmbeddedFiles)
+	}
+}
@@ -0,0 +1,234 @@
+package parsemail
+
+import (
+	"bytes"
+	"encoding/base64"
+	"hash/crc32"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// Binary files embedded in plain text bodies by old mailers, either uuencoded or yEncoded
+
+var (
+	uuBeginLine   = regexp.MustCompile(`^begin(-base64)? +[0-7]{3,4} +(.+)$`)
+	yEncParameter = regexp.MustCompile(`(\w+)=(\S+)`)
+)
+
+// encodedBlock is a file found in a text body, spanning the lines from start to end (exclusive)
+type encodedBlock struct {
+	start, end int
+	attachment Attachment
+}
+
+// decodeEncodedFiles adds the files encoded in the text bodies of email to its attachments and rebuilds TextBody
+// from the decoded text bodies. When strip is set, the files are removed from TextBodies first.
+func decodeEncodedFiles(email *Email, strip bool) error {
+	if len(email.TextBodies) == 0 {
+		text, attachments := extractEncodedFiles(email.TextBody, strip)
+		email.TextBody = text
+		email.Attachments = append(email.Attachments, attachments...)
+		return nil
+	}
+
+	found := false
+	var text strings.Builder
+	for _, tb := range email.TextBodies {
+		data, err := readAndReset(&tb.Data)
+		if err != nil {
+			return err
+		}
+
+		body, attachments := extractEncodedFiles(string(data), strip)
+		if len(attachments) > 0 {
+			if strip {
+				tb.Data = bytes.NewReader([]byte(body))
+			}
+			found = true
+		}
+		email.Attachments = append(email.Attachments, attachments...)
+		text.WriteString(strings.TrimSuffix(body, "\n"))
+	}
+
+	if found {
+		email.TextBody = text.String()
+		email.textBodyRebuilt()
+	}
+
+	return nil
+}
+
+// extractEncodedFiles decodes the uuencoded and yEncoded files in text. When strip is set, the lines
+// of the decoded files are removed from the returned text.
+func extractEncodedFiles(text string, strip bool) (string, []Attachment) {
+	lines := strings.SplitAfter(text, "\n")
+
+	var blocks []encodedBlock
+	for i := 0; i < len(lines); i++ {
+		line := strings.TrimRight(lines[i], "\r\n")
+
+		var block *encodedBlock
+		switch {
+		case uuBeginLine.MatchString(line):
+			block = decodeUUBlock(lines, i)
+		case strings.HasPrefix(line, "=ybegin "):
+			block = decodeYEncBlock(lines, i)
+		}
+
+		if block != nil {
+			blocks = append(blocks, *block)
+			i = block.end - 1
+		}
+	}
+
+	var attachments []Attachment
+	for _, b := range blocks {
+		attachments = append(attachments, b.attachment)
+	}
+
+	if !strip || len(blocks) == 0 {
+		return text, attachments
+	}
+
+	var out strings.Builder
+	next := 0
+	for _, b := range blocks {
+		out.WriteString(strings.Join(lines[next:b.start], ""))
+		next = b.end
+	}
+	out.WriteString(strings.Join(lines[next:], ""))
+
+	return out.String(), attachments
+}
+
+// decodeUUBlock decodes the uuencoded file starting with the begin line at lines[start], it returns
+// nil when the block isn't terminated by an end line
+func decodeUUBlock(lines []string, start int) *encodedBlock {
+	m := uuBeginLine.FindStringSubmatch(strings.TrimRight(lines[start], "\r\n"))
+	isBase64, filename := m[1] != "", strings.TrimSpace(m[2])
+
+	data := new(bytes.Buffer)
+	for i := start + 1; i < len(lines); i++ {
+		line := strings.TrimRight(lines[i], "\r\n")
+
+		if isBase64 {
+			if line == "====" {
+				return newEncodedBlock(start, i+1, filename, data.Bytes())
+			}
+			b, err := base64.StdEncoding.DecodeString(line)
+			if err != nil {
+				return nil
+			}
+			data.Write(b)
+			continue
+		}
+
+		if line == "end" {
+			return newEncodedBlock(start, i+1, filename, data.Bytes())
+		}
+		if line == "" {
+			return nil
+		}
+
+		b, ok := decodeUULine(line)
+		if !ok {
+			return nil
+		}
+		data.Write(b)
+	}
+
+	return nil
+}
+
+// decodeUULine decodes a line holding its length in the first character followed by groups
+// of 4 characters for every 3 bytes
+func decodeUULine(line string) ([]byte, bool) {
+	n := int(line[0]-' ') & 63
+	if n == 0 {
+		return nil, true
+	}
+
+	chars := line[1:]
+	if (n+2)/3*4 > len(chars) {
+		return nil, false
+	}
+
+	out := make([]byte, 0, n+2)
+	for i := 0; len(out) < n; i += 4 {
+		var v [4]byte
+		for j := range v {
+			c := chars[i+j]
+			if c < ' ' || c > '`' {
+				return nil, false
+			}
+			v[j] = (c - ' ') & 63
+		}
+		out = append(out, v[0]<<2|v[1]>>4, v[1]<<4|v[2]>>2, v[2]<<6|v[3])
+	}
+
+	return out[:n], true
+}
+
+// decodeYEncBlock decodes the yEncoded file starting with the =ybegin line at lines[start], it returns
+// nil when the block isn't terminated or its size or checksum don't match
+func decodeYEncBlock(lines []string, start int) *encodedBlock {
+	header := strings.TrimRight(lines[start], "\r\n")
+	i := strings.Index(header, " name=")
+	if i < 0 {
+		return nil
+	}
+	filename := strings.TrimSpace(header[i+len(" name="):])
+
+	data := new(bytes.Buffer)
+	for i := start + 1; i < len(lines); i++ {
+		line := strings.TrimRight(lines[i], "\r\n")
+
+		if strings.HasPrefix(line, "=ypart ") {
+			continue
+		}
+
+		if strings.HasPrefix(line, "=yend") {
+			params := map[string]string{}
+			for _, m := range yEncParameter.FindAllStringSubmatch(line, -1) {
+				params[m[1]] = m[2]
+			}
+
+			if size, err := strconv.Atoi(params["size"]); err == nil && size != data.Len() && params["part"] == "" {
+				return nil
+			}
+			checksum := "crc32"
+			if params["part"] != "" {
+				checksum = "pcrc32"
+			}
+			if sum, err := strconv.ParseUint(params[checksum], 16, 32); err == nil && uint32(sum) != crc32.ChecksumIEEE(data.Bytes()) {
+				return nil
+			}
+
+			return newEncodedBlock(start, i+1, filename, data.Bytes())
+		}
+
+		for j := 0; j < len(line); j++ {
+			c := line[j]
+			if c == '=' && j+1 < len(line) {
+				j++
+				c = line[j] - 64
+			}
+			data.WriteByte(c - 42)
+		}
+	}
+
+	return nil
+}
+
+func newEncodedBlock(start, end int, filename string, data []byte) *encodedBlock {
+	return &encodedBlock{
+		start: start,
+		end:   end,
+		attachment: Attachment{
+			Filename:    filename,
+			ContentType: contentTypeByFilename(filename),
+			Data:        bytes.NewReader(data),
+		},
+	}
+}
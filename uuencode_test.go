@@ -0,0 +1,133 @@
+package parsemail
+
+import (
+	"io/ioutil"
+	"strings"
+	"testing"
+)
+
+const uuencodedExample = "From: Mary Smith <mary@x.test>\n" +
+	"To: John Doe <jdoe@machine.example>\n" +
+	"Subject: Pictures\n" +
+	"\n" +
+	"Here are the files.\n" +
+	"\n" +
+	"begin 644 image.png\n" +
+	"4B5!.1R!F86ME(&EM86=E(&1A=&$ \n" +
+	"`\n" +
+	"end\n" +
+	"\n" +
+	"=ybegin line=128 size=20 name=yenc image.png\n" +
+	"\xb3zxqJ\x90\x8b\x95\x8fJ\x93\x97\x8b\x91\x8fJ\x8e\x8b\x9e\x8b\n" +
+	"=yend size=20 crc32=6219e9b5\n" +
+	"\n" +
+	"begin 644 broken.bin\n" +
+	"not uuencoded\n" +
+	"\n" +
+	"Regards\n"
+
+func TestParseWithOptionsUUEncoded(t *testing.T) {
+	var testData = map[int]struct {
+		mailData    string
+		opts        ParseOptions
+		textBody    string
+		attachments []string
+	}{
+		1: {
+			opts:     ParseOptions{},
+			textBody: strings.TrimSuffix(uuencodedExample[strings.Index(uuencodedExample, "\n\n")+2:], "\n"),
+		},
+		2: {
+			opts:        ParseOptions{DecodeUUEncoded: true},
+			textBody:    strings.TrimSuffix(uuencodedExample[strings.Index(uuencodedExample, "\n\n")+2:], "\n"),
+			attachments: []string{"image.png", "yenc image.png"},
+		},
+		3: {
+			opts:        ParseOptions{DecodeUUEncoded: true, StripUUEncoded: true},
+			textBody:    "Here are the files.\n\n\n\nbegin 644 broken.bin\nnot uuencoded\n\nRegards",
+			attachments: []string{"image.png", "yenc image.png"},
+		},
+		4: {
+			mailData:    strings.Replace(uuencodedExample, "Subject: Pictures\n", "Subject: Pictures\nContent-Type: text/plain; format=flowed\n", 1),
+			opts:        ParseOptions{DecodeUUEncoded: true, StripUUEncoded: true, DecodeFlowed: true},
+			textBody:    "Here are the files.\n\n\n\nbegin 644 broken.bin\nnot uuencoded\n\nRegards",
+			attachments: []string{"image.png", "yenc image.png"},
+		},
+		5: {
+			mailData: "From: Mary Smith <mary@x.test>\n" +
+				"Subject: Pictures\n" +
+				"Content-Type: multipart/mixed; boundary=b1\n" +
+				"\n" +
+				"--b1\n" +
+				"Content-Type: text/plain\n" +
+				"\n" +
+				"Here are the files.\n" +
+				"--b1\n" +
+				"Content-Type: text/plain\n" +
+				"Content-Transfer-Encoding: quoted-printable\n" +
+				"\n" +
+				"begin 644 image.png\n" +
+				"4B5!.1R!F86ME(&EM86=E(&1A=&$=20\n" +
+				"`\n" +
+				"end\n" +
+				"Regards\n" +
+				"--b1--\n",
+			opts:        ParseOptions{DecodeUUEncoded: true, StripUUEncoded: true},
+			textBody:    "Here are the files.Regards",
+			attachments: []string{"image.png"},
+		},
+		6: {
+			mailData: "From: Mary Smith <mary@x.test>\n" +
+				"Subject: Pictures\n" +
+				"Content-Type: multipart/mixed; boundary=b1\n" +
+				"\n" +
+				"--b1\n" +
+				"Content-Type: text/plain\n" +
+				"Content-Transfer-Encoding: base64\n" +
+				"\n" +
+				"SGVyZSBhcmUgdGhlIGZpbGVzLgpiZWdpbiA2NDQgaW1hZ2UucG5nCjRCNSEuMVIhRjg2TUUoJkVN\n" +
+				"ODY9RSgmMUE9JiQgCmAKZW5kClJlZ2FyZHMK\n" +
+				"--b1--\n",
+			opts:        ParseOptions{DecodeUUEncoded: true},
+			textBody:    "Here are the files.\nbegin 644 image.png\n4B5!.1R!F86ME(&EM86=E(&1A=&$ \n`\nend\nRegards",
+			attachments: []string{"image.png"},
+		},
+	}
+
+	for index, td := range testData {
+		if td.mailData == "" {
+			td.mailData = uuencodedExample
+		}
+
+		e, err := ParseWithOptions(strings.NewReader(td.mailData), td.opts)
+		if err != nil {
+			t.Errorf("[Test Case %v] %v", index, err)
+			continue
+		}
+
+		if e.TextBody != td.textBody {
+			t.Errorf("[Test Case %v] Wrong text body. Expected: %q, Got: %q", index, td.textBody, e.TextBody)
+		}
+
+		text := ""
+		for _, tb := range e.TextBodies {
+			data, _ := ioutil.ReadAll(tb.Data)
+			text += strings.TrimSuffix(string(data), "\n")
+		}
+		if text != td.textBody {
+			t.Errorf("[Test Case %v] Wrong text bodies. Expected: %q, Got: %q", index, td.textBody, text)
+		}
+
+		if len(e.Attachments) != len(td.attachments) {
+			t.Errorf("[Test Case %v] Wrong number of attachments. Expected: %v, Got: %v", index, len(td.attachments), len(e.Attachments))
+			continue
+		}
+
+		for i, a := range e.Attachments {
+			data, _ := ioutil.ReadAll(a.Data)
+			if a.Filename != td.attachments[i] || a.ContentType != "image/png" || string(data) != "\x89PNG fake image data" {
+				t.Errorf("[Test Case %v] Wrong attachment %s (%s): %q", index, a.Filename, a.ContentType, data)
+			}
+		}
+	}
+}
@@ -0,0 +1,240 @@
+package parsemail
+
+import (
+	"encoding/base64"
+	"fmt"
+	"strings"
+)
+
+// vCard (RFC 2426, RFC 6350) contacts sent as text/vcard parts or .vcf attachments
+
+const contentTypeTextVCard = "text/vcard"
+const contentTypeTextXVCard = "text/x-vcard"
+const contentTypeTextDirectory = "text/directory"
+
+// Contact is a vCard 3.0 or 4.0 object
+type Contact struct {
+	Version string
+	// FormattedName is the display name of the contact
+	FormattedName string
+	// FamilyName, GivenName, AdditionalNames, Prefix and Suffix are the components of the structured name
+	FamilyName      string
+	GivenName       string
+	AdditionalNames string
+	Prefix          string
+	Suffix          string
+	Nickname        string
+	// Organization is the organization name, OrganizationUnits its units
+	Organization      string
+	OrganizationUnits []string
+	Title             string
+	Emails            []ContactValue
+	Phones            []ContactValue
+	URL               string
+	Note              string
+	Photo             *ContactPhoto
+}
+
+// ContactValue is an email address or phone number of a contact
+type ContactValue struct {
+	Value string
+	// Types are the lowercased TYPE parameters, e.g. "work", "home", "cell" or "voice"
+	Types     []string
+	Preferred bool
+}
+
+// ContactPhoto is the photo of a contact, either inline or referenced by URL
+type ContactPhoto struct {
+	ContentType string
+	Data        []byte
+	URL         string
+}
+
+func isVCard(contentType string) bool {
+	switch contentType {
+	case contentTypeTextVCard, contentTypeTextXVCard, contentTypeTextDirectory:
+		return true
+	}
+
+	return false
+}
+
+// ParseVCards parses the vCard objects in data
+func ParseVCards(data []byte) (contacts []*Contact, err error) {
+	var contact *Contact
+	for _, line := range unfoldContentLines(data) {
+		p, err := parseCalendarProperty(line)
+		if err != nil {
+			return nil, err
+		}
+		// grouped properties like item1.EMAIL
+		if i := strings.LastIndexByte(p.name, '.'); i >= 0 {
+			p.name = p.name[i+1:]
+		}
+
+		switch {
+		case p.name == "BEGIN" && strings.EqualFold(p.value, "VCARD"):
+			if contact != nil {
+				return nil, fmt.Errorf("nested vcard")
+			}
+			contact = &Contact{}
+		case p.name == "END" && strings.EqualFold(p.value, "VCARD"):
+			if contact == nil {
+				return nil, fmt.Errorf("unexpected END:VCARD")
+			}
+			contacts = append(contacts, contact)
+			contact = nil
+		case contact == nil:
+			return nil, fmt.Errorf("vcard property %s outside of a vcard", p.name)
+		default:
+			contact.setProperty(&p)
+		}
+	}
+
+	if contact != nil {
+		return nil, fmt.Errorf("vcard not terminated")
+	}
+	if len(contacts) == 0 {
+		return nil, fmt.Errorf("vcard not found")
+	}
+
+	return contacts, nil
+}
+
+func (c *Contact) setProperty(p *calendarProperty) {
+	switch p.name {
+	case "VERSION":
+		c.Version = p.value
+	case "FN":
+		c.FormattedName = unescapeCalendarText(p.value)
+	case "N":
+		n := splitVCardValue(p.value, 5)
+		c.FamilyName, c.GivenName, c.AdditionalNames, c.Prefix, c.Suffix = n[0], n[1], n[2], n[3], n[4]
+	case "NICKNAME":
+		c.Nickname = unescapeCalendarText(p.value)
+	case "ORG":
+		org := splitVCardValue(p.value, 1)
+		c.Organization = org[0]
+		for _, unit := range org[1:] {
+			if unit != "" {
+				c.OrganizationUnits = append(c.OrganizationUnits, unit)
+			}
+		}
+	case "TITLE":
+		c.Title = unescapeCalendarText(p.value)
+	case "EMAIL":
+		c.Emails = append(c.Emails, newContactValue(p, unescapeCalendarText(p.value)))
+	case "TEL":
+		value := p.value
+		if len(value) >= len("tel:") && strings.EqualFold(value[:len("tel:")], "tel:") {
+			value = value[len("tel:"):]
+		}
+		c.Phones = append(c.Phones, newContactValue(p, value))
+	case "URL":
+		c.URL = p.value
+	case "NOTE":
+		c.Note = unescapeCalendarText(p.value)
+	case "PHOTO":
+		c.Photo = parseVCardPhoto(p)
+	}
+}
+
+// splitVCardValue splits a structured value on unescaped ';', returning at least n components
+func splitVCardValue(value string, n int) []string {
+	var components []string
+	var current strings.Builder
+	for i := 0; i < len(value); i++ {
+		switch {
+		case value[i] == '\\' && i+1 < len(value):
+			current.WriteString(value[i : i+2])
+			i++
+		case value[i] == ';':
+			components = append(components, unescapeCalendarText(current.String()))
+			current.Reset()
+		default:
+			current.WriteByte(value[i])
+		}
+	}
+	components = append(components, unescapeCalendarText(current.String()))
+
+	for len(components) < n {
+		components = append(components, "")
+	}
+
+	return components
+}
+
+func newContactValue(p *calendarProperty, value string) ContactValue {
+	v := ContactValue{Value: value, Preferred: p.params["PREF"] != ""}
+	for _, t := range strings.Split(p.params["TYPE"], ",") {
+		t = strings.ToLower(strings.TrimSpace(t))
+		switch t {
+		case "":
+		case "pref":
+			v.Preferred = true
+		default:
+			v.Types = append(v.Types, t)
+		}
+	}
+
+	return v
+}
+
+// parseVCardPhoto reads an inline base64 photo of vCard 3.0 (ENCODING=b) or 4.0 (a data: URI),
+// any other value is a URL
+func parseVCardPhoto(p *calendarProperty) *ContactPhoto {
+	encoding := strings.ToLower(p.params["ENCODING"])
+	if encoding == "b" || encoding == "base64" {
+		data, err := base64.StdEncoding.DecodeString(strings.Join(strings.Fields(p.value), ""))
+		if err != nil {
+			return nil
+		}
+
+		contentType := strings.ToLower(p.params["TYPE"])
+		if contentType != "" && !strings.Contains(contentType, "/") {
+			contentType = "image/" + contentType
+		}
+
+		return &ContactPhoto{ContentType: contentType, Data: data}
+	}
+
+	if strings.HasPrefix(p.value, "data:") {
+		comma := strings.IndexByte(p.value, ',')
+		if comma < 0 || !strings.HasSuffix(p.value[:comma], ";base64") {
+			return nil
+		}
+		data, err := base64.StdEncoding.DecodeString(p.value[comma+1:])
+		if err != nil {
+			return nil
+		}
+
+		return &ContactPhoto{ContentType: strings.TrimSuffix(p.value[len("data:"):comma], ";base64"), Data: data}
+	}
+
+	return &ContactPhoto{ContentType: p.params["MEDIATYPE"], URL: p.value}
+}
+
+// findContacts parses the vCard attachments of email, the data of the attachments stays readable
+func findContacts(email *Email) (contacts []*Contact) {
+	if mediaType, _, err := parseContentType(email.ContentType); err == nil && isVCard(mediaType) {
+		data, _ := readAndReset(&email.Content)
+		c, _ := ParseVCards(data)
+		contacts = append(contacts, c...)
+	}
+
+	for i := range email.Attachments {
+		at := &email.Attachments[i]
+		if !isVCard(strings.ToLower(at.ContentType)) && !strings.HasSuffix(strings.ToLower(at.Filename), ".vcf") {
+			continue
+		}
+
+		data, err := readAndReset(&at.Data)
+		if err != nil {
+			continue
+		}
+		c, _ := ParseVCards(data)
+		contacts = append(contacts, c...)
+	}
+
+	return
+}
@@ -0,0 +1,183 @@
+package parsemail
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestParseVCards(t *testing.T) {
+	var testData = map[int]struct {
+		vcard    string
+		contacts []*Contact
+	}{
+		1: {
+			vcard: `BEGIN:VCARD
+VERSION:3.0
+N:Doe;John;Q.;Mr.;Jr.
+FN:John Doe
+ORG:Example\, Inc.;Sales;EMEA
+TITLE:Account Manager
+EMAIL;TYPE=INTERNET,WORK,pref:john@example.com
+EMAIL;TYPE=INTERNET;TYPE=HOME:john.doe@example.net
+TEL;TYPE=CELL:+1 555 0100
+item1.TEL;TYPE=WORK,VOICE:+1 555 0101
+NOTE:First line\nsecond line
+PHOTO;ENCODING=b;TYPE=PNG:UE5HRE
+ FUQQ==
+END:VCARD
+`,
+			contacts: []*Contact{{
+				Version:           "3.0",
+				FormattedName:     "John Doe",
+				FamilyName:        "Doe",
+				GivenName:         "John",
+				AdditionalNames:   "Q.",
+				Prefix:            "Mr.",
+				Suffix:            "Jr.",
+				Organization:      "Example, Inc.",
+				OrganizationUnits: []string{"Sales", "EMEA"},
+				Title:             "Account Manager",
+				Emails: []ContactValue{
+					{Value: "john@example.com", Types: []string{"internet", "work"}, Preferred: true},
+					{Value: "john.doe@example.net", Types: []string{"internet", "home"}},
+				},
+				Phones: []ContactValue{
+					{Value: "+1 555 0100", Types: []string{"cell"}},
+					{Value: "+1 555 0101", Types: []string{"work", "voice"}},
+				},
+				Note:  "First line\nsecond line",
+				Photo: &ContactPhoto{ContentType: "image/png", Data: []byte("PNGDATA")},
+			}},
+		},
+		2: {
+			vcard: `BEGIN:VCARD
+VERSION:4.0
+FN:Jane Roe
+N:Roe;Jane;;;
+EMAIL;TYPE="work,internet";PREF=1:jane@example.com
+TEL;VALUE=uri;TYPE="voice,home":tel:+1-555-0102
+PHOTO:data:image/jpeg;base64,UE5HREFUQQ==
+END:VCARD
+BEGIN:VCARD
+VERSION:4.0
+FN:Support
+PHOTO;MEDIATYPE=image/png:https://example.com/support.png
+END:VCARD
+`,
+			contacts: []*Contact{
+				{
+					Version:       "4.0",
+					FormattedName: "Jane Roe",
+					FamilyName:    "Roe",
+					GivenName:     "Jane",
+					Emails:        []ContactValue{{Value: "jane@example.com", Types: []string{"work", "internet"}, Preferred: true}},
+					Phones:        []ContactValue{{Value: "+1-555-0102", Types: []string{"voice", "home"}}},
+					Photo:         &ContactPhoto{ContentType: "image/jpeg", Data: []byte("PNGDATA")},
+				},
+				{
+					Version:       "4.0",
+					FormattedName: "Support",
+					Photo:         &ContactPhoto{ContentType: "image/png", URL: "https://example.com/support.png"},
+				},
+			},
+		},
+	}
+
+	for index, td := range testData {
+		contacts, err := ParseVCards([]byte(strings.Replace(td.vcard, "\n", "\r\n", -1)))
+		if err != nil {
+			t.Errorf("[Test Case %v] Unexpected error: %v", index, err)
+			continue
+		}
+
+		if !reflect.DeepEqual(contacts, td.contacts) {
+			t.Errorf("[Test Case %v] Wrong contacts.\nExpected: %+v\nGot: %+v", index, td.contacts[0], contacts[0])
+		}
+	}
+}
+
+func TestParseEmailContacts(t *testing.T) {
+	var testData = map[int]struct {
+		mailData string
+		names    []string
+		textBody string
+	}{
+		1: {
+			mailData: `From: a@example.com
+To: b@example.com
+Subject: Contact
+MIME-Version: 1.0
+Content-Type: multipart/alternative; boundary="b1"
+
+--b1
+Content-Type: text/plain
+
+John Doe
+--b1
+Content-Type: text/x-vcard
+
+BEGIN:VCARD
+VERSION:3.0
+FN:John Doe
+END:VCARD
+--b1--
+`,
+			names:    []string{"John Doe"},
+			textBody: "John Doe",
+		},
+		2: {
+			mailData: `From: a@example.com
+To: b@example.com
+Subject: Contacts
+MIME-Version: 1.0
+Content-Type: multipart/mixed; boundary="b1"
+
+--b1
+Content-Type: text/plain
+
+Two contacts.
+--b1
+Content-Type: text/vcard; charset=utf-8
+
+BEGIN:VCARD
+VERSION:4.0
+FN:Jane Roe
+END:VCARD
+--b1
+Content-Type: application/octet-stream
+Content-Disposition: attachment; filename="support.vcf"
+Content-Transfer-Encoding: base64
+
+QkVHSU46VkNBUkQNClZFUlNJT046My4wDQpGTjpTdXBwb3J0DQpFTkQ6VkNBUkQNCg==
+--b1--
+`,
+			names:    []string{"Jane Roe", "Support"},
+			textBody: "Two contacts.",
+		},
+	}
+
+	for index, td := range testData {
+		e, err := Parse(strings.NewReader(td.mailData))
+		if err != nil {
+			t.Errorf("[Test Case %v] Unexpected error: %v", index, err)
+			continue
+		}
+
+		if e.TextBody != td.textBody {
+			t.Errorf("[Test Case %v] Wrong text body. Expected: %q, Got: %q", index, td.textBody, e.TextBody)
+		}
+
+		var names []string
+		for _, c := range e.Contacts {
+			names = append(names, c.FormattedName)
+		}
+		if !reflect.DeepEqual(names, td.names) {
+			t.Errorf("[Test Case %v] Wrong contacts. Expected: %v, Got: %v", index, td.names, names)
+		}
+
+		if len(e.Attachments) != len(td.names) {
+			t.Errorf("[Test Case %v] Expected the vcards to stay attachments, got %v attachments", index, len(e.Attachments))
+		}
+	}
+}
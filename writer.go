@@ -0,0 +1,741 @@
+package parsemail
+
+import (
+	"bytes"
+	"crypto/rand"
+	"encoding/base64"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"mime"
+	"mime/quotedprintable"
+	"net/mail"
+	"net/textproto"
+	"sort"
+	"strings"
+	"time"
+)
+
+const maxHeaderLineLength = 78
+const maxBodyLineLength = 998
+const base64LineLength = 76
+
+// headers generated from Email fields by WriteTo, they are never copied over from Email.Header
+var writerOwnedHeaders = map[string]bool{
+	"Date":                      true,
+	"From":                      true,
+	"Sender":                    true,
+	"Reply-To":                  true,
+	"To":                        true,
+	"Cc":                        true,
+	"Bcc":                       true,
+	"Subject":                   true,
+	"Message-Id":                true,
+	"In-Reply-To":               true,
+	"References":                true,
+	"Resent-Date":               true,
+	"Resent-From":               true,
+	"Resent-Sender":             true,
+	"Resent-To":                 true,
+	"Resent-Cc":                 true,
+	"Resent-Bcc":                true,
+	"Resent-Message-Id":         true,
+	"Mime-Version":              true,
+	"Content-Type":              true,
+	"Content-Transfer-Encoding": true,
+	"Content-Disposition":       true,
+	"Content-Id":                true,
+}
+
+// WriteTo serializes the email as an RFC 5322 message with a MIME structure generated from its fields.
+//
+// An email returned by Parse whose fields were not modified is written out exactly as it was parsed. Once
+// a field changes, the message is generated from the fields and the MIME parts that were not modified are
+// copied over byte-for-byte from the source message, as long as the generated structure places them like
+// the source did. Parts laid out differently, e.g. the text parts of a multipart/mixed body which are merged
+// into a single one, are regenerated along with their enclosing multiparts. Data readers are compared by
+// identity, an attachment whose reader was replaced counts as modified.
+//
+// Standard headers are generated from the corresponding fields and keep the position of the source fields.
+// The other fields from Header, including trace fields like Received and DKIM-Signature, are copied over
+// verbatim and in their original order unless their value changed, new fields follow the source ones. Bcc is
+// written when set, so clear it before handing the output to an MTA.
+// The body is built from TextBody, HTMLBody, EmbeddedFiles, Attachments and ExternalBodies (or Content for
+// single part emails without a text body), nested as multipart/mixed → related → alternative as needed.
+// While TextBody and HTMLBody hold the still encoded text returned by Parse, the parts are generated from the
+// decoded data of TextBodies and HTMLBodies. Line breaks in text bodies are normalized to CRLF. Data readers of attachments and embedded files are
+// rewound after being read, or replaced with equivalent readers if they can't seek, so the email can be
+// written more than once.
+func (e *Email) WriteTo(w io.Writer) (int64, error) {
+	cw := &countingWriter{w: w}
+
+	if e.isUnmodified() {
+		_, err := cw.Write(e.source.raw)
+		return cw.n, err
+	}
+
+	root, err := e.buildMIMETree()
+	if err != nil {
+		return cw.n, err
+	}
+
+	header := e.messageHeader()
+	if sp := e.source.lookup(root); sp != nil {
+		if sp == e.source.root && fingerprintHeader(header) == e.source.header {
+			_, err = cw.Write(e.source.raw)
+			return cw.n, err
+		}
+
+		for _, f := range header {
+			if err := writeHeaderField(cw, f.name, f.value); err != nil {
+				return cw.n, err
+			}
+		}
+
+		if sp != e.source.root {
+			// the part brings its own content header fields
+			_, err = cw.Write(e.source.raw[sp.start:sp.end])
+			return cw.n, err
+		}
+
+		for _, f := range sp.contentFields() {
+			if _, err := io.WriteString(cw, f.Raw()+"\r\n"); err != nil {
+				return cw.n, err
+			}
+		}
+		if _, err := io.WriteString(cw, "\r\n"); err != nil {
+			return cw.n, err
+		}
+		_, err = cw.Write(e.source.raw[sp.bodyStart:sp.end])
+
+		return cw.n, err
+	}
+
+	contentHeader, body, err := root.content()
+	if err != nil {
+		return cw.n, err
+	}
+
+	for _, f := range append(append(header, root.header...), contentHeader...) {
+		if err := writeHeaderField(cw, f.name, f.value); err != nil {
+			return cw.n, err
+		}
+	}
+
+	if _, err := io.WriteString(cw, "\r\n"); err != nil {
+		return cw.n, err
+	}
+
+	if root.children == nil {
+		_, err = cw.Write(body)
+		return cw.n, err
+	}
+
+	err = root.writeBody(cw, e.source)
+
+	return cw.n, err
+}
+
+// headerEntry is a header field to be folded on write, entries without a name hold a field copied over
+// verbatim from the source message
+type headerEntry struct {
+	name  string
+	value string
+}
+
+// mimeNode is a MIME part generated from the fields of an email. The data of leaves is only read and encoded
+// by load when the part is written, key identifies that data so unmodified parts can be recognized without it.
+type mimeNode struct {
+	header   []headerEntry
+	body     []byte
+	key      string
+	load     func() ([]headerEntry, []byte, error)
+	boundary string
+	children []*mimeNode
+	sum      string
+}
+
+// content returns the header fields describing the encoding of the node's body along with the encoded body
+func (n *mimeNode) content() ([]headerEntry, []byte, error) {
+	if n.load == nil {
+		return nil, n.body, nil
+	}
+
+	return n.load()
+}
+
+// writePart writes the node with its header, copying it over from src if it is unmodified
+func (n *mimeNode) writePart(w io.Writer, src *sourceMessage) error {
+	if sp := src.lookup(n); sp != nil && sp != src.root {
+		_, err := w.Write(src.raw[sp.start:sp.end])
+		return err
+	}
+
+	contentHeader, body, err := n.content()
+	if err != nil {
+		return err
+	}
+
+	for _, f := range append(append([]headerEntry{}, n.header...), contentHeader...) {
+		if err := writeHeaderField(w, f.name, f.value); err != nil {
+			return err
+		}
+	}
+
+	if _, err := io.WriteString(w, "\r\n"); err != nil {
+		return err
+	}
+
+	if n.children == nil {
+		_, err := w.Write(body)
+		return err
+	}
+
+	return n.writeBody(w, src)
+}
+
+func (n *mimeNode) writeBody(w io.Writer, src *sourceMessage) error {
+	for i, child := range n.children {
+		delimiter := "\r\n--" + n.boundary + "\r\n"
+		if i == 0 {
+			delimiter = delimiter[2:]
+		}
+		if _, err := io.WriteString(w, delimiter); err != nil {
+			return err
+		}
+
+		if err := child.writePart(w, src); err != nil {
+			return err
+		}
+	}
+
+	_, err := io.WriteString(w, "\r\n--"+n.boundary+"--\r\n")
+
+	return err
+}
+
+func newMultipartNode(subtype string, params map[string]string, children ...*mimeNode) *mimeNode {
+	boundary := randomBoundary()
+
+	typeParams := map[string]string{"boundary": boundary}
+	for k, v := range params {
+		if k != "boundary" {
+			typeParams[k] = v
+		}
+	}
+
+	return &mimeNode{
+		header: []headerEntry{
+			{"Content-Type", mime.FormatMediaType("multipart/"+subtype, typeParams)},
+		},
+		boundary: boundary,
+		children: children,
+	}
+}
+
+// buildMIMETree generates the MIME structure of the email, no data is read until the nodes are written
+func (e *Email) buildMIMETree() (*mimeNode, error) {
+	var digest *mimeNode
+	if len(e.Digest) > 0 {
+		var messages []*mimeNode
+		for _, m := range e.Digest {
+			m := m
+			messages = append(messages, &mimeNode{
+				header: []headerEntry{{"Content-Type", contentTypeMessageRFC822}},
+				key:    fmt.Sprintf("%p %s", m, m.fingerprintState()),
+				load: func() ([]headerEntry, []byte, error) {
+					buf := new(bytes.Buffer)
+					_, err := m.WriteTo(buf)
+					return nil, buf.Bytes(), err
+				},
+			})
+		}
+		digest = newMultipartNode("digest", nil, messages...)
+	}
+
+	var alternatives []*mimeNode
+	if e.TextBody != "" || (e.HTMLBody == "" && e.Content == nil && digest == nil && len(e.ExternalBodies) == 0) {
+		var readers []*io.Reader
+		for _, b := range e.TextBodies {
+			readers = append(readers, &b.Data)
+		}
+		params := e.textBodyParams()
+		parsed := e.source != nil && e.TextBody == e.source.textBody
+		if e.source != nil && !parsed {
+			params = editedBodyParams(params)
+		}
+		alternatives = append(alternatives, newBodyNode(contentTypeTextPlain, params, e.TextBody, parsed, readers))
+	}
+	for _, ab := range e.AlternativeBodies {
+		alternatives = append(alternatives, newTextReaderNode(ab.ContentType, ab.Params, &ab.Data))
+	}
+	if e.HTMLBody != "" {
+		var readers []*io.Reader
+		for _, b := range e.HTMLBodies {
+			readers = append(readers, &b.Data)
+		}
+		params := e.htmlBodyParams()
+		parsed := e.source != nil && e.HTMLBody == e.source.htmlBody
+		if e.source != nil && !parsed {
+			params = editedBodyParams(params)
+		}
+		alternatives = append(alternatives, newBodyNode(contentTypeTextHtml, params, e.HTMLBody, parsed, readers))
+	}
+
+	var embeddedFiles []*EmbeddedFile
+	for i := range e.EmbeddedFiles {
+		ef := &e.EmbeddedFiles[i]
+		if !isAlternativeCalendar(ef) || len(alternatives) == 0 {
+			embeddedFiles = append(embeddedFiles, ef)
+			continue
+		}
+
+		contentType, params, err := parseContentType(ef.ContentType)
+		if err != nil {
+			return nil, err
+		}
+		alternatives = append(alternatives, newTextReaderNode(contentType, params, &ef.Data))
+	}
+
+	var root *mimeNode
+	switch {
+	case len(alternatives) == 0 && (digest != nil || len(e.ExternalBodies) > 0):
+	case len(alternatives) == 0:
+		root = newBinaryNode(e.ContentType, &e.Content)
+	case len(alternatives) == 1:
+		root = alternatives[0]
+	default:
+		root = newMultipartNode("alternative", nil, alternatives...)
+	}
+
+	if len(embeddedFiles) > 0 && root != nil {
+		related := []*mimeNode{root}
+		for _, ef := range embeddedFiles {
+			node := newBinaryNode(ef.ContentType, &ef.Data)
+			if ef.CID != "" {
+				node.header = append(node.header, headerEntry{"Content-ID", "<" + ef.CID + ">"})
+			}
+			node.header = append(node.header, headerEntry{"Content-Disposition", "inline"})
+			related = append(related, node)
+		}
+		root = newMultipartNode("related", nil, related...)
+	}
+
+	var mixed []*mimeNode
+	for _, n := range []*mimeNode{root, digest} {
+		if n != nil {
+			mixed = append(mixed, n)
+		}
+	}
+	for i := range e.ExternalBodies {
+		mixed = append(mixed, newExternalBodyNode(&e.ExternalBodies[i]))
+	}
+
+	if len(e.Attachments) > 0 || len(mixed) > 1 {
+		for i := range e.Attachments {
+			at := &e.Attachments[i]
+
+			contentType := at.ContentType
+			if contentType == "" {
+				contentType = contentTypeApplicationOctetStream
+			}
+			typeParams, dispositionParams := map[string]string{}, map[string]string{}
+			if at.Filename != "" {
+				typeParams["name"] = at.Filename
+				dispositionParams["filename"] = at.Filename
+			}
+
+			node := newBinaryNode(mime.FormatMediaType(contentType, typeParams), &at.Data)
+			node.header = append(node.header, headerEntry{"Content-Disposition", mime.FormatMediaType("attachment", dispositionParams)})
+			mixed = append(mixed, node)
+		}
+
+		// signed messages are parsed like multipart/mixed, they keep their type so that an unmodified
+		// signed body can be copied over from the source
+		subtype, params := "mixed", map[string]string(nil)
+		if mediaType, p, err := parseContentType(e.ContentType); err == nil && mediaType == contentTypeMultipartSigned {
+			subtype, params = "signed", p
+		}
+		root = newMultipartNode(subtype, params, mixed...)
+	} else if len(mixed) == 1 {
+		root = mixed[0]
+	}
+
+	return root, nil
+}
+
+// isAlternativeCalendar reports whether ef is a text/calendar alternative of the bodies, like the invitations
+// parsed from multipart/alternative, rather than a file referenced by the HTML body
+func isAlternativeCalendar(ef *EmbeddedFile) bool {
+	contentType, _, err := parseContentType(ef.ContentType)
+
+	return err == nil && contentType == contentTypeTextCalendar && ef.CID == ""
+}
+
+func (e *Email) textBodyParams() map[string]string {
+	if len(e.TextBodies) > 0 && e.TextBodies[0].Params != nil {
+		return e.TextBodies[0].Params
+	}
+
+	return map[string]string{"charset": "utf-8"}
+}
+
+func (e *Email) htmlBodyParams() map[string]string {
+	if len(e.HTMLBodies) > 0 && e.HTMLBodies[0].Params != nil {
+		return e.HTMLBodies[0].Params
+	}
+
+	return map[string]string{"charset": "utf-8"}
+}
+
+// editedBodyParams adjusts the parameters of a parsed body to its edited text, which is written as UTF-8 and
+// no longer follows the format=flowed encoding of the source
+func editedBodyParams(params map[string]string) map[string]string {
+	edited := map[string]string{}
+	for k, v := range params {
+		if k != "format" && k != "delsp" {
+			edited[k] = v
+		}
+	}
+	edited["charset"] = "utf-8"
+
+	return edited
+}
+
+// newBodyNode generates the text or HTML body part. TextBody and HTMLBody of a parsed email keep the transfer
+// encoding of the source parts, so while text is the one Parse returned (parsed is true) the part is generated
+// from the decoded data of readers instead.
+func newBodyNode(contentType string, params map[string]string, text string, parsed bool, readers []*io.Reader) *mimeNode {
+	key := text
+	for _, r := range readers {
+		key += "\n" + readerIdentity(*r)
+	}
+
+	return &mimeNode{
+		header: []headerEntry{{"Content-Type", mime.FormatMediaType(contentType, params)}},
+		key:    key,
+		load: func() ([]headerEntry, []byte, error) {
+			if !parsed || len(readers) == 0 {
+				return encodeText([]byte(text))
+			}
+
+			var data []byte
+			for _, r := range readers {
+				b, err := readAndReset(r)
+				if err != nil {
+					return nil, nil, err
+				}
+				data = append(data, bytes.TrimSuffix(b, []byte("\n"))...)
+			}
+			return encodeText(data)
+		},
+	}
+}
+
+// newTextReaderNode generates a text part from the data of r
+func newTextReaderNode(contentType string, params map[string]string, r *io.Reader) *mimeNode {
+	return &mimeNode{
+		header: []headerEntry{{"Content-Type", mime.FormatMediaType(contentType, params)}},
+		key:    readerIdentity(*r),
+		load: func() ([]headerEntry, []byte, error) {
+			data, err := readAndReset(r)
+			if err != nil {
+				return nil, nil, err
+			}
+			return encodeText(data)
+		},
+	}
+}
+
+// encodeText normalizes the line breaks of text and picks a transfer encoding for it
+func encodeText(text []byte) ([]headerEntry, []byte, error) {
+	data := []byte(normalizeLineBreaks(string(text)))
+	encoding := textTransferEncoding(data)
+
+	body := data
+	if encoding == "quoted-printable" {
+		buf := new(bytes.Buffer)
+		qp := quotedprintable.NewWriter(buf)
+		qp.Write(data)
+		qp.Close()
+		body = buf.Bytes()
+	}
+
+	return []headerEntry{{"Content-Transfer-Encoding", encoding}}, body, nil
+}
+
+// newBinaryNode generates a base64 encoded part from the data of r
+func newBinaryNode(contentType string, r *io.Reader) *mimeNode {
+	if contentType == "" {
+		contentType = contentTypeApplicationOctetStream
+	}
+
+	return &mimeNode{
+		header: []headerEntry{{"Content-Type", contentType}},
+		key:    readerIdentity(*r),
+		load: func() ([]headerEntry, []byte, error) {
+			data, err := readAndReset(r)
+			if err != nil {
+				return nil, nil, err
+			}
+			return []headerEntry{{"Content-Transfer-Encoding", "base64"}}, encodeBase64Lines(data), nil
+		},
+	}
+}
+
+// messageHeader returns the top level header fields of the email, except for the MIME content fields.
+// The fields keep the order of RawHeaders: generated fields take the place of the first field of the same
+// name, the other fields of Header, like the Received and DKIM-Signature trace fields, are copied over verbatim
+// while their value is unchanged. New fields follow the ones of the source.
+func (e *Email) messageHeader() (header []headerEntry) {
+	var generated []headerEntry
+	add := func(name, value string) {
+		if value != "" {
+			generated = append(generated, headerEntry{name, value})
+		}
+	}
+
+	add("Resent-Date", formatDate(e.ResentDate))
+	add("Resent-From", formatAddressList(e.ResentFrom))
+	add("Resent-Sender", formatAddress(e.ResentSender))
+	add("Resent-To", formatAddressList(e.ResentTo))
+	add("Resent-Cc", formatAddressList(e.ResentCc))
+	add("Resent-Bcc", formatAddressList(e.ResentBcc))
+	add("Resent-Message-ID", formatMessageIdList([]string{e.ResentMessageID}))
+	add("Date", formatDate(e.Date))
+	add("From", formatAddressList(e.From))
+	add("Sender", formatAddress(e.Sender))
+	add("Reply-To", formatAddressList(e.ReplyTo))
+	add("To", formatAddressList(e.To))
+	add("Cc", formatAddressList(e.Cc))
+	add("Bcc", formatAddressList(e.Bcc))
+	add("Message-ID", formatMessageIdList([]string{e.MessageID}))
+	add("In-Reply-To", formatMessageIdList(e.InReplyTo))
+	add("References", formatMessageIdList(e.References))
+	add("Subject", mime.QEncoding.Encode("utf-8", e.Subject))
+	add("MIME-Version", "1.0")
+
+	written := map[string]bool{}
+	writeGenerated := func(name string) {
+		for _, f := range generated {
+			if textproto.CanonicalMIMEHeaderKey(f.name) == name && !written[name] {
+				header = append(header, f)
+			}
+		}
+		written[name] = true
+	}
+
+	copied := map[string]int{}
+	for _, f := range e.RawHeaders {
+		name := textproto.CanonicalMIMEHeaderKey(f.Name)
+		if writerOwnedHeaders[name] {
+			writeGenerated(name)
+			continue
+		}
+
+		i := copied[name]
+		if i >= len(e.Header[name]) {
+			continue
+		}
+		copied[name]++
+
+		if value := e.Header[name][i]; strings.Join(strings.Fields(value), " ") != strings.Join(strings.Fields(f.DecodedValue), " ") {
+			header = append(header, headerEntry{name, mime.QEncoding.Encode("utf-8", value)})
+		} else {
+			header = append(header, headerEntry{"", f.Raw()})
+		}
+	}
+
+	for _, f := range generated {
+		if name := textproto.CanonicalMIMEHeaderKey(f.name); name != "Mime-Version" {
+			writeGenerated(name)
+		}
+	}
+
+	var names []string
+	for name := range e.Header {
+		if !writerOwnedHeaders[name] {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		for _, value := range e.Header[name][copied[name]:] {
+			header = append(header, headerEntry{name, mime.QEncoding.Encode("utf-8", value)})
+		}
+	}
+
+	writeGenerated("Mime-Version")
+
+	return
+}
+
+func formatDate(t time.Time) string {
+	if t.IsZero() {
+		return ""
+	}
+
+	return t.Format(time.RFC1123Z)
+}
+
+func formatAddress(a *mail.Address) string {
+	if a == nil {
+		return ""
+	}
+
+	return a.String()
+}
+
+func formatAddressList(al []*mail.Address) string {
+	var result []string
+	for _, a := range al {
+		if a != nil {
+			result = append(result, a.String())
+		}
+	}
+
+	return strings.Join(result, ", ")
+}
+
+func formatMessageIdList(ids []string) string {
+	var result []string
+	for _, id := range ids {
+		if id != "" {
+			result = append(result, "<"+id+">")
+		}
+	}
+
+	return strings.Join(result, " ")
+}
+
+// writeHeaderField writes a header field folded on whitespace so that lines stay within 78 characters where possible
+func writeHeaderField(w io.Writer, name, value string) error {
+	if name == "" {
+		_, err := io.WriteString(w, normalizeLineBreaks(value)+"\r\n")
+		return err
+	}
+
+	_, err := io.WriteString(w, foldHeaderField(name, value)+"\r\n")
+
+	return err
+}
+
+func foldHeaderField(name, value string) string {
+	line := name + ":"
+	lineLength := len(line)
+	out := new(strings.Builder)
+
+	for _, word := range strings.Split(value, " ") {
+		if lineLength+1+len(word) > maxHeaderLineLength && lineLength > len(name)+1 {
+			out.WriteString(line)
+			out.WriteString("\r\n")
+			line, lineLength = "", 0
+		}
+		line += " " + word
+		lineLength += 1 + len(word)
+	}
+	out.WriteString(line)
+
+	return out.String()
+}
+
+func normalizeLineBreaks(s string) string {
+	s = strings.Replace(s, "\r\n", "\n", -1)
+
+	return strings.Replace(s, "\n", "\r\n", -1)
+}
+
+// textTransferEncoding picks the least intrusive transfer encoding able to carry data
+func textTransferEncoding(data []byte) string {
+	eightBit := false
+	lineLength := 0
+
+	for _, c := range data {
+		switch {
+		case c == '\n':
+			lineLength = 0
+			continue
+		case c == 0:
+			return "quoted-printable"
+		case c >= 0x80:
+			eightBit = true
+		}
+
+		lineLength++
+		if lineLength > maxBodyLineLength {
+			return "quoted-printable"
+		}
+	}
+
+	if eightBit {
+		return "8bit"
+	}
+
+	return "7bit"
+}
+
+func encodeBase64Lines(data []byte) []byte {
+	encoded := base64.StdEncoding.EncodeToString(data)
+	out := new(bytes.Buffer)
+
+	for len(encoded) > base64LineLength {
+		out.WriteString(encoded[:base64LineLength])
+		out.WriteString("\r\n")
+		encoded = encoded[base64LineLength:]
+	}
+	out.WriteString(encoded)
+
+	return out.Bytes()
+}
+
+// readAndReset reads all the data of r from its start and restores its position, readers which can't seek are
+// replaced with a fresh reader over the remaining data
+func readAndReset(r *io.Reader) ([]byte, error) {
+	if *r == nil {
+		return nil, nil
+	}
+
+	if s, ok := (*r).(io.ReadSeeker); ok {
+		if pos, err := s.Seek(0, io.SeekCurrent); err == nil {
+			if _, err := s.Seek(0, io.SeekStart); err != nil {
+				return nil, err
+			}
+			data, err := ioutil.ReadAll(s)
+			if err != nil {
+				return nil, err
+			}
+			_, err = s.Seek(pos, io.SeekStart)
+
+			return data, err
+		}
+	}
+
+	data, err := ioutil.ReadAll(*r)
+	if err != nil {
+		return nil, err
+	}
+	*r = bytes.NewReader(data)
+
+	return data, nil
+}
+
+func randomBoundary() string {
+	var buf [30]byte
+	if _, err := io.ReadFull(rand.Reader, buf[:]); err != nil {
+		panic(err)
+	}
+
+	return fmt.Sprintf("%x", buf[:])
+}
+
+type countingWriter struct {
+	w io.Writer
+	n int64
+}
+
+func (cw *countingWriter) Write(p []byte) (int, error) {
+	n, err := cw.w.Write(p)
+	cw.n += int64(n)
+
+	return n, err
+}
@@ -0,0 +1,407 @@
+package parsemail
+
+import (
+	"bytes"
+	"io"
+	"io/ioutil"
+	"strings"
+	"testing"
+)
+
+func TestWriteTo(t *testing.T) {
+	var testData = map[int]struct {
+		mailData string
+		modify   func(*Email)
+	}{
+		1: {
+			mailData: rfc5322exampleA11,
+		},
+		2: {
+			mailData: rfc5322exampleA12,
+		},
+		3: {
+			mailData: rfc5322exampleA3,
+		},
+		4: {
+			mailData: data1,
+			modify: func(e *Email) {
+				e.Subject = "Žluťoučký kůň úpěl ďábelské ódy, a přitom se ještě stihl zamyslet nad dlouhým předmětem"
+			},
+		},
+		5: {
+			mailData: multipartRelatedExample,
+			modify: func(e *Email) {
+				e.HTMLBody = `<p><img src="cid:logo"></p>`
+				e.EmbeddedFiles = append(e.EmbeddedFiles, EmbeddedFile{
+					CID:         "logo",
+					ContentType: "image/gif",
+					Data:        strings.NewReader("GIF89a"),
+				})
+			},
+		},
+		6: {
+			mailData: attachment7bit,
+			modify: func(e *Email) {
+				e.Attachments = nil
+				e.TextBody = strings.Repeat("a", 1200) + "\nnon-ascii: ďábel"
+			},
+		},
+	}
+
+	for index, td := range testData {
+		e, err := Parse(strings.NewReader(td.mailData))
+		if err != nil {
+			t.Error(err)
+			continue
+		}
+
+		if td.modify != nil {
+			td.modify(&e)
+		}
+
+		buf := new(bytes.Buffer)
+		n, err := e.WriteTo(buf)
+		if err != nil {
+			t.Errorf("[Test Case %v] %v", index, err)
+			continue
+		}
+
+		if n != int64(buf.Len()) {
+			t.Errorf("[Test Case %v] Wrong number of bytes written. Expected: %v, Got: %v", index, buf.Len(), n)
+		}
+
+		for _, line := range strings.Split(buf.String(), "\r\n") {
+			if len(line) > maxBodyLineLength {
+				t.Errorf("[Test Case %v] Line too long: %v", index, len(line))
+			}
+		}
+
+		r, err := Parse(bytes.NewReader(buf.Bytes()))
+		if err != nil {
+			t.Errorf("[Test Case %v] Can't parse written email: %v\n%s", index, err, buf.String())
+			continue
+		}
+
+		if e.Subject != r.Subject {
+			t.Errorf("[Test Case %v] Wrong subject. Expected: %s, Got: %s", index, e.Subject, r.Subject)
+		}
+
+		if !e.Date.Equal(r.Date) {
+			t.Errorf("[Test Case %v] Wrong date. Expected: %s, Got: %s", index, e.Date, r.Date)
+		}
+
+		if e.MessageID != r.MessageID {
+			t.Errorf("[Test Case %v] Wrong message id. Expected: %s, Got: %s", index, e.MessageID, r.MessageID)
+		}
+
+		if !assertSliceEq(e.References, r.References) {
+			t.Errorf("[Test Case %v] Wrong references. Expected: %s, Got: %s", index, e.References, r.References)
+		}
+
+		if !assertAddressListEq(dereferenceAddressList(e.From), dereferenceAddressList(r.From)) {
+			t.Errorf("[Test Case %v] Wrong from. Expected: %s, Got: %s", index, e.From, r.From)
+		}
+
+		if !assertAddressListEq(dereferenceAddressList(e.To), dereferenceAddressList(r.To)) {
+			t.Errorf("[Test Case %v] Wrong to. Expected: %s, Got: %s", index, e.To, r.To)
+		}
+
+		if !assertAddressListEq(dereferenceAddressList(e.Cc), dereferenceAddressList(r.Cc)) {
+			t.Errorf("[Test Case %v] Wrong cc. Expected: %s, Got: %s", index, e.Cc, r.Cc)
+		}
+
+		if !assertAddressListEq(dereferenceAddressList(e.ResentTo), dereferenceAddressList(r.ResentTo)) {
+			t.Errorf("[Test Case %v] Wrong resent to. Expected: %s, Got: %s", index, e.ResentTo, r.ResentTo)
+		}
+
+		if normalizeLineBreaks(e.TextBody) != normalizeLineBreaks(r.TextBody) {
+			t.Errorf("[Test Case %v] Wrong text body. Expected: %q, Got: %q", index, e.TextBody, r.TextBody)
+		}
+
+		if normalizeLineBreaks(e.HTMLBody) != normalizeLineBreaks(r.HTMLBody) {
+			t.Errorf("[Test Case %v] Wrong html body. Expected: %q, Got: %q", index, e.HTMLBody, r.HTMLBody)
+		}
+
+		if len(e.Attachments) != len(r.Attachments) {
+			t.Errorf("[Test Case %v] Wrong number of attachments. Expected: %v, Got: %v", index, len(e.Attachments), len(r.Attachments))
+		} else {
+			for i := range e.Attachments {
+				expected, _ := ioutil.ReadAll(e.Attachments[i].Data)
+				got, _ := ioutil.ReadAll(r.Attachments[i].Data)
+				if e.Attachments[i].Filename != r.Attachments[i].Filename || e.Attachments[i].ContentType != r.Attachments[i].ContentType || !bytes.Equal(expected, got) {
+					t.Errorf("[Test Case %v] Wrong attachment %v. Expected: %s, Got: %s", index, i, e.Attachments[i].Filename, r.Attachments[i].Filename)
+				}
+			}
+		}
+
+		if len(e.EmbeddedFiles) != len(r.EmbeddedFiles) {
+			t.Errorf("[Test Case %v] Wrong number of embedded files. Expected: %v, Got: %v", index, len(e.EmbeddedFiles), len(r.EmbeddedFiles))
+		} else {
+			for i := range e.EmbeddedFiles {
+				expected, _ := ioutil.ReadAll(e.EmbeddedFiles[i].Data)
+				got, _ := ioutil.ReadAll(r.EmbeddedFiles[i].Data)
+				if e.EmbeddedFiles[i].CID != r.EmbeddedFiles[i].CID || !bytes.Equal(expected, got) {
+					t.Errorf("[Test Case %v] Wrong embedded file %v. Expected: %s, Got: %s", index, i, e.EmbeddedFiles[i].CID, r.EmbeddedFiles[i].CID)
+				}
+			}
+		}
+	}
+}
+
+func TestFoldHeaderField(t *testing.T) {
+	folded := foldHeaderField("Subject", strings.Repeat("word ", 40))
+	for _, line := range strings.Split(folded, "\r\n") {
+		if len(line) > maxHeaderLineLength {
+			t.Errorf("Folded line too long: %q", line)
+		}
+	}
+
+	if unfoldHeaderValue(strings.TrimPrefix(folded, "Subject:")) != strings.TrimSpace(strings.Repeat("word ", 40)) {
+		t.Errorf("Folding changed the value: %q", folded)
+	}
+}
+
+func TestWriteToDecodesBodies(t *testing.T) {
+	var testData = map[int]struct {
+		mailData string
+		text     string
+		html     string
+	}{
+		1: {
+			mailData: `From: a@example.com
+To: b@example.com
+Subject: QP
+MIME-Version: 1.0
+Content-Type: text/plain; charset=iso-8859-1
+Content-Transfer-Encoding: quoted-printable
+
+Caf=E9 au lait, a very long line which is soft broken by the quoted-printab=
+le encoding.
+`,
+			text: "Caf\xe9 au lait, a very long line which is soft broken by the quoted-printable encoding.",
+		},
+		2: {
+			mailData: `From: a@example.com
+To: b@example.com
+Subject: Base64
+MIME-Version: 1.0
+Content-Type: text/html; charset=utf-8
+Content-Transfer-Encoding: base64
+
+PHA+xb5sdcWlb3XEjWvDvTwvcD4K
+`,
+			html: "<p>žluťoučký</p>",
+		},
+		3: {
+			mailData: `From: a@example.com
+To: b@example.com
+Subject: Text around an attachment
+MIME-Version: 1.0
+Content-Type: multipart/mixed; boundary="b1"
+
+--b1
+Content-Type: text/plain; charset=utf-8
+Content-Transfer-Encoding: base64
+
+aGVsbG8K
+--b1
+Content-Type: application/octet-stream
+Content-Disposition: attachment; filename="a.bin"
+Content-Transfer-Encoding: base64
+
+AAEC
+--b1
+Content-Type: text/plain; charset=utf-8
+Content-Transfer-Encoding: quoted-printable
+
+=C3=A9
+--b1--
+`,
+			text: "helloé",
+		},
+	}
+
+	for index, td := range testData {
+		e, err := Parse(strings.NewReader(td.mailData))
+		if err != nil {
+			t.Errorf("[Test Case %v] %v", index, err)
+			continue
+		}
+		e.Attachments = append(e.Attachments, Attachment{Filename: "b.txt", ContentType: "text/plain", Data: strings.NewReader("b")})
+
+		buf := new(bytes.Buffer)
+		if _, err := e.WriteTo(buf); err != nil {
+			t.Errorf("[Test Case %v] %v", index, err)
+			continue
+		}
+
+		r, err := Parse(bytes.NewReader(buf.Bytes()))
+		if err != nil {
+			t.Errorf("[Test Case %v] Can't parse written email: %v", index, err)
+			continue
+		}
+
+		text, html := "", ""
+		for _, b := range r.TextBodies {
+			data, _ := ioutil.ReadAll(b.Data)
+			text += strings.TrimSuffix(string(data), "\r\n")
+		}
+		for _, b := range r.HTMLBodies {
+			data, _ := ioutil.ReadAll(b.Data)
+			html += strings.TrimSuffix(string(data), "\r\n")
+		}
+
+		if text != td.text {
+			t.Errorf("[Test Case %v] Wrong text body. Expected: %q, Got: %q", index, td.text, text)
+		}
+		if html != td.html {
+			t.Errorf("[Test Case %v] Wrong html body. Expected: %q, Got: %q", index, td.html, html)
+		}
+	}
+}
+
+func TestWriteToEditedBody(t *testing.T) {
+	e, err := Parse(strings.NewReader(`From: a@example.com
+To: b@example.com
+Subject: Flowed
+MIME-Version: 1.0
+Content-Type: text/plain; charset=iso-8859-1; format=flowed; delsp=yes
+Content-Transfer-Encoding: quoted-printable
+
+Un caf=E9 =
+au lait
+`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	e.TextBody = "Café au lait"
+
+	buf := new(bytes.Buffer)
+	if _, err := e.WriteTo(buf); err != nil {
+		t.Fatal(err)
+	}
+
+	r, err := Parse(bytes.NewReader(buf.Bytes()))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(r.TextBodies) != 1 {
+		t.Fatalf("Wrong number of text bodies. Got: %d", len(r.TextBodies))
+	}
+	if params := r.TextBodies[0].Params; len(params) != 1 || params["charset"] != "utf-8" {
+		t.Errorf("Wrong text body params. Expected: charset=utf-8, Got: %v", params)
+	}
+	if data, _ := ioutil.ReadAll(r.TextBodies[0].Data); strings.TrimSuffix(string(data), "\r\n") != "Café au lait" {
+		t.Errorf("Wrong text body. Expected: %q, Got: %q", "Café au lait", data)
+	}
+}
+
+func TestWriteToDecodedFlowedBody(t *testing.T) {
+	e, err := ParseWithOptions(strings.NewReader(`From: a@example.com
+To: b@example.com
+Subject: Flowed
+MIME-Version: 1.0
+Content-Type: text/plain; charset=iso-8859-1; format=flowed
+Content-Transfer-Encoding: quoted-printable
+
+Un caf=E9 =
+au lait
+`), ParseOptions{DecodeFlowed: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	buf := new(bytes.Buffer)
+	if _, err := e.WriteTo(buf); err != nil {
+		t.Fatal(err)
+	}
+
+	r, err := Parse(bytes.NewReader(buf.Bytes()))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(r.TextBodies) != 1 {
+		t.Fatalf("Wrong number of text bodies. Got: %d", len(r.TextBodies))
+	}
+	if params := r.TextBodies[0].Params; len(params) != 1 || params["charset"] != "iso-8859-1" {
+		t.Errorf("Wrong text body params. Expected: charset=iso-8859-1, Got: %v", params)
+	}
+	if data, _ := ioutil.ReadAll(r.TextBodies[0].Data); strings.TrimSuffix(string(data), "\r\n") != "Un caf\xe9 au lait" {
+		t.Errorf("Wrong text body. Expected: %q, Got: %q", "Un caf\xe9 au lait", data)
+	}
+}
+
+func TestReadAndReset(t *testing.T) {
+	var r io.Reader = strings.NewReader("attachment")
+	if _, err := io.CopyN(ioutil.Discard, r, 3); err != nil {
+		t.Fatal(err)
+	}
+
+	data, err := readAndReset(&r)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(data) != "attachment" {
+		t.Errorf("Wrong data. Expected: %q, Got: %q", "attachment", data)
+	}
+
+	if rest, _ := ioutil.ReadAll(r); string(rest) != "achment" {
+		t.Errorf("Position not restored. Expected: %q, Got: %q", "achment", rest)
+	}
+}
+
+func TestWriteToHeaderOrder(t *testing.T) {
+	e, err := Parse(strings.NewReader(traceFieldsExample))
+	if err != nil {
+		t.Fatal(err)
+	}
+	e.Subject = "Changed"
+	e.Header["X-Changed"] = []string{"new value"}
+	e.Header["X-Added"] = []string{"added"}
+	delete(e.Header, "X-Removed")
+
+	buf := new(bytes.Buffer)
+	if _, err := e.WriteTo(buf); err != nil {
+		t.Fatal(err)
+	}
+
+	expected := "Received: from mx.example.com (mx.example.com [192.0.2.1])\r\n" +
+		"\tby mail.example.net; Fri, 21 Nov 1997 09:55:06 -0600\r\n" +
+		"DKIM-Signature: v=1; a=rsa-sha256; d=example.com; s=s1;\r\n" +
+		"\th=from:to:subject; bh=47DEQpj8HBSa+/TImW+5JCeuQeRkm5NMpJWZG3hSuFU=; b=dGVzdA==\r\n" +
+		"Received: from client.example.com by mx.example.com;\r\n" +
+		"\tFri, 21 Nov 1997 09:55:01 -0600\r\n" +
+		"From: <a@example.com>\r\n" +
+		"X-Mailer: =?iso-8859-1?q?Mail_=E0?=\r\n" +
+		"To: <b@example.com>\r\n" +
+		"Subject: Changed\r\n" +
+		"X-Changed: new value\r\n" +
+		"MIME-Version: 1.0\r\n" +
+		"X-Added: added\r\n" +
+		"Content-Type: text/plain\r\n" +
+		"\r\n" +
+		"hello"
+	if !strings.HasPrefix(buf.String(), expected) {
+		t.Errorf("Wrong header.\nExpected: %q\nGot:      %q", expected, buf.String())
+	}
+}
+
+var traceFieldsExample = `Received: from mx.example.com (mx.example.com [192.0.2.1])
+	by mail.example.net; Fri, 21 Nov 1997 09:55:06 -0600
+DKIM-Signature: v=1; a=rsa-sha256; d=example.com; s=s1;
+	h=from:to:subject; bh=47DEQpj8HBSa+/TImW+5JCeuQeRkm5NMpJWZG3hSuFU=; b=dGVzdA==
+Received: from client.example.com by mx.example.com;
+	Fri, 21 Nov 1997 09:55:01 -0600
+From: a@example.com
+X-Mailer: =?iso-8859-1?q?Mail_=E0?=
+To: b@example.com
+X-Removed: gone
+Subject: Hello
+X-Changed: old value
+MIME-Version: 1.0
+Content-Type: text/plain
+
+hello
+`